@@ -0,0 +1,125 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/logging"
+	"PSbackend/models"
+	"PSbackend/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// snapshot converts the API representation of a document into the state stored in an audit entry
+func snapshot(v interface{}) bson.M {
+	if v == nil {
+		return nil
+	}
+	body, err := json.Marshal(v)
+	if err != nil {
+		slog.Error("Failed to snapshot an audited document", "error", err)
+		return nil
+	}
+	var state bson.M
+	if err := json.Unmarshal(body, &state); err != nil {
+		slog.Error("Failed to snapshot an audited document", "error", err)
+		return nil
+	}
+	return state
+}
+
+// recordAudit appends an entry for an action performed by the caller; failing to record it doesn't fail the request
+func recordAudit(audit store.AuditStore, r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	identity, _ := auth.FromContext(r.Context())
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	entry := models.AuditEntry{
+		At:         time.Now(),
+		ActorID:    identity.UserID,
+		ActorNIF:   identity.NIF,
+		ActorRoles: identity.Roles,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     snapshot(before),
+		After:      snapshot(after),
+		Request: models.AuditRequest{
+			ID:        logging.RequestID(r.Context()),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			IP:        ip,
+			UserAgent: r.UserAgent(),
+		},
+	}
+
+	// The action already happened, so it's recorded even if the client has gone away
+	ctx, cancel := detach(r.Context())
+	defer cancel()
+	err = audit.Insert(ctx, entry)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit entry", "action", action, "target_type", targetType, "target_id", targetID, "error", err)
+	}
+}
+
+// GetAuditLog handles GET requests to query the audit log by actor, target and time range
+func GetAuditLog(audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var query struct {
+		Actor      string `json:"actor" validate:"max=100"`
+		Target     string `json:"target" validate:"max=100"`
+		TargetType string `json:"target_type" validate:"max=100"`
+		Action     string `json:"action" validate:"max=100"`
+		From       string `json:"from" validate:"datetime"`
+		To         string `json:"to" validate:"datetime,gtfield=from"`
+		Limit      string `json:"limit" validate:"numeric,max=4"`
+	}
+	if !decodeQuery(w, r, &query) {
+		return
+	}
+
+	filter := store.AuditQuery{
+		ActorID:    query.Actor,
+		TargetID:   query.Target,
+		TargetType: query.TargetType,
+		Action:     query.Action,
+		Limit:      defaultAuditLimit,
+	}
+	if query.From != "" {
+		filter.From = parseTime(query.From)
+	}
+	if query.To != "" {
+		filter.To = parseTime(query.To)
+	}
+	if query.Limit != "" {
+		// The numeric rule already made sure it's a number
+		filter.Limit, _ = strconv.Atoi(query.Limit)
+		if filter.Limit == 0 || filter.Limit > maxAuditLimit {
+			invalidField(w, r, "limit", fmt.Sprintf("must be between 1 and %d", maxAuditLimit))
+			return
+		}
+	}
+
+	entries, err := audit.Find(r.Context(), filter)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(entries)
+}
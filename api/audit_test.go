@@ -0,0 +1,179 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"PSbackend/auth"
+	"PSbackend/background"
+	"PSbackend/logging"
+	"PSbackend/mailer"
+	"PSbackend/models"
+	"PSbackend/store"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSnapshot(t *testing.T) {
+	user := models.User{Name: "John Doe", Email: "john@example.com", Password: "secret", IsActive: true}
+
+	state := snapshot(user.Public())
+	if state["email"] != "john@example.com" || state["is_active"] != true {
+		t.Errorf("Snapshot lost fields: %v", state)
+	}
+	if _, ok := state["password"]; ok {
+		t.Error("Snapshot contains the password")
+	}
+
+	if snapshot(nil) != nil {
+		t.Error("Expected no snapshot for a missing state")
+	}
+}
+
+// adminRequest builds a request by an admin, tagged with requestID, with an optional JSON body and path parameters
+func adminRequest(admin models.User, requestID, method string, body interface{}, vars map[string]string) *http.Request {
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, "/api/v1/bo/users", bytes.NewReader(payload))
+	ctx := logging.WithRequestID(req.Context(), requestID)
+	ctx = auth.WithIdentity(ctx, auth.Identity{UserID: admin.ID.Hex(), NIF: admin.NIF, Roles: []string{models.RoleAdmin}})
+	return mux.SetURLVars(req.WithContext(ctx), vars)
+}
+
+func TestAuditedHandlersRecordEntries(t *testing.T) {
+	stores := store.NewMemoryStores()
+	ctx := context.Background()
+	admin := models.User{ID: primitive.NewObjectID(), NIF: 123456789, Email: "admin@example.com", Role: []models.Role{{Name: models.RoleAdmin}}}
+	tech := models.User{ID: primitive.NewObjectID(), NIF: 210422114, Email: "tech@example.com", IsActive: true, Role: []models.Role{{Name: models.RoleClient}}}
+	for _, user := range []models.User{admin, tech} {
+		if err := stores.Users.UpsertByEmail(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fee := models.Fee{ID: primitive.NewObjectID(), NIF: int64(tech.NIF), Value: 10}
+	if err := stores.Fees.Insert(ctx, fee); err != nil {
+		t.Fatal(err)
+	}
+	jobs := &background.Group{}
+
+	steps := []struct {
+		action   string
+		targetID string
+		serve    func(w http.ResponseWriter, r *http.Request)
+		req      *http.Request
+	}{
+		{
+			models.AuditUserRoleChanged, tech.ID.Hex(),
+			func(w http.ResponseWriter, r *http.Request) { UpdateUser(stores.Users, stores.Audit, w, r) },
+			adminRequest(admin, "role", http.MethodPut, map[string]interface{}{"role": []models.Role{{Name: models.RoleTech}}}, map[string]string{"nif": "210422114"}),
+		},
+		{
+			models.AuditUserBlockChanged, tech.ID.Hex(),
+			func(w http.ResponseWriter, r *http.Request) {
+				UpdateBlock(stores.Users, stores.Sessions, stores.Audit, w, r)
+			},
+			adminRequest(admin, "block", http.MethodPut, map[string]string{"email": tech.Email}, nil),
+		},
+		{
+			models.AuditFeePaid, fee.ID.Hex(),
+			func(w http.ResponseWriter, r *http.Request) {
+				PayFee(stores.Fees, stores.Users, stores.Audit, &mailer.Memory{}, jobs, w, r)
+			},
+			adminRequest(admin, "fee", http.MethodPut, nil, map[string]string{"id": fee.ID.Hex()}),
+		},
+		{
+			models.AuditUserDeleted, tech.ID.Hex(),
+			func(w http.ResponseWriter, r *http.Request) {
+				DeleteUser(stores.Users, stores.Sessions, stores.Audit, w, r)
+			},
+			adminRequest(admin, "delete", http.MethodDelete, map[string]int{"nif": tech.NIF}, nil),
+		},
+	}
+	for _, step := range steps {
+		w := httptest.NewRecorder()
+		step.serve(w, step.req)
+		// Let the invoice find its technician before the user is deleted
+		jobs.Wait(ctx)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected status code 200, got %v. Response: %s", step.action, w.Code, w.Body.String())
+		}
+
+		entries, _ := stores.Audit.Find(ctx, store.AuditQuery{Action: step.action})
+		if len(entries) != 1 {
+			t.Fatalf("%s: expected one entry, got %+v", step.action, entries)
+		}
+		entry := entries[0]
+		if entry.ActorID != admin.ID.Hex() || entry.TargetID != step.targetID || entry.Request.ID != logging.RequestID(step.req.Context()) {
+			t.Errorf("%s: unexpected entry %+v", step.action, entry)
+		}
+	}
+
+	entries, _ := stores.Audit.Find(ctx, store.AuditQuery{Action: models.AuditUserRoleChanged})
+	before, _ := json.Marshal(entries[0].Before["role"])
+	after, _ := json.Marshal(entries[0].After["role"])
+	if !bytes.Contains(before, []byte(`"name":"CLIENT"`)) || !bytes.Contains(after, []byte(`"name":"TECH"`)) {
+		t.Errorf("Expected the roles before and after in the entry, got %s and %s", before, after)
+	}
+}
+
+func TestGetAuditLogFilters(t *testing.T) {
+	audit := store.NewMemoryStores().Audit
+	ctx := context.Background()
+	at := time.Date(2030, 6, 3, 10, 0, 0, 0, time.UTC)
+	entries := []models.AuditEntry{
+		{ID: primitive.NewObjectID(), At: at, ActorID: "admin-1", TargetID: "user-1", Action: models.AuditUserBlockChanged},
+		{ID: primitive.NewObjectID(), At: at.Add(time.Hour), ActorID: "admin-2", TargetID: "user-1", Action: models.AuditUserDeleted},
+		{ID: primitive.NewObjectID(), At: at.Add(2 * time.Hour), ActorID: "admin-1", TargetID: "fee-1", Action: models.AuditFeePaid},
+	}
+	for _, entry := range entries {
+		if err := audit.Insert(ctx, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query    string
+		status   int
+		expected []primitive.ObjectID
+	}{
+		{"", http.StatusOK, []primitive.ObjectID{entries[2].ID, entries[1].ID, entries[0].ID}},
+		{"actor=admin-1", http.StatusOK, []primitive.ObjectID{entries[2].ID, entries[0].ID}},
+		{"target=user-1", http.StatusOK, []primitive.ObjectID{entries[1].ID, entries[0].ID}},
+		{"from=2030-06-03T10:30:00Z&to=2030-06-03T11:30:00Z", http.StatusOK, []primitive.ObjectID{entries[1].ID}},
+		{"actor=admin-1&limit=1", http.StatusOK, []primitive.ObjectID{entries[2].ID}},
+		{"from=yesterday", http.StatusBadRequest, nil},
+		{"from=2030-06-03T11:00:00Z&to=2030-06-03T10:00:00Z", http.StatusBadRequest, nil},
+		{"limit=0", http.StatusBadRequest, nil},
+		{"limit=5000", http.StatusBadRequest, nil},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		GetAuditLog(audit, w, httptest.NewRequest(http.MethodGet, "/api/v1/bo/audit?"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%q: expected status code %v, got %v. Response: %s", test.query, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		var found []models.AuditEntry
+		json.NewDecoder(w.Body).Decode(&found)
+		if len(found) != len(test.expected) {
+			t.Errorf("%q: expected %d entries, got %+v", test.query, len(test.expected), found)
+			continue
+		}
+		for i, entry := range found {
+			if entry.ID != test.expected[i] {
+				t.Errorf("%q: expected entry %d to be %s, got %s", test.query, i, test.expected[i].Hex(), entry.ID.Hex())
+			}
+		}
+	}
+}
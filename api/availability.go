@@ -0,0 +1,218 @@
+package api
+
+import (
+	"PSbackend/config"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAvailabilityRange bounds the period searched for free slots at once
+const maxAvailabilityRange = 31 * 24 * time.Hour
+
+// freeSlot is a period a technician can be booked for
+type freeSlot struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// availabilityResponse lists the free slots of a technician between From and To, and the time zone of their
+// schedule
+type availabilityResponse struct {
+	TechnicianID primitive.ObjectID `json:"technician_id"`
+	Zone         string             `json:"zone"`
+	From         time.Time          `json:"from"`
+	To           time.Time          `json:"to"`
+	Slots        []freeSlot         `json:"slots"`
+}
+
+// isTechnician reports whether the user holds the TECH role
+func isTechnician(user models.User) bool {
+	for _, role := range user.Role {
+		if role.Name == models.RoleTech {
+			return true
+		}
+	}
+	return false
+}
+
+// takesAppointments reports whether a technician can be booked at all
+func takesAppointments(provider models.User) bool {
+	return provider.IsActive && !provider.BlockServices
+}
+
+// clashes reports whether an appointment overlaps one of the booked ones, each followed by buffer
+func clashes(appointment models.Appointment, booked []models.Appointment, buffer time.Duration) bool {
+	for _, other := range booked {
+		if other.HoldsSlots() && appointment.Overlaps(other, buffer) {
+			return true
+		}
+	}
+	return false
+}
+
+// bookedAround finds the appointments of a technician, or of every technician when providerID is zero,
+// that may clash with the period from from to to
+func bookedAround(r *http.Request, appointments store.AppointmentStore, providerID primitive.ObjectID, from, to time.Time, buffer time.Duration) ([]models.Appointment, error) {
+	// Widen the period by the buffer and a slot, since appointments clash by the slots they round to
+	margin := buffer + models.SlotLength
+	return appointments.Find(r.Context(), store.AppointmentQuery{ProviderID: providerID, From: from.Add(-margin), To: to.Add(margin)})
+}
+
+// freeSlots lists the periods of length duration, starting every granularity from the start of each period
+// the provider works in, that fall between from and to, after now, and clear of the booked appointments and
+// their buffer
+func freeSlots(provider models.User, booked []models.Appointment, from, to, now time.Time, duration time.Duration, booking config.Booking) []freeSlot {
+	slots := make([]freeSlot, 0)
+	for _, period := range workingPeriods(provider, from, to, booking) {
+		for start := period.Start; !start.Add(duration).After(period.End); start = start.Add(booking.Granularity) {
+			end := start.Add(duration)
+			if start.Before(from) || start.Before(now) || end.After(to) {
+				continue
+			}
+			if clashes(models.Appointment{Start: start, End: end}, booked, booking.Buffer) {
+				continue
+			}
+			slots = append(slots, freeSlot{Start: start, End: end})
+		}
+	}
+	return slots
+}
+
+// GetAvailability handles GET requests to get the free slots of a technician in a period
+func GetAvailability(users store.UserStore, appointments store.AppointmentStore, booking config.Booking, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	objectID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		invalidField(w, r, "id", "Invalid ID format")
+		return
+	}
+
+	var query struct {
+		From    string `json:"from" validate:"required,datetime"`
+		To      string `json:"to" validate:"required,datetime,gtfield=from"`
+		Minutes string `json:"minutes" validate:"numeric,max=4"`
+	}
+	if !decodeQuery(w, r, &query) {
+		return
+	}
+
+	from := parseTime(query.From)
+	to := parseTime(query.To)
+	if to.Sub(from) > maxAvailabilityRange {
+		invalidField(w, r, "to", "must be at most 31 days after from")
+		return
+	}
+	duration := booking.Granularity
+	if query.Minutes != "" {
+		minutes, _ := strconv.Atoi(query.Minutes)
+		if minutes == 0 {
+			invalidField(w, r, "minutes", "must be greater than 0")
+			return
+		}
+		duration = time.Duration(minutes) * time.Minute
+		if duration > booking.MaxLength {
+			invalidField(w, r, "minutes", fmt.Sprintf("must be at most %s", booking.MaxLength))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	provider, err := users.FindByID(ctx, objectID)
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "Technician not found")
+		return
+	}
+	if !isTechnician(provider) {
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "Technician not found")
+		return
+	}
+
+	zone := provider.WorkingSchedule(booking.Zone).Location().String()
+	response := availabilityResponse{TechnicianID: provider.ID, Zone: zone, From: from, To: to, Slots: make([]freeSlot, 0)}
+	if takesAppointments(provider) {
+		booked, err := bookedAround(r, appointments, provider.ID, from, to, booking.Buffer)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		response.Slots = freeSlots(provider, booked, from, to, time.Now(), duration, booking)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetAvailableTechnicians handles GET requests to get the technicians of a service type and locality that
+// can be booked for a period
+func GetAvailableTechnicians(users store.UserStore, appointments store.AppointmentStore, booking config.Booking, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var query struct {
+		ServiceType string `json:"service_type" validate:"required,max=100"`
+		Locality    string `json:"locality" validate:"required,max=100"`
+		Start       string `json:"start" validate:"required,datetime"`
+		End         string `json:"end" validate:"required,datetime,gtfield=start"`
+	}
+	if !decodeQuery(w, r, &query) {
+		return
+	}
+
+	start := parseTime(query.Start)
+	end := parseTime(query.End)
+	if end.Sub(start) > maxAvailabilityRange {
+		invalidField(w, r, "end", "must be at most 31 days after start")
+		return
+	}
+	appointment := models.Appointment{Start: start, End: end}
+
+	ctx := r.Context()
+	list, err := users.List(ctx)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	booked, err := bookedAround(r, appointments, primitive.NilObjectID, start, end, booking.Buffer)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+	bookedBy := map[primitive.ObjectID][]models.Appointment{}
+	for _, other := range booked {
+		bookedBy[other.Provider.ID] = append(bookedBy[other.Provider.ID], other)
+	}
+
+	available := make([]models.User, 0)
+	for _, provider := range usersWithRole(list, models.RoleTech) {
+		if !takesAppointments(provider) || !strings.EqualFold(strings.TrimSpace(provider.Locality), strings.TrimSpace(query.Locality)) {
+			continue
+		}
+		if offers(provider, query.ServiceType) && withinWorkingHours(provider, start, end, booking) && !clashes(appointment, bookedBy[provider.ID], booking.Buffer) {
+			available = append(available, provider)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.PublicUsers(available))
+}
+
+// offers reports whether a technician provides a service type
+func offers(provider models.User, serviceType string) bool {
+	for _, service := range provider.ServiceTypes {
+		if strings.EqualFold(service.Name, serviceType) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"PSbackend/config"
+	"PSbackend/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetAvailability(t *testing.T) {
+	stores := bookingStores(t)
+	booking := config.Booking{Granularity: time.Hour, Buffer: 30 * time.Minute, MaxLength: 24 * time.Hour}
+	w := bookWith(stores, booking, "tech@example.com", "2030-06-03T10:00:00Z", "2030-06-03T12:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	// The buffer keeps the technician free for 30 minutes after the appointment
+	w = bookWith(stores, booking, "tech@example.com", "2030-06-03T12:00:00Z", "2030-06-03T13:00:00Z")
+	if w.Code != http.StatusConflict {
+		t.Fatalf("Expected status code 409 within the buffer, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	tech, _ := stores.Users.FindByEmail(context.Background(), "tech@example.com")
+	query := url.Values{"from": {"2030-06-03T00:00:00Z"}, "to": {"2030-06-04T00:00:00Z"}}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/technicians/"+tech.ID.Hex()+"/availability?"+query.Encode(), nil)
+	req = mux.SetURLVars(req, map[string]string{"id": tech.ID.Hex()})
+	w = httptest.NewRecorder()
+	GetAvailability(stores.Users, stores.Appointments, booking, w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	var response availabilityResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	var starts []int
+	for _, slot := range response.Slots {
+		starts = append(starts, slot.Start.Hour())
+		if slot.End.Sub(slot.Start) != time.Hour {
+			t.Errorf("Expected one hour slots, got %+v", slot)
+		}
+	}
+	expected := []int{13, 14, 15, 16, 17}
+	if len(starts) != len(expected) {
+		t.Fatalf("Expected slots starting at %v, got %v", expected, starts)
+	}
+	for i := range expected {
+		if starts[i] != expected[i] {
+			t.Fatalf("Expected slots starting at %v, got %v", expected, starts)
+		}
+	}
+}
+
+func TestGetAvailabilityRejectsLongSlots(t *testing.T) {
+	stores := bookingStores(t)
+	booking := config.Booking{Granularity: time.Hour, MaxLength: 2 * time.Hour}
+	tech, _ := stores.Users.FindByEmail(context.Background(), "tech@example.com")
+
+	tests := map[string]int{"120": http.StatusOK, "121": http.StatusBadRequest, "9999": http.StatusBadRequest}
+	for minutes, status := range tests {
+		query := url.Values{"from": {"2030-06-03T00:00:00Z"}, "to": {"2030-06-04T00:00:00Z"}, "minutes": {minutes}}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/technicians/"+tech.ID.Hex()+"/availability?"+query.Encode(), nil)
+		req = mux.SetURLVars(req, map[string]string{"id": tech.ID.Hex()})
+		w := httptest.NewRecorder()
+		GetAvailability(stores.Users, stores.Appointments, booking, w, req)
+		if w.Code != status {
+			t.Errorf("%s minutes: expected status code %v, got %v. Response: %s", minutes, status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestGetAvailableTechnicians(t *testing.T) {
+	stores := bookingStores(t)
+	booking := config.Booking{Granularity: time.Hour, MaxLength: 24 * time.Hour}
+	if w := bookWith(stores, booking, "tech@example.com", "2030-06-03T10:00:00Z", "2030-06-03T12:00:00Z"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	tests := map[string]struct {
+		locality, start, end string
+		available            int
+	}{
+		"free":      {"coimbra", "2030-06-03T14:00:00Z", "2030-06-03T15:00:00Z", 1},
+		"booked":    {"Coimbra", "2030-06-03T11:00:00Z", "2030-06-03T13:00:00Z", 0},
+		"off work":  {"Coimbra", "2030-06-03T19:00:00Z", "2030-06-03T20:00:00Z", 0},
+		"elsewhere": {"Porto", "2030-06-03T14:00:00Z", "2030-06-03T15:00:00Z", 0},
+	}
+	for name, test := range tests {
+		query := url.Values{"service_type": {"plumbing"}, "locality": {test.locality}, "start": {test.start}, "end": {test.end}}
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/technicians/available?"+query.Encode(), nil)
+		w := httptest.NewRecorder()
+		GetAvailableTechnicians(stores.Users, stores.Appointments, booking, w, req)
+
+		var technicians []models.PublicUser
+		json.NewDecoder(w.Body).Decode(&technicians)
+		if w.Code != http.StatusOK || len(technicians) != test.available {
+			t.Errorf("%s: expected %d technicians, got %v %s", name, test.available, w.Code, w.Body.String())
+		}
+		if test.available == 1 && technicians[0].Email != "tech@example.com" {
+			t.Errorf("%s: expected the unblocked technician, got %+v", name, technicians[0])
+		}
+	}
+
+	query := url.Values{"service_type": {"plumbing"}, "locality": {"Coimbra"}, "start": {"2030-06-03T14:00:00Z"}, "end": {"2030-08-03T14:00:00Z"}}
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/technicians/available?"+query.Encode(), nil)
+	w := httptest.NewRecorder()
+	GetAvailableTechnicians(stores.Users, stores.Appointments, booking, w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a range over 31 days to be rejected, got %v", w.Code)
+	}
+}
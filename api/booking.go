@@ -0,0 +1,50 @@
+package api
+
+import (
+	"PSbackend/config"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"fmt"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bookedSlot is what a booking is told about the appointment it clashed with, leaving out its client
+type bookedSlot struct {
+	ID     primitive.ObjectID `json:"id"`
+	Start  time.Time          `json:"start"`
+	End    time.Time          `json:"end"`
+	Status string             `json:"status"`
+}
+
+// workingPeriods returns the periods the provider works in that overlap from to to
+func workingPeriods(provider models.User, from, to time.Time, booking config.Booking) []models.Period {
+	return provider.WorkingSchedule(booking.Zone).Periods(from, to)
+}
+
+// withinWorkingHours reports whether an appointment from start to end falls inside one period the provider
+// works in, clear of their breaks and time off
+func withinWorkingHours(provider models.User, start, end time.Time, booking config.Booking) bool {
+	for _, period := range workingPeriods(provider, start, end, booking) {
+		if !start.Before(period.Start) && !end.After(period.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// outsideWorkingHours replies that an appointment doesn't fit the working hours of its provider
+func outsideWorkingHours(w http.ResponseWriter, r *http.Request, provider models.User, booking config.Booking) {
+	zone := provider.WorkingSchedule(booking.Zone).Location()
+	detail := fmt.Sprintf("The technician doesn't work at that time; their schedule is in %s", zone)
+	problem.Write(w, r, http.StatusConflict, problem.OutsideWorkingHours, detail)
+}
+
+// slotTaken replies that the provider already has the given appointment at the requested time
+func slotTaken(w http.ResponseWriter, r *http.Request, booked models.Appointment) {
+	p := problem.New(r, http.StatusConflict, problem.SlotTaken, "The technician already has an appointment at that time")
+	p.Conflict = bookedSlot{ID: booked.ID, Start: booked.Start, End: booked.End, Status: booked.Status}
+	p.Write(w)
+}
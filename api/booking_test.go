@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"PSbackend/auth"
+	"PSbackend/config"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func bookingStores(t *testing.T) store.Stores {
+	stores := store.NewMemoryStores()
+	ctx := context.Background()
+	users := []models.User{
+		{ID: primitive.NewObjectID(), Email: "client@example.com", IsActive: true, Role: []models.Role{{Name: models.RoleClient}}},
+		{
+			ID:           primitive.NewObjectID(),
+			Email:        "tech@example.com",
+			Role:         []models.Role{{Name: models.RoleTech}},
+			ServiceTypes: []models.ServiceType{{Name: "PLUMBING", Price: 20}},
+			Locality:     "Coimbra",
+			IsActive:     true,
+			WorkStart:    time.Date(2024, time.May, 1, 9, 0, 0, 0, time.UTC),
+			WorkEnd:      time.Date(2024, time.May, 1, 18, 0, 0, 0, time.UTC),
+		},
+		{
+			ID:            primitive.NewObjectID(),
+			Email:         "blocked@example.com",
+			Role:          []models.Role{{Name: models.RoleTech}},
+			ServiceTypes:  []models.ServiceType{{Name: "PLUMBING", Price: 20}},
+			Locality:      "Coimbra",
+			IsActive:      true,
+			BlockServices: true,
+		},
+	}
+	for _, user := range users {
+		if err := stores.Users.UpsertByEmail(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return stores
+}
+
+func book(stores store.Stores, provider, start, end string) *httptest.ResponseRecorder {
+	return bookWith(stores, config.Booking{Granularity: 30 * time.Minute, MaxLength: 24 * time.Hour}, provider, start, end)
+}
+
+func bookWith(stores store.Stores, booking config.Booking, provider, start, end string) *httptest.ResponseRecorder {
+	return bookAs(stores, booking, "client@example.com", provider, start, end)
+}
+
+// bookAs books an appointment for client@example.com on behalf of the user with the email caller
+func bookAs(stores store.Stores, booking config.Booking, caller, provider, start, end string) *httptest.ResponseRecorder {
+	user, _ := stores.Users.FindByEmail(context.Background(), caller)
+	payload, _ := json.Marshal(map[string]interface{}{
+		"client_email":   "client@example.com",
+		"provider_email": provider,
+		"service_name":   "plumbing",
+		"start":          start,
+		"end":            end,
+		"phone":          "912345678",
+		"nif":            "210422114",
+		"locality":       "Coimbra",
+		"totalPrice":     "40",
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/mb/services/appointment", bytes.NewBuffer(payload))
+	req = req.WithContext(auth.WithIdentity(req.Context(), auth.Identity{UserID: user.ID.Hex()}))
+	w := httptest.NewRecorder()
+	InsertAppointment(stores.Users, stores.Appointments, booking, w, req)
+	return w
+}
+
+func TestInsertAppointmentConflicts(t *testing.T) {
+	stores := bookingStores(t)
+
+	w := book(stores, "tech@example.com", "2024-06-03T10:00:00Z", "2024-06-03T12:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	w = book(stores, "tech@example.com", "2024-06-03T11:30:00Z", "2024-06-03T13:00:00Z")
+	var body struct {
+		problem.Problem
+		Conflict bookedSlot `json:"conflict"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusConflict || body.Code != problem.SlotTaken {
+		t.Fatalf("Expected a slot_taken conflict, got %v %+v", w.Code, body.Problem)
+	}
+	if !body.Conflict.Start.Equal(time.Date(2024, time.June, 3, 10, 0, 0, 0, time.UTC)) || body.Conflict.Status != models.StatusRequested {
+		t.Errorf("Expected the conflicting appointment, got %+v", body.Conflict)
+	}
+
+	// Back to back appointments don't overlap
+	w = book(stores, "tech@example.com", "2024-06-03T12:00:00Z", "2024-06-03T13:00:00Z")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	tests := map[string]struct {
+		provider, start, end string
+		status               int
+		code                 problem.Code
+	}{
+		"before work":      {"tech@example.com", "2024-06-04T08:00:00Z", "2024-06-04T10:00:00Z", http.StatusConflict, problem.OutsideWorkingHours},
+		"after work":       {"tech@example.com", "2024-06-04T17:00:00Z", "2024-06-04T19:00:00Z", http.StatusConflict, problem.OutsideWorkingHours},
+		"over two days":    {"tech@example.com", "2024-06-04T10:00:00Z", "2024-06-05T10:00:00Z", http.StatusConflict, problem.OutsideWorkingHours},
+		"blocked":          {"blocked@example.com", "2024-06-04T10:00:00Z", "2024-06-04T11:00:00Z", http.StatusConflict, problem.TechUnavailable},
+		"end before start": {"tech@example.com", "2024-06-04T11:00:00Z", "2024-06-04T10:00:00Z", http.StatusBadRequest, problem.InvalidField},
+	}
+	for name, test := range tests {
+		w := book(stores, test.provider, test.start, test.end)
+		var body problem.Problem
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != test.status || body.Code != test.code {
+			t.Errorf("%s: expected %v %s, got %v %+v", name, test.status, test.code, w.Code, body)
+		}
+	}
+}
+
+func TestBookConcurrently(t *testing.T) {
+	stores := bookingStores(t)
+
+	results := make(chan int, 10)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			results <- book(stores, "tech@example.com", "2024-06-03T10:00:00Z", "2024-06-03T11:00:00Z").Code
+		}()
+	}
+
+	booked := 0
+	for i := 0; i < cap(results); i++ {
+		if <-results == http.StatusOK {
+			booked++
+		}
+	}
+	if booked != 1 {
+		t.Errorf("Expected exactly one booking of the slot, got %d", booked)
+	}
+}
+
+func TestInsertAppointmentForAnotherClient(t *testing.T) {
+	stores := bookingStores(t)
+
+	w := bookAs(stores, config.Booking{Granularity: 30 * time.Minute, MaxLength: 24 * time.Hour}, "tech@example.com", "tech@example.com", "2024-06-03T10:00:00Z", "2024-06-03T11:00:00Z")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status code 403, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	list, _ := stores.Appointments.List(context.Background())
+	if len(list) != 0 {
+		t.Errorf("Expected no appointment in the name of another client, got %+v", list)
+	}
+}
+
+func TestBlockedUsersCantBook(t *testing.T) {
+	stores := bookingStores(t)
+	client, _ := stores.Users.FindByEmail(context.Background(), "client@example.com")
+	stores.Users.Update(context.Background(), client.ID, store.Fields{"block_services": true})
+
+	if w := book(stores, "tech@example.com", "2024-06-03T10:00:00Z", "2024-06-03T11:00:00Z"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a blocked client to be refused, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	stores.Users.Update(context.Background(), client.ID, store.Fields{"block_services": false})
+	if w := book(stores, "blocked@example.com", "2024-06-03T10:00:00Z", "2024-06-03T11:00:00Z"); w.Code != http.StatusConflict {
+		t.Errorf("Expected a blocked technician to be refused, got %v. Response: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestInsertAppointmentTooLong(t *testing.T) {
+	stores := bookingStores(t)
+
+	w := book(stores, "tech@example.com", "2024-06-03T10:00:00Z", "2024-06-05T10:00:00Z")
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusBadRequest || len(body.Fields) != 1 || body.Fields[0].Field != "end" {
+		t.Fatalf("Expected an appointment longer than a day to be rejected, got %v %+v", w.Code, body)
+	}
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"PSbackend/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// check is the outcome of one readiness check
+type check struct {
+	Status string `json:"status"`
+}
+
+// checkResult turns the error of the check called name into its outcome; the error is only logged, since
+// anyone can call /readyz
+func checkResult(ctx context.Context, name string, err error) check {
+	if err != nil {
+		slog.ErrorContext(ctx, "Readiness check failed", "check", name, "error", err)
+		return check{Status: "failed"}
+	}
+	return check{Status: "ok"}
+}
+
+// readable makes sure path can be opened, and is a directory when dir is set
+func readable(path string, dir bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() != dir {
+		return fmt.Errorf("%s has the wrong file type", path)
+	}
+	return nil
+}
+
+// checkMail reports whether emails can be sent; the service still serves requests without them
+func checkMail(cfg config.Config) check {
+	if cfg.FromEmail == "" || cfg.SendGridAPIKey == "" {
+		return check{Status: "unconfigured"}
+	}
+	return check{Status: "ok"}
+}
+
+// Healthz handles GET requests to tell that the process is alive
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Readyz handles GET requests to tell whether the service can serve traffic, with the status of each check
+func Readyz(client *mongo.Client, cfg config.Config, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	checks := map[string]check{
+		"mongo":       checkResult(ctx, "mongo", config.TestConnection(ctx, *client)),
+		"invoice_dir": checkResult(ctx, "invoice_dir", readable(invoiceDir, true)),
+		"font":        checkResult(ctx, "font", readable(fontFile, false)),
+		"mail":        checkMail(cfg),
+	}
+
+	status, code := "ready", http.StatusOK
+	for _, result := range checks {
+		if result.Status == "failed" {
+			status, code = "unready", http.StatusServiceUnavailable
+		}
+	}
+
+	jsonResponse := map[string]interface{}{
+		"status": status,
+		"checks": checks,
+	}
+
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(jsonResponse)
+}
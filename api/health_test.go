@@ -0,0 +1,48 @@
+package api
+
+import (
+	"PSbackend/config"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHealthz(t *testing.T) {
+	w := httptest.NewRecorder()
+	Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v", w.Code)
+	}
+}
+
+func TestReadinessChecks(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "font.ttf")
+	if err := os.WriteFile(file, []byte("font"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := readable(dir, true); err != nil {
+		t.Errorf("Expected the directory to be readable, got %v", err)
+	}
+	if err := readable(file, false); err != nil {
+		t.Errorf("Expected the file to be readable, got %v", err)
+	}
+	if err := readable(file, true); err == nil {
+		t.Error("Expected a file to fail the directory check")
+	}
+
+	// The reason of a failure is logged, not sent
+	result, _ := json.Marshal(checkResult(context.Background(), "font", readable(filepath.Join(dir, "missing"), false)))
+	if string(result) != `{"status":"failed"}` {
+		t.Errorf("Expected a missing file to fail without details, got %s", result)
+	}
+
+	if result := checkMail(config.Config{FromEmail: "fixfinder@example.com"}); result.Status != "unconfigured" {
+		t.Errorf("Expected mail without an API key to be unconfigured, got %+v", result)
+	}
+}
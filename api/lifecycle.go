@@ -0,0 +1,149 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/lifecycle"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// moveAppointment takes an action on the appointment named by the id path parameter on behalf of the caller
+// and returns the updated appointment; it returns false when it already replied
+func moveAppointment(appointments store.AppointmentStore, audit store.AuditStore, action string, w http.ResponseWriter, r *http.Request) (models.Appointment, bool) {
+	objectID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		invalidField(w, r, "id", "Invalid ID format")
+		return models.Appointment{}, false
+	}
+
+	// The reason is optional, and so is the body
+	var requestBody struct {
+		Reason string `json:"reason" validate:"max=500"`
+	}
+	if r.ContentLength != 0 && !decodeBody(w, r, &requestBody) {
+		return models.Appointment{}, false
+	}
+
+	ctx := r.Context()
+	appointment, err := appointments.FindByID(ctx, objectID)
+	if err != nil {
+		storeError(w, r, err, problem.AppointmentNotFound, "Appointment not found")
+		return models.Appointment{}, false
+	}
+
+	party, ok := partyOf(r, appointment)
+	if !ok {
+		auth.Forbidden(w, r)
+		return models.Appointment{}, false
+	}
+	transition, ok := models.FindTransition(action, party)
+	if !ok {
+		problem.Write(w, r, http.StatusForbidden, problem.Forbidden, fmt.Sprintf("The %s can't %s this appointment", party, action))
+		return models.Appointment{}, false
+	}
+	if !transition.Leaves(appointment.Status) {
+		invalidTransition(w, r, action, appointment.Status)
+		return models.Appointment{}, false
+	}
+	now := time.Now()
+	if transition.AfterStart && now.Before(appointment.Start) {
+		problem.Write(w, r, http.StatusConflict, problem.InvalidTransition, fmt.Sprintf("An appointment can't be marked %s before it starts", action))
+		return models.Appointment{}, false
+	}
+
+	identity, _ := auth.FromContext(ctx)
+	moved, err := appointments.Transition(ctx, objectID, models.StatusChange{
+		From:   appointment.Status,
+		To:     transition.To,
+		At:     now,
+		By:     party,
+		UserID: identity.UserID,
+		Reason: requestBody.Reason,
+	})
+	if err == store.ErrStatusChanged {
+		problem.Write(w, r, http.StatusConflict, problem.InvalidTransition, "The appointment changed meanwhile, try again")
+		return models.Appointment{}, false
+	}
+	if err != nil {
+		storeError(w, r, err, problem.AppointmentNotFound, "Appointment not found")
+		return models.Appointment{}, false
+	}
+
+	auditAction := models.AuditAppointmentMoved
+	if action == models.ActionCancel {
+		auditAction = models.AuditAppointmentCanceled
+	}
+	recordAudit(audit, r, auditAction, "appointment", appointment.ID.Hex(), appointment.Public(), moved.Public())
+	return moved, true
+}
+
+// invalidTransition replies that an action can't be taken on an appointment in its current status
+func invalidTransition(w http.ResponseWriter, r *http.Request, action, status string) {
+	problem.Write(w, r, http.StatusConflict, problem.InvalidTransition, fmt.Sprintf("Can't %s an appointment that is %s", action, status))
+}
+
+// replyMoved answers an action with the updated appointment
+func replyMoved(appointments store.AppointmentStore, audit store.AuditStore, action string, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	moved, ok := moveAppointment(appointments, audit, action, w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(moved.Public())
+}
+
+// AcceptAppointment handles POST requests by the technician of a requested appointment to accept it
+func AcceptAppointment(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	replyMoved(appointments, audit, models.ActionAccept, w, r)
+}
+
+// RejectAppointment handles POST requests by the technician of a requested appointment to reject it
+func RejectAppointment(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	replyMoved(appointments, audit, models.ActionReject, w, r)
+}
+
+// StartAppointment handles POST requests by the technician of an accepted appointment to start working on it
+func StartAppointment(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	replyMoved(appointments, audit, models.ActionStart, w, r)
+}
+
+// CompleteAppointment handles POST requests by the technician of an appointment in progress to complete it, and
+// counts it as a service done by its client and technician
+func CompleteAppointment(appointments store.AppointmentStore, users store.UserStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	moved, ok := moveAppointment(appointments, audit, models.ActionComplete, w, r)
+	if !ok {
+		return
+	}
+	if err := lifecycle.CountDone(r.Context(), users, appointments, moved); err != nil {
+		// The appointment is completed either way, and the background scheduler counts it later
+		slog.ErrorContext(r.Context(), "Failed to count a completed appointment", "appointment_id", moved.ID.Hex(), "error", err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(moved.Public())
+}
+
+// CancelAppointment handles POST requests by the client or the technician of an appointment to cancel it
+func CancelAppointment(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	replyMoved(appointments, audit, models.ActionCancel, w, r)
+}
+
+// NoShowAppointment handles POST requests by the technician of an accepted appointment to report the client
+// didn't show up
+func NoShowAppointment(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+	replyMoved(appointments, audit, models.ActionNoShow, w, r)
+}
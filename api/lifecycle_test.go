@@ -0,0 +1,188 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"PSbackend/auth"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// bookedID books an appointment with the technician of bookingStores and returns its ID
+func bookedID(t *testing.T, stores store.Stores, start, end string) primitive.ObjectID {
+	t.Helper()
+	w := book(stores, "tech@example.com", start, end)
+	var body struct {
+		Result insertResult `json:"result"`
+	}
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	return body.Result.InsertedID
+}
+
+// move takes an action on an appointment as the user with the given email
+func move(t *testing.T, stores store.Stores, handler func(store.AppointmentStore, store.AuditStore, http.ResponseWriter, *http.Request), id primitive.ObjectID, email, reason string) *httptest.ResponseRecorder {
+	t.Helper()
+	user, err := stores.Users.FindByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload []byte
+	if reason != "" {
+		payload, _ = json.Marshal(map[string]string{"reason": reason})
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/mb/services/appointments/"+id.Hex(), bytes.NewReader(payload))
+	req = req.WithContext(auth.WithIdentity(req.Context(), auth.Identity{UserID: user.ID.Hex()}))
+	req = mux.SetURLVars(req, map[string]string{"id": id.Hex()})
+	w := httptest.NewRecorder()
+	handler(stores.Appointments, stores.Audit, w, req)
+	return w
+}
+
+// doneBy returns the services done by the user with the given email in the given role
+func doneBy(t *testing.T, stores store.Stores, email, role string) int {
+	t.Helper()
+	user, err := stores.Users.FindByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return servicesDone(user, role)
+}
+
+func TestAppointmentLifecycle(t *testing.T) {
+	stores := bookingStores(t)
+	id := bookedID(t, stores, "2030-06-03T10:00:00Z", "2030-06-03T11:00:00Z")
+	complete := func(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
+		CompleteAppointment(appointments, stores.Users, audit, w, r)
+	}
+
+	steps := []struct {
+		name    string
+		handler func(store.AppointmentStore, store.AuditStore, http.ResponseWriter, *http.Request)
+		email   string
+		status  int
+		code    problem.Code
+	}{
+		{"client accepts", AcceptAppointment, "client@example.com", http.StatusForbidden, problem.Forbidden},
+		{"tech starts a requested appointment", StartAppointment, "tech@example.com", http.StatusConflict, problem.InvalidTransition},
+		{"tech accepts", AcceptAppointment, "tech@example.com", http.StatusOK, ""},
+		{"tech accepts again", AcceptAppointment, "tech@example.com", http.StatusConflict, problem.InvalidTransition},
+		{"no-show before the start", NoShowAppointment, "tech@example.com", http.StatusConflict, problem.InvalidTransition},
+		{"other tech starts", StartAppointment, "blocked@example.com", http.StatusForbidden, problem.Forbidden},
+		{"tech starts", StartAppointment, "tech@example.com", http.StatusOK, ""},
+		{"client cancels in progress", CancelAppointment, "client@example.com", http.StatusConflict, problem.InvalidTransition},
+		{"tech completes", complete, "tech@example.com", http.StatusOK, ""},
+		{"tech completes again", complete, "tech@example.com", http.StatusConflict, problem.InvalidTransition},
+	}
+	if doneBy(t, stores, "client@example.com", models.RoleClient) != 0 || doneBy(t, stores, "tech@example.com", models.RoleTech) != 0 {
+		t.Fatal("Expected booking not to count as a service done")
+	}
+	for _, step := range steps {
+		w := move(t, stores, step.handler, id, step.email, "")
+		var body problem.Problem
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != step.status || body.Code != step.code {
+			t.Fatalf("%s: expected %v %s, got %v %+v", step.name, step.status, step.code, w.Code, body)
+		}
+	}
+
+	appointment, _ := stores.Appointments.FindByID(context.Background(), id)
+	expected := []string{models.StatusRequested, models.StatusAccepted, models.StatusInProgress, models.StatusCompleted}
+	if appointment.Status != models.StatusCompleted || len(appointment.History) != len(expected) {
+		t.Fatalf("Expected a history through %v, got %s %+v", expected, appointment.Status, appointment.History)
+	}
+	for i, change := range appointment.History {
+		if change.To != expected[i] || change.At.IsZero() || change.UserID == "" {
+			t.Errorf("Unexpected change %d: %+v", i, change)
+		}
+	}
+	if appointment.History[1].By != models.ByProvider || appointment.History[1].From != models.StatusRequested {
+		t.Errorf("Expected the technician to accept, got %+v", appointment.History[1])
+	}
+	if doneBy(t, stores, "client@example.com", models.RoleClient) != 1 || doneBy(t, stores, "tech@example.com", models.RoleTech) != 1 {
+		t.Error("Expected the completion to count as a service done by the client and the technician")
+	}
+}
+
+func TestCancelAppointmentFreesTheSlot(t *testing.T) {
+	stores := bookingStores(t)
+	id := bookedID(t, stores, "2030-06-03T10:00:00Z", "2030-06-03T11:00:00Z")
+
+	w := move(t, stores, CancelAppointment, id, "client@example.com", "Fixed it myself")
+	var canceled models.PublicAppointment
+	json.NewDecoder(w.Body).Decode(&canceled)
+	if w.Code != http.StatusOK || canceled.Status != models.StatusCanceledByClient {
+		t.Fatalf("Expected the client to cancel, got %v %+v", w.Code, canceled)
+	}
+	if last := canceled.History[len(canceled.History)-1]; last.By != models.ByClient || last.Reason != "Fixed it myself" {
+		t.Errorf("Expected the reason in the history, got %+v", last)
+	}
+
+	bookedID(t, stores, "2030-06-03T10:00:00Z", "2030-06-03T11:00:00Z")
+	entries, _ := stores.Audit.Find(context.Background(), store.AuditQuery{Action: models.AuditAppointmentCanceled})
+	if len(entries) != 1 {
+		t.Errorf("Expected the cancellation to be audited, got %d entries", len(entries))
+	}
+}
+
+func TestUpcomingAndHistoryLists(t *testing.T) {
+	stores := bookingStores(t)
+	canceled := bookedID(t, stores, "2030-06-03T10:00:00Z", "2030-06-03T11:00:00Z")
+	early := bookedID(t, stores, "2030-06-03T11:00:00Z", "2030-06-03T12:00:00Z")
+	late := bookedID(t, stores, "2030-06-04T10:00:00Z", "2030-06-04T11:00:00Z")
+	move(t, stores, CancelAppointment, canceled, "client@example.com", "")
+
+	list := func(handler func(store.AppointmentStore, http.ResponseWriter, *http.Request), query string) (int, []primitive.ObjectID) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/bo/services/appointments?"+query, nil)
+		w := httptest.NewRecorder()
+		handler(stores.Appointments, w, req)
+		var body []models.PublicAppointment
+		json.NewDecoder(w.Body).Decode(&body)
+		var ids []primitive.ObjectID
+		for _, appointment := range body {
+			ids = append(ids, appointment.ID)
+		}
+		return w.Code, ids
+	}
+
+	if code, ids := list(GetUpcommingAppointments, ""); code != http.StatusOK || len(ids) != 2 || ids[0] != early || ids[1] != late {
+		t.Errorf("Expected the open appointments earliest first, got %v %v", code, ids)
+	}
+	if code, ids := list(GetUpcommingAppointments, "to=2030-06-04T00:00:00Z"); code != http.StatusOK || len(ids) != 1 || ids[0] != early {
+		t.Errorf("Expected the open appointments before to, got %v %v", code, ids)
+	}
+	if code, ids := list(GetHistoryAppointments, ""); code != http.StatusOK || len(ids) != 1 || ids[0] != canceled {
+		t.Errorf("Expected the canceled appointment in the history, got %v %v", code, ids)
+	}
+	if code, _ := list(GetHistoryAppointments, "from=2030-06-04T00:00:00Z&to=2030-06-03T00:00:00Z"); code != http.StatusBadRequest {
+		t.Errorf("Expected a period ending before it starts to be rejected, got %v", code)
+	}
+
+	// An accepted appointment that ended is no longer upcoming, and waits in the history for its technician's report
+	ended := primitive.NewObjectID()
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Minute)
+	err := stores.Appointments.Insert(context.Background(), models.Appointment{ID: ended, Status: models.StatusAccepted, Start: start, End: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ids := list(GetUpcommingAppointments, ""); slices.Contains(ids, ended) {
+		t.Errorf("Expected the ended appointment not to be upcoming, got %v", ids)
+	}
+	if code, ids := list(GetHistoryAppointments, ""); code != http.StatusOK || len(ids) != 2 || ids[0] != ended || ids[1] != canceled {
+		t.Errorf("Expected the ended appointment in the history, got %v %v", code, ids)
+	}
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxFailedLogins is how many wrong passwords or codes in a row lock an account
+	maxFailedLogins = 5
+	// lockoutPeriod is how long a locked account stays locked
+	lockoutPeriod = 15 * time.Minute
+)
+
+// rejectLocked replies with 423 and returns true when the account is locked
+func rejectLocked(w http.ResponseWriter, r *http.Request, user models.User) bool {
+	now := time.Now()
+	if !user.LockedUntil.After(now) {
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(user.LockedUntil.Sub(now).Seconds())+1))
+	problem.Write(w, r, http.StatusLocked, problem.AccountLocked, fmt.Sprintf("Account locked until %s", user.LockedUntil.Format(time.RFC3339)))
+	return true
+}
+
+// rejectDisabled replies with 403 and returns true when the account is deactivated
+func rejectDisabled(w http.ResponseWriter, r *http.Request, user models.User) bool {
+	if user.CanSignIn() {
+		return false
+	}
+	problem.Write(w, r, http.StatusForbidden, problem.AccountDisabled, "Account deactivated")
+	return true
+}
+
+// recordFailedLogin counts a failed attempt and locks the account once it reaches maxFailedLogins; the
+// count is kept even when the client hangs up, so disconnecting can't dodge the lockout
+func recordFailedLogin(ctx context.Context, users store.UserStore, user models.User) {
+	ctx, cancel := detach(ctx)
+	defer cancel()
+
+	updated, err := users.IncrementFailedLogins(ctx, user.ID)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to count a failed login", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+
+	if updated.FailedLogins < maxFailedLogins {
+		return
+	}
+
+	lock := store.Fields{"locked_until": time.Now().Add(lockoutPeriod), "failed_logins": 0}
+	_, err = users.Update(ctx, user.ID, lock)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to lock an account", "user_id", user.ID.Hex(), "error", err)
+	}
+}
+
+// clearFailedLogins resets the failed attempts of an account after a successful login
+func clearFailedLogins(ctx context.Context, users store.UserStore, user models.User) {
+	if user.FailedLogins == 0 {
+		return
+	}
+
+	_, err := users.Update(ctx, user.ID, store.Fields{"failed_logins": 0})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to clear failed logins", "user_id", user.ID.Hex(), "error", err)
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/models"
+	"net/http"
+)
+
+// ownsNIF reports whether the caller is the user with the given NIF or an admin
+func ownsNIF(r *http.Request, nif int64) bool {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		return false
+	}
+	return int64(identity.NIF) == nif || identity.HasRole(models.RoleAdmin)
+}
+
+// ownsUser reports whether the caller is the given user or an admin
+func ownsUser(r *http.Request, user models.User) bool {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		return false
+	}
+	return identity.UserID == user.ID.Hex() || identity.HasRole(models.RoleAdmin)
+}
+
+// ownsService reports whether the caller is the technician offering the given service or an admin
+func ownsService(r *http.Request, service models.ServiceType) bool {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		return false
+	}
+	return (service.EmployeeID != "" && identity.UserID == service.EmployeeID) || identity.HasRole(models.RoleAdmin)
+}
+
+// partyOf tells whether the caller is the provider or the client of an appointment, or an admin; ok is
+// false when they're none of them
+func partyOf(r *http.Request, appointment models.Appointment) (string, bool) {
+	identity, ok := auth.FromContext(r.Context())
+	switch {
+	case !ok:
+		return "", false
+	case identity.UserID == appointment.Provider.ID.Hex():
+		return models.ByProvider, true
+	case identity.UserID == appointment.Client.ID.Hex():
+		return models.ByClient, true
+	case identity.HasRole(models.RoleAdmin):
+		return models.ByAdmin, true
+	}
+	return "", false
+}
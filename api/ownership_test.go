@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"PSbackend/auth"
+	"PSbackend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func requestAs(identity auth.Identity) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	return req.WithContext(auth.WithIdentity(req.Context(), identity))
+}
+
+func TestOwnership(t *testing.T) {
+	provider := models.User{ID: primitive.NewObjectID(), NIF: 123456789}
+	cli := models.User{ID: primitive.NewObjectID(), NIF: 210422113}
+	other := models.User{ID: primitive.NewObjectID(), NIF: 987654321}
+	appointment := models.Appointment{Provider: provider.Public(), Client: cli.Public()}
+
+	asClient := requestAs(auth.Identity{UserID: cli.ID.Hex(), NIF: cli.NIF, Roles: []string{models.RoleClient}})
+	asProvider := requestAs(auth.Identity{UserID: provider.ID.Hex(), NIF: provider.NIF, Roles: []string{models.RoleTech}})
+	asOther := requestAs(auth.Identity{UserID: other.ID.Hex(), NIF: other.NIF, Roles: []string{models.RoleClient, models.RoleTech}})
+	asAdmin := requestAs(auth.Identity{UserID: primitive.NewObjectID().Hex(), Roles: []string{models.RoleAdmin}})
+	anonymous := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	if !ownsNIF(asClient, int64(cli.NIF)) || ownsNIF(asOther, int64(cli.NIF)) || !ownsNIF(asAdmin, int64(cli.NIF)) || ownsNIF(anonymous, int64(cli.NIF)) {
+		t.Error("ownsNIF didn't restrict access to the owner and admins")
+	}
+	if !ownsUser(asClient, cli) || ownsUser(asOther, cli) || !ownsUser(asAdmin, cli) {
+		t.Error("ownsUser didn't restrict access to the owner and admins")
+	}
+	service := models.ServiceType{EmployeeID: provider.ID.Hex()}
+	if !ownsService(asProvider, service) || ownsService(asOther, service) || !ownsService(asAdmin, service) || ownsService(asOther, models.ServiceType{}) {
+		t.Error("ownsService didn't restrict access to the technician offering it and admins")
+	}
+	parties := map[*http.Request]string{asClient: models.ByClient, asProvider: models.ByProvider, asAdmin: models.ByAdmin, asOther: "", anonymous: ""}
+	for req, expected := range parties {
+		if party, ok := partyOf(req, appointment); party != expected || ok != (expected != "") {
+			t.Errorf("partyOf returned %q, %v; expected %q", party, ok, expected)
+		}
+	}
+}
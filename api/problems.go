@@ -0,0 +1,71 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+// messageResponse is the body of the responses that only confirm an action
+type messageResponse struct {
+	Message string `json:"message"`
+}
+
+// invalidPayload replies that the request body couldn't be decoded
+func invalidPayload(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusBadRequest, problem.InvalidPayload, "Invalid request payload")
+}
+
+// invalidField replies that one field of the request is missing or malformed
+func invalidField(w http.ResponseWriter, r *http.Request, field, message string) {
+	problem.Write(w, r, http.StatusBadRequest, problem.InvalidField, message, problem.FieldError{Field: field, Message: message})
+}
+
+// statusClientClosedRequest is logged for the requests whose client went away before the reply
+const statusClientClosedRequest = 499
+
+// internalError logs err and replies with a 500 that doesn't leak it, or with a 503 when it happened
+// because the route ran out of time
+func internalError(w http.ResponseWriter, r *http.Request, err error) {
+	switch r.Context().Err() {
+	case context.DeadlineExceeded:
+		slog.WarnContext(r.Context(), "Request timed out", "error", err)
+		problem.Write(w, r, http.StatusServiceUnavailable, problem.Timeout, "The request took too long, try again later")
+		return
+	case context.Canceled:
+		slog.InfoContext(r.Context(), "Client went away before the reply", "error", err)
+		w.WriteHeader(statusClientClosedRequest)
+		return
+	}
+
+	slog.ErrorContext(r.Context(), "Failed to handle request", "error", err)
+	problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Something went wrong, try again later")
+}
+
+// storeError replies with a 404 of the given code when err is store.ErrNotFound and with a 500 otherwise
+func storeError(w http.ResponseWriter, r *http.Request, err error, code problem.Code, detail string) {
+	if err == store.ErrNotFound {
+		problem.Write(w, r, http.StatusNotFound, code, detail)
+		return
+	}
+	internalError(w, r, err)
+}
+
+// codeError replies to a verification code that was rejected by auth.CheckVerificationCode
+func codeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch err {
+	case auth.ErrNoCode:
+		problem.Write(w, r, http.StatusUnauthorized, problem.NoCode, "No verification code was requested")
+	case auth.ErrCodeExpired:
+		problem.Write(w, r, http.StatusUnauthorized, problem.CodeExpired, "Verification code expired")
+	case auth.ErrTooManyAttempts:
+		problem.Write(w, r, http.StatusTooManyRequests, problem.TooManyAttempts, "Too many attempts, request a new verification code")
+	case auth.ErrIncorrectCode:
+		problem.Write(w, r, http.StatusUnauthorized, problem.IncorrectCode, "Incorrect verification code")
+	default:
+		internalError(w, r, err)
+	}
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"PSbackend/problem"
+	"PSbackend/validate"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// detachedTimeout bounds the writes that outlive a request, see detach
+const detachedTimeout = 30 * time.Second
+
+// detach returns a context that keeps the values of ctx, such as the request ID, but isn't canceled with
+// the request, for writes that mustn't be skipped by hanging up, such as counting a failed login
+func detach(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), detachedTimeout)
+}
+
+// decodeBody decodes the JSON body of r into body and checks its validate tags, replying with every
+// invalid field at once; it returns false when it already replied
+func decodeBody(w http.ResponseWriter, r *http.Request, body interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(body)
+	if err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			invalidFields(w, r, validate.Errors{{Field: typeErr.Field, Message: "must be a " + jsonType(typeErr.Type)}})
+			return false
+		}
+		invalidPayload(w, r)
+		return false
+	}
+
+	return checkFields(w, r, body)
+}
+
+// decodeQuery copies the query parameters of r into the string fields of query named by their json tags
+// and checks its validate tags like decodeBody; it returns false when it already replied
+func decodeQuery(w http.ResponseWriter, r *http.Request, query interface{}) bool {
+	values := r.URL.Query()
+	fields := reflect.ValueOf(query).Elem()
+	for i := 0; i < fields.NumField(); i++ {
+		name, _, _ := strings.Cut(fields.Type().Field(i).Tag.Get("json"), ",")
+		if fields.Field(i).Kind() == reflect.String && values.Has(name) {
+			fields.Field(i).SetString(values.Get(name))
+		}
+	}
+	return checkFields(w, r, query)
+}
+
+// checkFields checks the validate tags of a decoded request, replying with every invalid field at once
+func checkFields(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := validate.Struct(v)
+	if err != nil {
+		var violations validate.Errors
+		if errors.As(err, &violations) {
+			invalidFields(w, r, violations)
+			return false
+		}
+		internalError(w, r, err)
+		return false
+	}
+	return true
+}
+
+// jsonType names a Go type the way clients know it from JSON
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Struct, reflect.Map:
+		return "object"
+	}
+	return t.Kind().String()
+}
+
+// invalidFields replies with a 400 listing every invalid field of the request
+func invalidFields(w http.ResponseWriter, r *http.Request, violations validate.Errors) {
+	fields := make([]problem.FieldError, len(violations))
+	names := make([]string, len(violations))
+	for i, violation := range violations {
+		fields[i] = problem.FieldError{Field: violation.Field, Message: violation.Message}
+		names[i] = violation.Field
+	}
+	problem.Write(w, r, http.StatusBadRequest, problem.InvalidField, "Invalid fields: "+strings.Join(names, ", "), fields...)
+}
+
+// parseTime reads a timestamp already checked by the datetime rule
+func parseTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339, value)
+	return t
+}
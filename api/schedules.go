@@ -0,0 +1,200 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/config"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"PSbackend/validate"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// scheduleOwner finds the technician named by the id path parameter, replying with an error unless the
+// caller is that technician or an admin; it returns false when it already replied
+func scheduleOwner(users store.UserStore, w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	objectID, err := primitive.ObjectIDFromHex(mux.Vars(r)["id"])
+	if err != nil {
+		invalidField(w, r, "id", "Invalid ID format")
+		return models.User{}, false
+	}
+
+	provider, err := users.FindByID(r.Context(), objectID)
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "Technician not found")
+		return models.User{}, false
+	}
+	if !isTechnician(provider) {
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "Technician not found")
+		return models.User{}, false
+	}
+	if !ownsUser(r, provider) {
+		auth.Forbidden(w, r)
+		return models.User{}, false
+	}
+	return provider, true
+}
+
+// saveSchedule stores the schedule of a technician and replies with it
+func saveSchedule(users store.UserStore, provider models.User, schedule models.Schedule, w http.ResponseWriter, r *http.Request) {
+	_, err := users.Update(r.Context(), provider.ID, store.Fields{"schedule": schedule})
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "Technician not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(schedule)
+}
+
+// repeatedDays lists the days of the week and the dates of the exceptions given more than once
+func repeatedDays(week []models.WorkingDay, exceptions []models.ScheduleException) validate.Errors {
+	var violations validate.Errors
+	days := map[string]bool{}
+	for i, day := range week {
+		if days[day.Day] {
+			violations = append(violations, validate.Violation{Field: fmt.Sprintf("week[%d].day", i), Message: "is given more than once"})
+		}
+		days[day.Day] = true
+	}
+	dates := map[string]bool{}
+	for i, exception := range exceptions {
+		if dates[exception.Date] {
+			violations = append(violations, validate.Violation{Field: fmt.Sprintf("exceptions[%d].date", i), Message: "is given more than once"})
+		}
+		dates[exception.Date] = true
+	}
+	return violations
+}
+
+// GetSchedule handles GET requests to get the working schedule of a technician; a technician without one
+// gets the schedule their workStart and workEnd amount to
+func GetSchedule(users store.UserStore, booking config.Booking, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	provider, ok := scheduleOwner(users, w, r)
+	if !ok {
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(provider.WorkingSchedule(booking.Zone))
+}
+
+// UpdateSchedule handles PUT requests to replace the time zone, week and exceptions of the schedule of a
+// technician, keeping their time off
+func UpdateSchedule(users store.UserStore, booking config.Booking, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var requestBody struct {
+		Zone       string                     `json:"zone" validate:"required,timezone"`
+		Week       []models.WorkingDay        `json:"week" validate:"max=7"`
+		Exceptions []models.ScheduleException `json:"exceptions" validate:"max=366"`
+	}
+
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+	if violations := repeatedDays(requestBody.Week, requestBody.Exceptions); len(violations) > 0 {
+		invalidFields(w, r, violations)
+		return
+	}
+
+	provider, ok := scheduleOwner(users, w, r)
+	if !ok {
+		return
+	}
+
+	schedule := models.Schedule{Zone: requestBody.Zone, Week: requestBody.Week, Exceptions: requestBody.Exceptions}
+	if provider.Schedule != nil {
+		schedule.TimeOff = provider.Schedule.TimeOff
+	}
+	saveSchedule(users, provider, schedule, w, r)
+}
+
+// DeleteSchedule handles DELETE requests to remove the schedule of a technician, who goes back to the
+// working hours of their workStart and workEnd
+func DeleteSchedule(users store.UserStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	provider, ok := scheduleOwner(users, w, r)
+	if !ok {
+		return
+	}
+
+	_, err := users.Update(r.Context(), provider.ID, store.Fields{"schedule": nil})
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "Technician not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(messageResponse{Message: "Schedule deleted successfully"})
+}
+
+// AddTimeOff handles POST requests to add a period of time off to the schedule of a technician; a
+// technician without a schedule gets the one their workStart and workEnd amount to
+func AddTimeOff(users store.UserStore, booking config.Booking, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	var requestBody struct {
+		Start  string `json:"start" validate:"required,datetime"`
+		End    string `json:"end" validate:"required,datetime,gtfield=start"`
+		Reason string `json:"reason" validate:"max=200"`
+	}
+
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+
+	provider, ok := scheduleOwner(users, w, r)
+	if !ok {
+		return
+	}
+
+	schedule := provider.WorkingSchedule(booking.Zone)
+	if len(schedule.TimeOff) >= 100 {
+		invalidField(w, r, "start", "must not add more than 100 periods of time off")
+		return
+	}
+	schedule.TimeOff = append(schedule.TimeOff, models.TimeOff{
+		ID:     primitive.NewObjectID(),
+		Start:  parseTime(requestBody.Start),
+		End:    parseTime(requestBody.End),
+		Reason: requestBody.Reason,
+	})
+	saveSchedule(users, provider, schedule, w, r)
+}
+
+// DeleteTimeOff handles DELETE requests to remove a period of time off from the schedule of a technician
+func DeleteTimeOff(users store.UserStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	timeOffID, err := primitive.ObjectIDFromHex(mux.Vars(r)["timeOffId"])
+	if err != nil {
+		invalidField(w, r, "timeOffId", "Invalid ID format")
+		return
+	}
+
+	provider, ok := scheduleOwner(users, w, r)
+	if !ok {
+		return
+	}
+
+	if provider.Schedule != nil {
+		schedule := *provider.Schedule
+		for i, off := range schedule.TimeOff {
+			if off.ID == timeOffID {
+				schedule.TimeOff = append(schedule.TimeOff[:i:i], schedule.TimeOff[i+1:]...)
+				saveSchedule(users, provider, schedule, w, r)
+				return
+			}
+		}
+	}
+	problem.Write(w, r, http.StatusNotFound, problem.TimeOffNotFound, "Time off not found")
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"PSbackend/auth"
+	"PSbackend/config"
+	"PSbackend/models"
+	"PSbackend/problem"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// scheduleRequest builds a request on the schedule of a technician made by identity
+func scheduleRequest(method string, vars map[string]string, identity auth.Identity, body interface{}) *http.Request {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, "/api/v1/mb/users/technicians/"+vars["id"]+"/schedule", bytes.NewBuffer(payload))
+	req = req.WithContext(auth.WithIdentity(req.Context(), identity))
+	return mux.SetURLVars(req, vars)
+}
+
+func TestSchedule(t *testing.T) {
+	stores := bookingStores(t)
+	booking := config.Booking{Granularity: 30 * time.Minute, Zone: time.UTC, MaxLength: 24 * time.Hour}
+	tech, _ := stores.Users.FindByEmail(context.Background(), "tech@example.com")
+	vars := map[string]string{"id": tech.ID.Hex()}
+	asTech := auth.Identity{UserID: tech.ID.Hex(), Roles: []string{models.RoleTech}}
+
+	// Mondays from 9 to 13, other days off
+	schedule := map[string]interface{}{
+		"zone": "UTC",
+		"week": []models.WorkingDay{{Day: "monday", Hours: []models.Interval{{Start: "09:00", End: "13:00"}}}},
+	}
+	w := httptest.NewRecorder()
+	UpdateSchedule(stores.Users, booking, w, scheduleRequest(http.MethodPut, vars, asTech, schedule))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	tests := map[string]struct {
+		start, end string
+		status     int
+	}{
+		"monday morning":   {"2030-06-03T10:00:00Z", "2030-06-03T11:00:00Z", http.StatusOK},
+		"monday afternoon": {"2030-06-03T14:00:00Z", "2030-06-03T15:00:00Z", http.StatusConflict},
+		"tuesday":          {"2030-06-04T10:00:00Z", "2030-06-04T11:00:00Z", http.StatusConflict},
+	}
+	for name, test := range tests {
+		if w := bookWith(stores, booking, "tech@example.com", test.start, test.end); w.Code != test.status {
+			t.Errorf("%s: expected status code %v, got %v. Response: %s", name, test.status, w.Code, w.Body.String())
+		}
+	}
+
+	// Time off keeps the next monday free
+	w = httptest.NewRecorder()
+	timeOff := map[string]string{"start": "2030-06-10T00:00:00Z", "end": "2030-06-11T00:00:00Z", "reason": "Holiday"}
+	AddTimeOff(stores.Users, booking, w, scheduleRequest(http.MethodPost, vars, asTech, timeOff))
+	var saved models.Schedule
+	json.NewDecoder(w.Body).Decode(&saved)
+	if w.Code != http.StatusOK || len(saved.TimeOff) != 1 || saved.Zone != "UTC" {
+		t.Fatalf("Expected the time off to be added, got %v %+v", w.Code, saved)
+	}
+	if w := bookWith(stores, booking, "tech@example.com", "2030-06-10T10:00:00Z", "2030-06-10T11:00:00Z"); w.Code != http.StatusConflict {
+		t.Errorf("Expected status code 409 during time off, got %v", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	offVars := map[string]string{"id": tech.ID.Hex(), "timeOffId": saved.TimeOff[0].ID.Hex()}
+	DeleteTimeOff(stores.Users, w, scheduleRequest(http.MethodDelete, offVars, asTech, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	if w := bookWith(stores, booking, "tech@example.com", "2030-06-10T10:00:00Z", "2030-06-10T11:00:00Z"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200 after removing the time off, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	// Without a schedule the technician goes back to workStart and workEnd
+	w = httptest.NewRecorder()
+	DeleteSchedule(stores.Users, w, scheduleRequest(http.MethodDelete, vars, asTech, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	if w := bookWith(stores, booking, "tech@example.com", "2030-06-04T10:00:00Z", "2030-06-04T11:00:00Z"); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200 within workStart and workEnd, got %v. Response: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestUpdateScheduleRejects(t *testing.T) {
+	stores := bookingStores(t)
+	tech, _ := stores.Users.FindByEmail(context.Background(), "tech@example.com")
+	vars := map[string]string{"id": tech.ID.Hex()}
+	asTech := auth.Identity{UserID: tech.ID.Hex(), Roles: []string{models.RoleTech}}
+	asOther := auth.Identity{UserID: primitive.NewObjectID().Hex(), Roles: []string{models.RoleTech}}
+	monday := models.WorkingDay{Day: "monday", Hours: []models.Interval{{Start: "09:00", End: "13:00"}}}
+
+	tests := map[string]struct {
+		identity auth.Identity
+		body     interface{}
+		status   int
+		fields   []string
+	}{
+		"repeated day":  {asTech, map[string]interface{}{"zone": "UTC", "week": []models.WorkingDay{monday, monday}}, http.StatusBadRequest, []string{"week[1].day"}},
+		"bad intervals": {asTech, map[string]interface{}{"zone": "Mars/Base", "week": []models.WorkingDay{{Day: "funday", Hours: []models.Interval{{Start: "13:00", End: "09:00"}}}}}, http.StatusBadRequest, []string{"zone", "week[0].day", "week[0].hours[0].end"}},
+		"not theirs":    {asOther, map[string]interface{}{"zone": "UTC"}, http.StatusForbidden, nil},
+	}
+	for name, test := range tests {
+		w := httptest.NewRecorder()
+		UpdateSchedule(stores.Users, config.Booking{}, w, scheduleRequest(http.MethodPut, vars, test.identity, test.body))
+		var body problem.Problem
+		json.NewDecoder(w.Body).Decode(&body)
+		if w.Code != test.status || len(body.Fields) != len(test.fields) {
+			t.Errorf("%s: expected %v with %v, got %v %+v", name, test.status, test.fields, w.Code, body)
+			continue
+		}
+		for i, field := range test.fields {
+			if body.Fields[i].Field != field {
+				t.Errorf("%s: expected %v, got %+v", name, test.fields, body.Fields)
+			}
+		}
+	}
+
+	user, _ := stores.Users.FindByID(context.Background(), tech.ID)
+	if user.Schedule != nil {
+		t.Errorf("Expected no schedule to be saved, got %+v", user.Schedule)
+	}
+}
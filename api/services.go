@@ -1,72 +1,54 @@
 package api
 
 import (
+	"PSbackend/auth"
+	"PSbackend/config"
+	"PSbackend/metrics"
 	"PSbackend/models"
-	"context"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"PSbackend/validate"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 // GetServices handles GET requests to get the list of services
-func GetServices(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+func GetServices(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var users []models.User
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var user models.User
-		cursor.Decode(&user)
-
-		users = append(users, user)
-
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(models.PublicUsers(list))
 }
 
 // GetService handles GET requests to get one specific service
-func GetService(client *mongo.Client, dbName, serviceCollection string, w http.ResponseWriter, r *http.Request) {
+func GetService(services store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		ID primitive.ObjectID `json:"id"`
+		ID primitive.ObjectID `json:"id" validate:"required"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	var service models.ServiceType
-	collection := client.Database(dbName).Collection(serviceCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"_id": requestBody.ID}).Decode(&service)
+	ctx := r.Context()
+	service, err := services.FindByID(ctx, requestBody.ID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "Service not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.ServiceNotFound, "Service not found")
 		return
 	}
 
@@ -75,54 +57,45 @@ func GetService(client *mongo.Client, dbName, serviceCollection string, w http.R
 }
 
 // GetServiceType handles GET requests to get the filtered list of services by type
-func GetFilteredServiceType(client *mongo.Client, dbName, serviceCollection string, w http.ResponseWriter, r *http.Request) {
+func GetFilteredServiceType(services store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var services []models.ServiceType
 
 	var filter struct {
-		ServiceType string `json:"name"`
+		ServiceType string `json:"name" validate:"required,max=100"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&filter)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &filter) {
 		return
 	}
 
 	filter.ServiceType = strings.ToUpper(filter.ServiceType)
 
-	collection := client.Database(dbName).Collection(serviceCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{"name": filter.ServiceType})
-
+	ctx := r.Context()
+	list, err := services.ListByName(ctx, filter.ServiceType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var service models.ServiceType
-		cursor.Decode(&service)
-		services = append(services, service)
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(services)
+	json.NewEncoder(w).Encode(list)
 }
 
-// UpdateService handles PUT request to update one specific service
-func UpdateService(client *mongo.Client, dbName, serviceCollection string, w http.ResponseWriter, r *http.Request) {
+// UpdateService handles PUT request to update one specific service, by the technician offering it or an admin
+func UpdateService(services store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var service models.ServiceType
+	var service struct {
+		ID    primitive.ObjectID `json:"id" validate:"required"`
+		Name  string             `json:"name" validate:"max=100"`
+		Price float64            `json:"priceHour" validate:"gt=0"`
+	}
+
+	if !decodeBody(w, r, &service) {
+		return
+	}
 
-	json.NewDecoder(r.Body).Decode(&service)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(serviceCollection)
-	var updateFields bson.M = bson.M{}
+	ctx := r.Context()
+	updateFields := store.Fields{}
 
 	if service.Price != 0 {
 		updateFields["price"] = service.Price
@@ -133,349 +106,268 @@ func UpdateService(client *mongo.Client, dbName, serviceCollection string, w htt
 	}
 
 	if len(updateFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.NothingToUpdate, "No fields to update")
 		return
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": service.ID}, bson.M{"$set": updateFields}, options.Update().SetUpsert(true))
+	existing, err := services.FindByID(ctx, service.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.ServiceNotFound, "Service not found")
+		return
+	}
+	if !ownsService(r, existing) {
+		auth.Forbidden(w, r)
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		http.Error(w, "Service not found", http.StatusNotFound)
+	modified, err := services.Update(ctx, service.ID, updateFields)
+	if err != nil && err != store.ErrNotFound {
+		internalError(w, r, err)
+		return
+	}
+
+	if !modified {
+		problem.Write(w, r, http.StatusNotFound, problem.ServiceNotFound, "Service not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Service updated successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "Service updated successfully"})
 }
 
 // CreateServiceType handles POST requests to create a specific service type
-func CreateServiceType(client *mongo.Client, dbName, serviceTypeCollection string, w http.ResponseWriter, r *http.Request) {
+func CreateServiceType(serviceTypes store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var serviceType models.ServiceType
-	serviceType.Name = strings.ToUpper(serviceType.Name)
+	var requestBody struct {
+		Name  string  `json:"name" validate:"required,max=100"`
+		Price float64 `json:"priceHour" validate:"gt=0"`
+	}
 
-	json.NewDecoder(r.Body).Decode(&serviceType)
-	serviceType.ID = primitive.NewObjectID()
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(serviceTypeCollection)
+	serviceType := models.ServiceType{
+		ID:    primitive.NewObjectID(),
+		Name:  strings.ToUpper(requestBody.Name),
+		Price: requestBody.Price,
+	}
 
-	result, err := collection.InsertOne(ctx, serviceType)
+	ctx := r.Context()
+	err := serviceTypes.Insert(ctx, serviceType)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(insertResult{InsertedID: serviceType.ID})
 }
 
 // GetServiceType handles GET requests to get the list of service types
-func GetServiceType(client *mongo.Client, dbName, serviceTypeCollection string, w http.ResponseWriter, r *http.Request) {
+func GetServiceType(serviceTypes store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var servicesType []models.ServiceType
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(serviceTypeCollection)
-
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := serviceTypes.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var serviceType models.ServiceType
-		cursor.Decode(&serviceType)
-		servicesType = append(servicesType, serviceType)
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(servicesType)
+	json.NewEncoder(w).Encode(list)
 }
 
 // UpdateServiceType handles PUT request to update one specific service type
-func UpdateServiceType(client *mongo.Client, dbName, serviceTypeCollection string, w http.ResponseWriter, r *http.Request) {
+func UpdateServiceType(serviceTypes store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var serviceType models.ServiceType
+	var serviceType struct {
+		ID   primitive.ObjectID `json:"id" validate:"required"`
+		Name string             `json:"name" validate:"max=100"`
+	}
+
+	if !decodeBody(w, r, &serviceType) {
+		return
+	}
 
-	json.NewDecoder(r.Body).Decode(&serviceType)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(serviceTypeCollection)
-	var updateFields bson.M = bson.M{}
+	ctx := r.Context()
+	updateFields := store.Fields{}
 
 	if serviceType.Name != "" {
 		updateFields["name"] = strings.ToUpper(serviceType.Name)
 	}
 
 	if len(updateFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.NothingToUpdate, "No fields to update")
 		return
 	}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": serviceType.ID}, bson.M{"$set": updateFields}, options.Update().SetUpsert(true))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	modified, err := serviceTypes.Update(ctx, serviceType.ID, updateFields)
+	if err != nil && err != store.ErrNotFound {
+		internalError(w, r, err)
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		http.Error(w, "Service not found", http.StatusNotFound)
+	if !modified {
+		problem.Write(w, r, http.StatusNotFound, problem.ServiceNotFound, "Service not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Service updated successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "Service updated successfully"})
 }
 
 // DeleteServiceType handles DELETE request to delete a specific service type
-func DeleteServiceType(client *mongo.Client, dbName, serviceTypeCollection string, w http.ResponseWriter, r *http.Request) {
+func DeleteServiceType(serviceTypes store.ServiceTypeStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var requestBody struct {
-		ID primitive.ObjectID `json:"id"`
+		ID primitive.ObjectID `json:"id" validate:"required"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(serviceTypeCollection)
-
-	result, err := collection.DeleteOne(ctx, bson.M{"_id": requestBody.ID})
+	ctx := r.Context()
+	deleted, err := serviceTypes.Delete(ctx, requestBody.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.ServiceNotFound, "Service not found")
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		http.Error(w, "Service not found", http.StatusNotFound)
-		return
-	}
+	recordAudit(audit, r, models.AuditServiceTypeDeleted, "service_type", deleted.ID.Hex(), deleted, nil)
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Service deleted successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "Service deleted successfully"})
 }
 
 // GetServiceByTechnician handles GET requests to get one specific service
-func GetServiceByTechnician(client *mongo.Client, dbName, serviceCollection string, w http.ResponseWriter, r *http.Request) {
+func GetServiceByTechnician(services store.ServiceTypeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var services []models.ServiceType
 
 	var filter struct {
-		EmployeeID string `json:"employee_id"`
+		EmployeeID string `json:"employee_id" validate:"required"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&filter)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &filter) {
 		return
 	}
 
-	collection := client.Database(dbName).Collection(serviceCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{
-		"employee_id": filter.EmployeeID,
-	})
-
+	ctx := r.Context()
+	list, err := services.ListByEmployee(ctx, filter.EmployeeID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var service models.ServiceType
-		cursor.Decode(&service)
-		services = append(services, service)
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(services)
+	json.NewEncoder(w).Encode(list)
 }
 
-func InsertAppointment(client *mongo.Client, dbName, serviceCollection, userCollection, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func InsertAppointment(users store.UserStore, appointments store.AppointmentStore, booking config.Booking, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		ClientEmail   string `json:"client_email"`
-		ProviderEmail string `json:"provider_email"`
-		ServiceName   string `json:"service_name"`
-		Start         string `json:"start"`
-		End           string `json:"end"`
-		Phone         string `json:"phone"`
-		NIF           string `json:"nif"`
-		Locality      string `json:"locality"`
-		Notes         string `json:"notes"`
-		TotalPrice    string `json:"totalPrice"`
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		ClientEmail   string `json:"client_email" validate:"required,email"`
+		ProviderEmail string `json:"provider_email" validate:"required,email"`
+		ServiceName   string `json:"service_name" validate:"required,max=100"`
+		Start         string `json:"start" validate:"required,datetime"`
+		End           string `json:"end" validate:"required,datetime,gtfield=start"`
+		Phone         string `json:"phone" validate:"required,phone"`
+		NIF           string `json:"nif" validate:"required,nif"`
+		Locality      string `json:"locality" validate:"required,max=100"`
+		Notes         string `json:"notes" validate:"max=1000"`
+		TotalPrice    string `json:"totalPrice" validate:"required,number"`
+	}
+
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
 	requestBody.ServiceName = strings.ToUpper(requestBody.ServiceName)
 
-	var cli models.User
-
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.ClientEmail}).Decode(&cli)
+	ctx := r.Context()
+	cli, err := users.FindByEmail(ctx, requestBody.ClientEmail)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
-
-	var provider models.User
-
-	collection = client.Database(dbName).Collection(userCollection)
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.ProviderEmail}).Decode(&provider)
-	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !ownsUser(r, cli) {
+		auth.Forbidden(w, r)
 		return
 	}
 
-	start, err := time.Parse("2006-01-02T15:04:05.999-07:00", requestBody.Start)
+	provider, err := users.FindByEmail(ctx, requestBody.ProviderEmail)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
-	end, err := time.Parse("2006-01-02T15:04:05.999-07:00", requestBody.End)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	if !cli.IsActive || cli.BlockServices {
+		problem.Write(w, r, http.StatusForbidden, problem.Forbidden, "The client can't book appointments")
 		return
 	}
-
-	phone, err := strconv.Atoi(requestBody.Phone)
-	if err != nil {
-		http.Error(w, "Invalid Phone format", http.StatusBadRequest)
+	if !takesAppointments(provider) {
+		problem.Write(w, r, http.StatusConflict, problem.TechUnavailable, "The technician isn't taking appointments")
 		return
 	}
 
-	nif, err := strconv.Atoi(requestBody.NIF)
-	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
+	// The rules of the fields make sure they all parse
+	start := parseTime(requestBody.Start)
+	end := parseTime(requestBody.End)
+	// Every slot of an appointment is reserved on its own, so its length is bounded before anything else
+	if end.Sub(start) > booking.MaxLength {
+		invalidField(w, r, "end", fmt.Sprintf("must be at most %s after start", booking.MaxLength))
 		return
 	}
-
-	totalPrice, err := strconv.ParseFloat(requestBody.TotalPrice, 64)
-	if err != nil {
-		http.Error(w, "Invalid Total price format", http.StatusBadRequest)
+	if !withinWorkingHours(provider, start, end, booking) {
+		outsideWorkingHours(w, r, provider, booking)
 		return
 	}
+	phone, _ := validate.Phone(requestBody.Phone)
+	nif, _ := strconv.Atoi(requestBody.NIF)
+	totalPrice, _ := strconv.ParseFloat(requestBody.TotalPrice, 64)
 
 	var priceHour float64
 
 	for _, service := range provider.ServiceTypes {
-		if service.Name == strings.ToUpper(requestBody.ServiceName) {
+		if service.Name == requestBody.ServiceName {
 			priceHour = service.Price
 		}
 	}
 
 	appointment := models.Appointment{
 		ID:          primitive.NewObjectID(),
-		Provider:    provider,
-		Client:      cli,
-		Status:      "SCHEDULED",
+		Provider:    provider.Public(),
+		Client:      cli.Public(),
+		Status:      models.StatusRequested,
 		Start:       start,
 		End:         end,
-		Phone:       phone,
+		Phone:       models.Phone(phone),
 		NIF:         nif,
 		Locality:    requestBody.Locality,
 		Notes:       requestBody.Notes,
 		TotalPrice:  totalPrice,
 		PriceHour:   priceHour,
 		ServiceName: requestBody.ServiceName,
+		History:     []models.StatusChange{{To: models.StatusRequested, At: time.Now(), By: models.ByClient, UserID: cli.ID.Hex()}},
 	}
 
-	for _, service := range provider.ServiceTypes {
-		if service.Name == requestBody.ServiceName {
-			appointment.PriceHour = service.Price
-		}
-	}
-
-	collection = client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.InsertOne(ctx, appointment)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	var updateCli bson.M = bson.M{}
-	for i := range cli.Role {
-		if cli.Role[i].Name == "CLIENT" {
-			cli.Role[i].ServicesDone++
-		}
-	}
-
-	updateCli["role"] = cli.Role
-	var updateTech bson.M = bson.M{}
-	for i := range provider.Role {
-		if provider.Role[i].Name == "TECH" {
-			provider.Role[i].ServicesDone++
-		}
-	}
-
-	updateTech["role"] = provider.Role
-	collection = client.Database(dbName).Collection(userCollection)
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	update, err := collection.UpdateOne(ctx, bson.M{"email": cli.Email}, bson.M{"$set": updateCli})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if update.MatchedCount == 0 {
-		http.Error(w, "Client not found to update", http.StatusNotFound)
+	booked, err := appointments.Book(ctx, appointment, booking.Buffer)
+	if err == store.ErrSlotTaken {
+		slotTaken(w, r, booked)
 		return
 	}
-
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	update, err = collection.UpdateOne(ctx, bson.M{"email": provider.Email}, bson.M{"$set": bson.M{"role": provider.Role}})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if update.MatchedCount == 0 {
-		http.Error(w, "Provider not found to update", http.StatusNotFound)
+		internalError(w, r, err)
 		return
 	}
+	metrics.AppointmentsCreated.Inc()
 
 	jsonResponse := map[string]interface{}{
 		"message": "Appointment created successfully",
-		"result":  result,
+		"result":  insertResult{InsertedID: appointment.ID},
 	}
 
 	w.WriteHeader(http.StatusOK)
@@ -483,408 +375,217 @@ func InsertAppointment(client *mongo.Client, dbName, serviceCollection, userColl
 }
 
 // GetAppointments handles GET requests to get the list of appointments
-func GetAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var appointments []models.Appointment
 
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	listAppointments(appointments, store.AppointmentQuery{}, w, r)
+}
 
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// listAppointments replies with the appointments matching query that overlap the period given by the
+// optional from and to query parameters, earliest first
+func listAppointments(appointments store.AppointmentStore, query store.AppointmentQuery, w http.ResponseWriter, r *http.Request) {
+	var period struct {
+		From string `json:"from" validate:"datetime"`
+		To   string `json:"to" validate:"datetime,gtfield=from"`
+	}
+	if !decodeQuery(w, r, &period) {
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-		appointments = append(appointments, appointment)
+	if period.From != "" {
+		query.From = parseTime(period.From)
+	}
+	if period.To != "" {
+		query.To = parseTime(period.To)
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
-}
-
-// GetUpcommingAppointments handles GET requests to get the list of appointments
-func GetUpcommingAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	var appointments []models.Appointment
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
+	list, err := appointments.Find(r.Context(), query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.PublicAppointments(list))
+}
 
-		if time.Now().After(appointment.End) {
-			appointment.Status = "COMPLETED"
-			filter := bson.M{"_id": appointment.ID}
-			update := bson.M{"$set": bson.M{"status": "COMPLETED"}}
-			_, err := collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
+// upcoming matches the appointments that can still move and haven't ended yet
+func upcoming() store.AppointmentQuery {
+	return store.AppointmentQuery{Statuses: models.HoldingStatuses, From: time.Now()}
+}
 
-		if appointment.Status == "SCHEDULED" {
-			appointments = append(appointments, appointment)
-		}
-	}
+// history matches the appointments that can't move anymore or have ended, such as the accepted ones whose
+// technician hasn't reported how they went
+func history() store.AppointmentQuery {
+	return store.AppointmentQuery{Statuses: models.ClosedStatuses, Past: time.Now()}
+}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+// GetUpcommingAppointments handles GET requests to get the list of appointments
+func GetUpcommingAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	listAppointments(appointments, upcoming(), w, r)
 }
 
 // GetClientUpcommingAppointments handles GET requests to get the list of upcomming appointments of a client
-func GetClientUpcommingAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetClientUpcommingAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	vars := mux.Vars(r)
 	nif, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 	nifInt, err := strconv.Atoi(nif)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
-		return
-	}
-
-	appointments := make([]models.Appointment, 0)
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-
-		if time.Now().After(appointment.End) {
-			appointment.Status = "COMPLETED"
-			filter := bson.M{"_id": appointment.ID}
-			update := bson.M{"$set": bson.M{"status": "COMPLETED"}}
-			_, err := collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if appointment.Client.NIF == nifInt && appointment.Status == "SCHEDULED" {
-			appointments = append(appointments, appointment)
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+	query := upcoming()
+	query.ClientNIF = nifInt
+	listAppointments(appointments, query, w, r)
 }
 
 // GetTechUpcommingAppointments handles GET requests to get the list of upcomming appointments of a tech
-func GetTechUpcommingAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetTechUpcommingAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	vars := mux.Vars(r)
 	nif, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 	nifInt, err := strconv.Atoi(nif)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
-		return
-	}
-
-	appointments := make([]models.Appointment, 0)
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-
-		if time.Now().After(appointment.End) {
-			appointment.Status = "COMPLETED"
-			filter := bson.M{"_id": appointment.ID}
-			update := bson.M{"$set": bson.M{"status": "COMPLETED"}}
-			_, err := collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if appointment.Provider.NIF == nifInt && appointment.Status == "SCHEDULED" {
-			appointments = append(appointments, appointment)
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+	query := upcoming()
+	query.ProviderNIF = nifInt
+	listAppointments(appointments, query, w, r)
 }
 
 // GetClientHistoryAppointments handles GET requests to get the list of appointments of a client already CLOSED
-func GetClientHistoryAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetClientHistoryAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	vars := mux.Vars(r)
 	nif, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 	nifInt, err := strconv.Atoi(nif)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
-		return
-	}
-
-	appointments := make([]models.Appointment, 0)
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-
-		if time.Now().After(appointment.End) {
-			appointment.Status = "COMPLETED"
-			filter := bson.M{"_id": appointment.ID}
-			update := bson.M{"$set": bson.M{"status": "COMPLETED"}}
-			_, err := collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if appointment.Client.NIF == nifInt && appointment.Status == "COMPLETED" || appointment.Status == "CANCELED" {
-			appointments = append(appointments, appointment)
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+	query := history()
+	query.ClientNIF = nifInt
+	listAppointments(appointments, query, w, r)
 }
 
 // GetTechHistoryAppointments handles GET requests to get the list of appointments of a tech already closed
-func GetTechHistoryAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetTechHistoryAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	vars := mux.Vars(r)
 	nif, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 	nifInt, err := strconv.Atoi(nif)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
-		return
-	}
-
-	appointments := make([]models.Appointment, 0)
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
-	defer cursor.Close(ctx)
 
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-
-		if time.Now().After(appointment.End) {
-			appointment.Status = "COMPLETED"
-			filter := bson.M{"_id": appointment.ID}
-			update := bson.M{"$set": bson.M{"status": "COMPLETED"}}
-			_, err := collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if appointment.Provider.NIF == nifInt && appointment.Status == "COMPLETED" || appointment.Status == "CANCELED" {
-			appointments = append(appointments, appointment)
-		}
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+	query := history()
+	query.ProviderNIF = nifInt
+	listAppointments(appointments, query, w, r)
 }
 
 // GetHistoryAppointments handles GET requests to get the list of appointments already CLOSED
-func GetHistoryAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetHistoryAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	appointments := make([]models.Appointment, 0)
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-
-		if time.Now().After(appointment.End) {
-			appointment.Status = "COMPLETED"
-			filter := bson.M{"_id": appointment.ID}
-			update := bson.M{"$set": bson.M{"status": "COMPLETED"}}
-			_, err := collection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-		}
-
-		if appointment.Status == "COMPLETED" || appointment.Status == "CANCELED" {
-			appointments = append(appointments, appointment)
-		}
-
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+	listAppointments(appointments, history(), w, r)
 }
 
 // GetHistoryAppointments handles GET requests to get the list of appointments already CLOSED
-func GetAppointmentsByPrice(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetAppointmentsByPrice(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		ServiceType string  `json:"service_type"`
-		Max         float64 `json:"max"`
-		Min         float64 `json:"min"`
+		ServiceType string  `json:"service_type" validate:"required"`
+		Max         float64 `json:"max" validate:"min=0,gtefield=min"`
+		Min         float64 `json:"min" validate:"min=0"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	appointments := make([]models.Appointment, 0)
+	inRange := make([]models.Appointment, 0)
 
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := appointments.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
 
+	for _, appointment := range list {
 		if appointment.ServiceName == requestBody.ServiceType && appointment.TotalPrice >= requestBody.Min && appointment.TotalPrice <= requestBody.Max {
-			appointments = append(appointments, appointment)
+			inRange = append(inRange, appointment)
 		}
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(appointments)
+	json.NewEncoder(w).Encode(models.PublicAppointments(inRange))
+}
+
+// usersByServicePrice returns the users offering a service type in a price range, each with only that service
+func usersByServicePrice(list []models.User, serviceType string, min, max float64) []models.User {
+	resultUsers := make([]models.User, 0)
+	for _, user := range list {
+		temporaryUser := user
+		for _, service := range user.ServiceTypes {
+			if service.Name == serviceType && service.Price >= min && service.Price <= max {
+				temporaryUser.ServiceTypes = []models.ServiceType{service}
+				resultUsers = append(resultUsers, temporaryUser)
+			}
+		}
+	}
+	return resultUsers
 }
 
 // GetServicesByPrice handles GET requests to get the list of appointments already CLOSED
-func GetServicesByPrice(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+func GetServicesByPrice(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		ServiceType string  `json:"service_type"`
-		Max         float64 `json:"max"`
-		Min         float64 `json:"min"`
+		ServiceType string  `json:"service_type" validate:"required"`
+		Max         float64 `json:"max" validate:"min=0,gtefield=min"`
+		Min         float64 `json:"min" validate:"min=0"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var temporaryUser models.User
-	resultUsers := make([]models.User, 0)
-	for cursor.Next(ctx) {
-		var user models.User
-		cursor.Decode(&user)
-		temporaryUser = user
 
-		for _, service := range user.ServiceTypes {
-			if service.Name == requestBody.ServiceType && service.Price >= requestBody.Min && service.Price <= requestBody.Max {
-				temporaryUser.ServiceTypes = []models.ServiceType{}
-				temporaryUser.ServiceTypes = append(temporaryUser.ServiceTypes, service)
-				resultUsers = append(resultUsers, temporaryUser)
-			}
-		}
-	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resultUsers)
+	json.NewEncoder(w).Encode(models.PublicUsers(usersByServicePrice(list, requestBody.ServiceType, requestBody.Min, requestBody.Max)))
 }
 
 // GetServicesByPrice handles GET requests to get the list of appointments already CLOSED
-func GetServicesByPriceQuery(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+func GetServicesByPriceQuery(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	serviceType := r.URL.Query().Get("service_type")
@@ -893,106 +594,53 @@ func GetServicesByPriceQuery(client *mongo.Client, dbName, userCollection string
 
 	min, err := strconv.ParseFloat(minStr, 64)
 	if err != nil {
-		http.Error(w, "Invalid min value", http.StatusBadRequest)
+		invalidField(w, r, "min", "Invalid min value")
 		return
 	}
 
 	max, err := strconv.ParseFloat(maxStr, 64)
 	if err != nil {
-		http.Error(w, "Invalid max value", http.StatusBadRequest)
+		invalidField(w, r, "max", "Invalid max value")
 		return
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var temporaryUser models.User
-	resultUsers := make([]models.User, 0)
-	for cursor.Next(ctx) {
-		var user models.User
-		cursor.Decode(&user)
-		temporaryUser = user
 
-		for _, service := range user.ServiceTypes {
-			if service.Name == serviceType && service.Price >= min && service.Price <= max {
-				temporaryUser.ServiceTypes = []models.ServiceType{}
-				temporaryUser.ServiceTypes = append(temporaryUser.ServiceTypes, service)
-				resultUsers = append(resultUsers, temporaryUser)
-			}
-		}
-	}
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resultUsers)
+	json.NewEncoder(w).Encode(models.PublicUsers(usersByServicePrice(list, serviceType, min, max)))
 }
 
-func DeleteAppointment(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+// DeleteAppointment handles DELETE requests to cancel an appointment, like CancelAppointment
+func DeleteAppointment(appointments store.AppointmentStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	vars := mux.Vars(r)
-	id, exists := vars["id"]
-	if !exists {
-		http.Error(w, "ID is required", http.StatusBadRequest)
-		return
-	}
-	objectID, err := primitive.ObjectIDFromHex(id)
-	if err != nil {
-		http.Error(w, "Invalid ID format", http.StatusBadRequest)
-		return
-	}
-
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	update := bson.M{"$set": bson.M{"status": "CANCELED"}}
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID}, update)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if result.MatchedCount == 0 {
-		http.Error(w, "Appointment not found", http.StatusNotFound)
+	if _, ok := moveAppointment(appointments, audit, models.ActionCancel, w, r); !ok {
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Appointment canceled successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "Appointment canceled successfully"})
 }
 
 // GetAppointments handles GET requests to get the list of appointments
-func GetCountAppointments(client *mongo.Client, dbName, appointmentCollection string, w http.ResponseWriter, r *http.Request) {
+func GetCountAppointments(appointments store.AppointmentStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	collection := client.Database(dbName).Collection(appointmentCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := appointments.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var total int
-
-	for cursor.Next(ctx) {
-		var appointment models.Appointment
-		cursor.Decode(&appointment)
-		total++
-	}
 
 	jsonResponse := map[string]interface{}{
 		"message": "Counted every existent Appointment",
-		"count":   total,
+		"count":   len(list),
 	}
 
 	w.WriteHeader(http.StatusOK)
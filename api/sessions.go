@@ -0,0 +1,197 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// startSession stores a new session for the user's device and returns an access token and a refresh token for it
+func startSession(ctx context.Context, sessions store.SessionStore, user models.User, device string) (string, string, error) {
+	refreshToken, tokenHash, err := auth.NewRefreshToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         primitive.NewObjectID(),
+		UserID:     user.ID,
+		Device:     device,
+		TokenHash:  tokenHash,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(auth.RefreshTokenTTL),
+	}
+
+	err = sessions.Insert(ctx, session)
+	if err != nil {
+		return "", "", err
+	}
+
+	accessToken, err := auth.IssueToken(user, session.ID.Hex())
+	if err != nil {
+		return "", "", err
+	}
+
+	return accessToken, refreshToken, nil
+}
+
+// deviceName identifies the device a session was started from
+func deviceName(device string, r *http.Request) string {
+	if device != "" {
+		return device
+	}
+	return r.UserAgent()
+}
+
+// RefreshToken handles POST requests to exchange a refresh token for a new access token and a new refresh token
+func RefreshToken(users store.UserStore, sessions store.SessionStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var requestBody struct {
+		RefreshToken string `json:"refresh_token" validate:"required"`
+	}
+
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+
+	tokenHash := auth.HashRefreshToken(requestBody.RefreshToken)
+	ctx := r.Context()
+
+	session, err := sessions.FindByTokenHash(ctx, tokenHash)
+	if err == store.ErrNotFound {
+		// A refresh token that was already rotated is being replayed, so it may have been stolen
+		session, err = sessions.FindByPreviousTokenHash(ctx, tokenHash)
+		if err == nil {
+			revokeCtx, cancel := detach(ctx)
+			defer cancel()
+			err = sessions.Revoke(revokeCtx, session.ID, session.UserID)
+			if err != nil {
+				slog.ErrorContext(ctx, "Failed to revoke a session after a refresh token replay", "session_id", session.ID.Hex(), "error", err)
+			}
+		}
+		problem.Write(w, r, http.StatusUnauthorized, problem.InvalidRefreshToken, "Invalid refresh token")
+		return
+	}
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	if session.Revoked || time.Now().After(session.ExpiresAt) {
+		problem.Write(w, r, http.StatusUnauthorized, problem.SessionExpired, "Session expired or revoked")
+		return
+	}
+
+	user, err := users.FindByID(ctx, session.UserID)
+	if err != nil {
+		if err == store.ErrNotFound {
+			problem.Write(w, r, http.StatusUnauthorized, problem.InvalidRefreshToken, "User not found")
+			return
+		}
+		internalError(w, r, err)
+		return
+	}
+
+	if rejectDisabled(w, r, user) {
+		return
+	}
+
+	refreshToken, newHash, err := auth.NewRefreshToken()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	// Matching on the current hash makes sure only one of two concurrent refreshes wins
+	now := time.Now()
+	rotated, err := sessions.Rotate(ctx, session.ID, tokenHash, newHash, now, now.Add(auth.RefreshTokenTTL))
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	if !rotated {
+		problem.Write(w, r, http.StatusUnauthorized, problem.InvalidRefreshToken, "Invalid refresh token")
+		return
+	}
+
+	accessToken, err := auth.IssueToken(user, session.ID.Hex())
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	jsonResponse := map[string]interface{}{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonResponse)
+}
+
+// Logout handles POST requests to revoke the session of the caller's access token
+func Logout(sessions store.SessionStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	identity, _ := auth.FromContext(r.Context())
+	sessionID, err := primitive.ObjectIDFromHex(identity.SessionID)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidToken, "Access token has no session")
+		return
+	}
+
+	userID, err := primitive.ObjectIDFromHex(identity.UserID)
+	if err != nil {
+		problem.Write(w, r, http.StatusBadRequest, problem.InvalidToken, "Access token has no user")
+		return
+	}
+
+	ctx := r.Context()
+	err = sessions.Revoke(ctx, sessionID, userID)
+	if err != nil {
+		storeError(w, r, err, problem.SessionNotFound, "Session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(messageResponse{Message: "Logged out successfully"})
+}
+
+// RevokeUserSessions handles DELETE requests to sign a user out of every device
+func RevokeUserSessions(users store.UserStore, sessions store.SessionStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var requestBody struct {
+		Email string `json:"email" validate:"required,email"`
+	}
+
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "User not found")
+		return
+	}
+
+	err = sessions.RevokeAll(ctx, user.ID)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(messageResponse{Message: "Sessions revoked successfully"})
+}
@@ -0,0 +1,162 @@
+package api
+
+import (
+	"PSbackend/auth"
+	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// findCaller loads the user of the caller's access token
+func findCaller(ctx context.Context, users store.UserStore, r *http.Request) (models.User, error) {
+	identity, _ := auth.FromContext(r.Context())
+	userID, err := primitive.ObjectIDFromHex(identity.UserID)
+	if err != nil {
+		return models.User{}, store.ErrNotFound
+	}
+	return users.FindByID(ctx, userID)
+}
+
+// checkSecondFactor validates the TOTP or recovery code of a login, consuming it so it can't be used again
+func checkSecondFactor(ctx context.Context, users store.UserStore, user models.User, otp, recoveryCode string) (bool, error) {
+	if otp != "" {
+		step, ok := auth.MatchTOTP(user.TwoFactor.Secret, otp, time.Now())
+		if !ok {
+			return false, nil
+		}
+		return users.AdvanceTOTPStep(ctx, user.ID, step)
+	}
+
+	if recoveryCode != "" {
+		return users.UseRecoveryCode(ctx, user.ID, auth.HashRecoveryCode(recoveryCode))
+	}
+
+	return false, nil
+}
+
+// passSecondFactor checks the TOTP or recovery code of a login for users with two-factor authentication
+// enabled, replying with an error and returning false when it's missing or wrong
+func passSecondFactor(ctx context.Context, users store.UserStore, user models.User, otp, recoveryCode string, w http.ResponseWriter, r *http.Request) bool {
+	if user.TwoFactor == nil || !user.TwoFactor.Enabled {
+		return true
+	}
+
+	if otp == "" && recoveryCode == "" {
+		problem.Write(w, r, http.StatusUnauthorized, problem.TwoFactorRequired, "Two-factor code required")
+		return false
+	}
+
+	ok, err := checkSecondFactor(ctx, users, user, otp, recoveryCode)
+	if err != nil {
+		internalError(w, r, err)
+		return false
+	}
+	if !ok {
+		recordFailedLogin(ctx, users, user)
+		problem.Write(w, r, http.StatusUnauthorized, problem.IncorrectTwoFactor, "Incorrect two-factor code")
+		return false
+	}
+	return true
+}
+
+// EnrollTwoFactor handles POST requests to start the TOTP enrollment of the calling admin
+func EnrollTwoFactor(users store.UserStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+	user, err := findCaller(ctx, users, r)
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "User not found")
+		return
+	}
+
+	if user.TwoFactor != nil && user.TwoFactor.Enabled {
+		problem.Write(w, r, http.StatusConflict, problem.TwoFactorEnabled, "Two-factor authentication is already enabled")
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	_, err = users.Update(ctx, user.ID, store.Fields{"two_factor": models.TwoFactor{Secret: secret}})
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	jsonResponse := map[string]interface{}{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(secret, user.Email),
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonResponse)
+}
+
+// ConfirmTwoFactor handles POST requests to enable TOTP with a first code from the authenticator app
+func ConfirmTwoFactor(users store.UserStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var requestBody struct {
+		Code string `json:"code" validate:"required,numeric,max=6"`
+	}
+
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := findCaller(ctx, users, r)
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "User not found")
+		return
+	}
+
+	if user.TwoFactor == nil {
+		problem.Write(w, r, http.StatusConflict, problem.TwoFactorNotStarted, "Two-factor enrollment wasn't started")
+		return
+	}
+	if user.TwoFactor.Enabled {
+		problem.Write(w, r, http.StatusConflict, problem.TwoFactorEnabled, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := auth.MatchTOTP(user.TwoFactor.Secret, requestBody.Code, time.Now())
+	if !ok {
+		problem.Write(w, r, http.StatusUnauthorized, problem.IncorrectTwoFactor, "Incorrect two-factor code")
+		return
+	}
+
+	codes, hashes, err := auth.NewRecoveryCodes()
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	enabled, err := users.EnableTwoFactor(ctx, user.ID, user.TwoFactor.Secret, step, hashes)
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	if !enabled {
+		problem.Write(w, r, http.StatusConflict, problem.TwoFactorChanged, "Two-factor enrollment changed, start it again")
+		return
+	}
+
+	jsonResponse := map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(jsonResponse)
+}
@@ -1,13 +1,18 @@
 package api
 
 import (
+	"PSbackend/auth"
+	"PSbackend/background"
+	"PSbackend/mailer"
+	"PSbackend/metrics"
 	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"PSbackend/validate"
 	"context"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
-	"log"
-	"math/rand"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -16,115 +21,99 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"github.com/signintech/gopdf"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func emailExists(email string, client *mongo.Client, dbName, userCollection string) bool {
+// insertResult keeps the shape of the responses that return the ID of a created document
+type insertResult struct {
+	InsertedID primitive.ObjectID
+}
+
+func emailExists(ctx context.Context, email string, users store.UserStore) bool {
 	// Check if the email exists in the database
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	_, err := users.FindByEmail(ctx, email)
+	return err == nil
+}
 
-	var existingUser struct {
-		Email string `bson:"email"`
+// codeMessage is the email that carries a verification code
+func codeMessage(email, code string) mailer.Message {
+	return mailer.Message{
+		ToName:    "Nuno Honório",
+		To:        email,
+		Subject:   fmt.Sprintf("Email Validation of FixFinder Code: %s", code),
+		PlainText: "Making it easier to find technicians for certain domestic services​",
+		HTML:      "<strong>Making it easier to find technicians for certain domestic services​</strong>",
 	}
-	err := collection.FindOne(ctx, bson.M{"email": email}).Decode(&existingUser)
-	return err == nil
 }
 
 // RecoveryEmail is responsible for sending an recovery email with a verification code to the user's email address
-func RecoveryEmail(w http.ResponseWriter, r *http.Request, mongo *mongo.Client, dbName, userCollection string) {
+func RecoveryEmail(w http.ResponseWriter, r *http.Request, users store.UserStore, mail mailer.Mailer) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Email string `json:"email"`
+		Email string `json:"email" validate:"required,email"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	if !emailExists(requestBody.Email, mongo, dbName, userCollection) {
-		http.Error(w, "Email isn't registered", http.StatusConflict)
+	ctx := r.Context()
+	if !emailExists(ctx, requestBody.Email, users) {
+		problem.Write(w, r, http.StatusConflict, problem.EmailNotRegistered, "Email isn't registered")
 		return
 	}
 
-	code := rand.Intn(8999) + 1000
-
-	collection := mongo.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.UpdateOne(ctx, bson.M{"email": requestBody.Email}, bson.M{"$set": bson.M{"recovery_code": code}}, options.Update().SetUpsert(true))
+	code, verification, err := auth.NewVerificationCode(time.Now())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if result.ModifiedCount == 0 && result.UpsertedID == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		internalError(w, r, err)
 		return
 	}
 
-	from := mail.NewEmail("FixFinder", os.Getenv("FIXFINDER_EMAIL"))
-	to := mail.NewEmail("Nuno Honório", requestBody.Email)
-	subject := fmt.Sprintf("Email Validation of FixFinder Code: %d", code)
-	plainTextContent := "Making it easier to find technicians for certain domestic services​"
-	htmlContent := "<strong>Making it easier to find technicians for certain domestic services​</strong>"
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_APIKEY"))
-	response, err := client.Send(message)
+	err = users.SetVerification(ctx, requestBody.Email, verification)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
-	if response.StatusCode >= 400 {
-		http.Error(w, fmt.Sprintf("Failed to send email, status code: %d", response.StatusCode), http.StatusInternalServerError)
+	err = mail.Send(ctx, codeMessage(requestBody.Email, code))
+	if err != nil {
+		internalError(w, r, err)
 		return
 	}
 
-	// Send the generated code back to the frontend in the response
-	jsonResponse := map[string]interface{}{
-		"message": "Verification email sent successfully",
-		"code":    code,
-	}
-
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(jsonResponse)
+	json.NewEncoder(w).Encode(messageResponse{Message: "Verification email sent successfully"})
 }
 
 // VerificateEmail is responsible for sending an email with a verification code to the user's email address
-func VerificateEmail(w http.ResponseWriter, r *http.Request, mongo *mongo.Client, dbName, userCollection string) {
+func VerificateEmail(w http.ResponseWriter, r *http.Request, users store.UserStore, mail mailer.Mailer) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Email string `json:"email"`
+		Email string `json:"email" validate:"required,email"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	if emailExists(requestBody.Email, mongo, dbName, userCollection) {
-		http.Error(w, "Email already registered", http.StatusConflict)
+	ctx := r.Context()
+	if emailExists(ctx, requestBody.Email, users) {
+		problem.Write(w, r, http.StatusConflict, problem.EmailRegistered, "Email already registered")
 		return
 	}
 
-	code := rand.Intn(8999) + 1000
+	code, verification, err := auth.NewVerificationCode(time.Now())
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
 
 	defaultUser := models.User{
 		Name:          "", // Default name
 		Password:      "", // Default password
 		NIF:           0,
-		Phone:         0,
+		Phone:         "",
 		Email:         requestBody.Email, // Use email from the request
 		Role:          []models.Role{},
 		ServiceTypes:  []models.ServiceType{},
@@ -133,214 +122,208 @@ func VerificateEmail(w http.ResponseWriter, r *http.Request, mongo *mongo.Client
 		BlockServices: false,
 		IsActive:      false,
 		CreatedAt:     time.Now(), // Default to current timestamp
-		RecoveryCode:  code,
+		Verification:  &verification,
 	}
 
-	collection := mongo.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.UpdateOne(ctx, bson.M{"email": requestBody.Email}, bson.M{"$set": defaultUser}, options.Update().SetUpsert(true))
+	err = users.UpsertByEmail(ctx, defaultUser)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 
-	if result.ModifiedCount == 0 && result.UpsertedID == nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	err = mail.Send(ctx, codeMessage(requestBody.Email, code))
+	if err != nil {
+		internalError(w, r, err)
 		return
 	}
 
-	from := mail.NewEmail("FixFinder", os.Getenv("FIXFINDER_EMAIL"))
-	to := mail.NewEmail("Nuno Honório", requestBody.Email)
-	subject := fmt.Sprintf("Email Validation of FixFinder Code: %d", code)
-	plainTextContent := "Making it easier to find technicians for certain domestic services​"
-	htmlContent := "<strong>Making it easier to find technicians for certain domestic services​</strong>"
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_APIKEY"))
-	response, err := client.Send(message)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(messageResponse{Message: "Verification email sent successfully"})
+}
+
+// Confirm the given code from user with the one saved in database, setting the password and signing the user
+// out of every session
+func ConfirmAuthCode(users store.UserStore, sessions store.SessionStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var requestBody struct {
+		Email    string `json:"email" validate:"required,email"`
+		Code     int    `json:"code" validate:"min=0,max=9999"`
+		Password string `json:"password" validate:"required,min=8,max=72"`
 	}
 
-	if response.StatusCode >= 400 {
-		http.Error(w, fmt.Sprintf("Failed to send email, status code: %d", response.StatusCode), http.StatusInternalServerError)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	// Send the generated code back to the frontend in the response
-	jsonResponse := map[string]interface{}{
-		"message": "Verification email sent successfully",
-		"code":    code,
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
+	if err != nil {
+		storeError(w, r, err, problem.UserNotFound, "User not found")
+		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(jsonResponse)
-}
+	if rejectLocked(w, r, user) {
+		return
+	}
 
-// Confirm the given code from user with the one saved in database
-func ConfirmAuthCode(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	var requestBody struct {
-		Email    string `json:"email"`
-		Code     int    `json:"code"`
-		Password string `json:"password"`
+	if user.Verification == nil {
+		codeError(w, r, auth.ErrNoCode)
+		return
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	// Count the attempt before checking the code so concurrent guesses can't exceed the limit
+	codeHash := user.Verification.Hash
+	user, err = users.CountCodeAttempt(ctx, requestBody.Email, codeHash)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		if err == store.ErrNotFound {
+			codeError(w, r, auth.ErrNoCode)
+			return
+		}
+		internalError(w, r, err)
 		return
 	}
 
-	var user models.User
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.Email}).Decode(&user)
+	err = auth.CheckVerificationCode(user.Verification, auth.FormatCode(requestBody.Code), time.Now())
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
+		if err == auth.ErrIncorrectCode {
+			recordFailedLogin(ctx, users, user)
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		codeError(w, r, err)
 		return
 	}
 
-	if user.RecoveryCode != requestBody.Code {
-		http.Error(w, "Incorrect email verification code", http.StatusUnauthorized)
+	hashedPassword, err := auth.HashPassword(requestBody.Password)
+	if err != nil {
+		internalError(w, r, err)
 		return
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.UpdateOne(ctx, bson.M{"email": requestBody.Email}, bson.M{"$set": bson.M{"password": requestBody.Password}}, options.Update().SetUpsert(true))
+	// Matching on the hash makes the code single use even when confirmed twice at once
+	err = users.ConsumeVerification(ctx, requestBody.Email, codeHash, hashedPassword)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		if err == store.ErrNotFound {
+			codeError(w, r, auth.ErrNoCode)
+			return
+		}
+		internalError(w, r, err)
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	// Whoever held the old password loses the sessions it opened
+	err = sessions.RevokeAll(ctx, user.ID)
+	if err != nil {
+		internalError(w, r, err)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Password reseted successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "Password reseted successfully"})
 }
 
 // GetUsers handles GET requests to get the list of users
-func GetUsers(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+func GetUsers(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var users []models.User
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var user models.User
-		cursor.Decode(&user)
-		users = append(users, user)
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(models.PublicUsers(list))
 }
 
 // GetUser handles GET requests to get one specific user by NIF
-func GetUser(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+func GetUser(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	vars := mux.Vars(r)
 	nifStr, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 
 	nif, err := strconv.ParseInt(nifStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
 
-	var user models.User
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	err = collection.FindOne(ctx, bson.M{"nif": nif}).Decode(&user)
+	ctx := r.Context()
+	user, err := users.FindByNIF(ctx, nif)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(user.Public())
 }
 
-// UpdateUser handles PUT request to update one specific user
-func UpdateUser(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// UpdateUser handles PUT request to update one specific user; only admins can change roles and service types,
+// which is audited
+func UpdateUser(users store.UserStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	vars := mux.Vars(r)
 
 	nifStr, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 
 	nif, err := strconv.ParseInt(nifStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
-
-	var requestBody struct {
-		Name         string               `json:"name" bson:"name"`
-		Password     string               `json:"password" bson:"password"`
-		Phone        string               `json:"phone" bson:"phone"`
-		Role         []models.Role        `json:"role" bson:"role"`
-		ServiceTypes []models.ServiceType `json:"service_types" bson:"service_types"`
-		Locality     string               `json:"locality" bson:"locality"`
-		WorkStart    string               `json:"workStart" bson:"workStart"`
-		WorkEnd      string               `json:"workEnd" bson:"workEnd"`
+	if _, err := validate.NIF(nif); err != nil {
+		invalidField(w, r, "nif", "NIF "+err.Error())
+		return
 	}
 
-	err = json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	var requestBody struct {
+		Name         string               `json:"name" validate:"max=100"`
+		Password     string               `json:"password" validate:"min=8,max=72"`
+		Phone        string               `json:"phone" validate:"phone"`
+		Role         []models.Role        `json:"role"`
+		ServiceTypes []models.ServiceType `json:"service_types"`
+		Locality     string               `json:"locality" validate:"max=100"`
+		WorkStart    string               `json:"workStart" validate:"datetime"`
+		WorkEnd      string               `json:"workEnd" validate:"datetime,gtfield=workStart"`
 	}
 
-	parsedPhone, err := strconv.ParseInt(requestBody.Phone, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid Phone format", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-	var updateFields bson.M = bson.M{}
+	updateFields := store.Fields{}
 	if requestBody.Name != "" {
 		updateFields["name"] = requestBody.Name
 	}
 	if requestBody.Password != "" {
-		updateFields["password"] = requestBody.Password
+		hashedPassword, err := auth.HashPassword(requestBody.Password)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+		updateFields["password"] = hashedPassword
 	}
-	if parsedPhone != 0 {
-		updateFields["phone"] = parsedPhone
+	if requestBody.Phone != "" {
+		// The phone rule already made sure it can be normalized
+		phone, _ := validate.Phone(requestBody.Phone)
+		updateFields["phone"] = phone
+	}
+	if len(requestBody.Role) > 0 || len(requestBody.ServiceTypes) > 0 {
+		identity, _ := auth.FromContext(r.Context())
+		if !identity.HasRole(models.RoleAdmin) {
+			problem.Write(w, r, http.StatusForbidden, problem.Forbidden, "Only admins can change roles and service types")
+			return
+		}
 	}
 	if len(requestBody.Role) > 0 {
 		updateFields["role"] = requestBody.Role
@@ -352,304 +335,329 @@ func UpdateUser(client *mongo.Client, dbName, userCollection string, w http.Resp
 		updateFields["locality"] = requestBody.Locality
 	}
 	if requestBody.WorkStart != "" {
-		start, err := time.Parse("2006-01-02T15:04:05.999-07:00", requestBody.WorkStart)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		updateFields["workStart"] = start
+		updateFields["workStart"] = parseTime(requestBody.WorkStart)
 	}
 	if requestBody.WorkEnd != "" {
-		end, err := time.Parse("2006-01-02T15:04:05.999-07:00", requestBody.WorkEnd)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		updateFields["workEnd"] = end
+		updateFields["workEnd"] = parseTime(requestBody.WorkEnd)
 	}
 
 	if len(updateFields) == 0 {
-		http.Error(w, "No fields to update", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusBadRequest, problem.NothingToUpdate, "No fields to update")
 		return
 	}
 
-	var user models.User
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	err = collection.FindOne(ctx, bson.M{"nif": nif}).Decode(&user)
+	ctx := r.Context()
+	user, err := users.FindByNIF(ctx, nif)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.UpdateOne(ctx, bson.M{"nif": nif}, bson.M{"$set": updateFields}, options.Update().SetUpsert(true))
+	modified, err := users.Update(ctx, user.ID, updateFields)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		http.Error(w, "User wasn't modified", http.StatusOK)
+	if !modified {
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(messageResponse{Message: "User wasn't modified"})
 		return
 	}
 
+	if len(requestBody.Role) > 0 || len(requestBody.ServiceTypes) > 0 {
+		changed := user
+		if len(requestBody.Role) > 0 {
+			changed.Role = requestBody.Role
+		}
+		if len(requestBody.ServiceTypes) > 0 {
+			changed.ServiceTypes = requestBody.ServiceTypes
+		}
+		recordAudit(audit, r, models.AuditUserRoleChanged, "user", user.ID.Hex(), user.Public(), changed.Public())
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("User updated successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "User updated successfully"})
 }
 
-// DeleteUser handles DELETE request to delete a specific user
-func DeleteUser(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// DeleteUser handles DELETE request to delete a specific user and revoke their sessions
+func DeleteUser(users store.UserStore, sessions store.SessionStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var requestBody struct {
-		NIF int64 `json:"nif"`
+		NIF int64 `json:"nif" validate:"required"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(userCollection)
+	if !ownsNIF(r, requestBody.NIF) {
+		auth.Forbidden(w, r)
+		return
+	}
 
-	result, err := collection.DeleteOne(ctx, bson.M{"nif": requestBody.NIF})
+	ctx := r.Context()
+	deleted, err := users.DeleteByNIF(ctx, requestBody.NIF)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
-	if result.DeletedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	err = sessions.RevokeAll(ctx, deleted.ID)
+	if err != nil {
+		internalError(w, r, err)
 		return
 	}
 
+	recordAudit(audit, r, models.AuditUserDeleted, "user", deleted.ID.Hex(), deleted.Public(), nil)
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("User deleted successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "User deleted successfully"})
+}
+
+// upgradePassword replaces a legacy plaintext password with its hash after a successful login
+func upgradePassword(ctx context.Context, users store.UserStore, user models.User, password string) {
+	if auth.IsHashed(user.Password) {
+		return
+	}
+
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to hash a legacy password", "user_id", user.ID.Hex(), "error", err)
+		return
+	}
+
+	err = users.ReplacePassword(ctx, user.ID, user.Password, hashedPassword)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to upgrade a legacy password", "user_id", user.ID.Hex(), "error", err)
+	}
 }
 
-func Login(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// Login handles POST requests to authenticate a user and issue an access token; users with two-factor
+// authentication enabled also give a TOTP or recovery code, as on the back office
+func Login(users store.UserStore, sessions store.SessionStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email        string `json:"email" validate:"required"`
+		Password     string `json:"password" validate:"required"`
+		Device       string `json:"device" validate:"max=200"`
+		OTP          string `json:"otp" validate:"numeric,max=6"`
+		RecoveryCode string `json:"recovery_code" validate:"max=32"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "User not found")
 		return
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
+	if rejectLocked(w, r, user) {
+		return
+	}
 
-	var user models.User
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.Email}).Decode(&user)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if !auth.CheckPassword(user.Password, requestBody.Password) {
+		recordFailedLogin(ctx, users, user)
+		problem.Write(w, r, http.StatusUnauthorized, problem.IncorrectPassword, "Incorrect password")
+		return
+	}
+
+	if rejectDisabled(w, r, user) {
 		return
 	}
 
-	if user.Password != requestBody.Password {
-		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+	if !passSecondFactor(ctx, users, user, requestBody.OTP, requestBody.RecoveryCode, w, r) {
 		return
 	}
 
+	clearFailedLogins(ctx, users, user)
+	upgradePassword(ctx, users, user, requestBody.Password)
+
+	token, refreshToken, err := startSession(ctx, sessions, user, deviceName(requestBody.Device, r))
+	if err != nil {
+		internalError(w, r, err)
+		return
+	}
+
+	jsonResponse := map[string]interface{}{
+		"token":         token,
+		"refresh_token": refreshToken,
+		"user":          user.Public(),
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(user)
+	json.NewEncoder(w).Encode(jsonResponse)
 }
 
-func LoginAdmin(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// LoginAdmin handles POST requests to authenticate an admin of the back office and issue an access token
+func LoginAdmin(users store.UserStore, sessions store.SessionStore, w http.ResponseWriter, r *http.Request) {
 	var isAdmin bool
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Email        string `json:"email" validate:"required"`
+		Password     string `json:"password" validate:"required"`
+		Device       string `json:"device" validate:"max=200"`
+		OTP          string `json:"otp" validate:"numeric,max=6"`
+		RecoveryCode string `json:"recovery_code" validate:"max=32"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-
-	var user models.User
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.Email}).Decode(&user)
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "User not found")
 		return
 	}
 
 	for _, role := range user.Role {
-		if role.Name == "ADMIN" {
+		if role.Name == models.RoleAdmin {
 			isAdmin = true
 		}
 	}
 
 	if !isAdmin {
-		http.Error(w, "User isn't admin", http.StatusUnauthorized)
+		problem.Write(w, r, http.StatusUnauthorized, problem.NotAdmin, "User isn't admin")
 		return
 	}
 
-	if user.Password != requestBody.Password {
-		http.Error(w, "Incorrect password", http.StatusUnauthorized)
+	if rejectLocked(w, r, user) {
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Login successful")
-}
+	if !auth.CheckPassword(user.Password, requestBody.Password) {
+		recordFailedLogin(ctx, users, user)
+		problem.Write(w, r, http.StatusUnauthorized, problem.IncorrectPassword, "Incorrect password")
+		return
+	}
 
-// CreateRole handles POST requests to create a new role
-func CreateRole(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	var role models.Role
+	if rejectDisabled(w, r, user) {
+		return
+	}
 
-	json.NewDecoder(r.Body).Decode(&role)
-	role.ID = primitive.NewObjectID()
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	collection := client.Database(dbName).Collection(userCollection)
+	if !passSecondFactor(ctx, users, user, requestBody.OTP, requestBody.RecoveryCode, w, r) {
+		return
+	}
+
+	clearFailedLogins(ctx, users, user)
+	upgradePassword(ctx, users, user, requestBody.Password)
 
-	result, err := collection.InsertOne(ctx, role)
+	token, refreshToken, err := startSession(ctx, sessions, user, deviceName(requestBody.Device, r))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 
+	jsonResponse := map[string]interface{}{
+		"message":       "Login successful",
+		"token":         token,
+		"refresh_token": refreshToken,
+	}
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(jsonResponse)
 }
 
-// GetTechnicians handles GET requests to get the list of technicians
-func GetTechnicians(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// CreateRole handles POST requests to create a new role
+func CreateRole(roles store.RoleStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
+	var requestBody struct {
+		Name string `json:"name" validate:"required,oneof=ADMIN TECH CLIENT"`
+	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
+
+	role := models.Role{ID: primitive.NewObjectID(), Name: requestBody.Name}
+	ctx := r.Context()
+
+	err := roles.Insert(ctx, role)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var users []models.User
-	for cursor.Next(ctx) {
-		var user models.User
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(insertResult{InsertedID: role.ID})
+}
 
-		cursor.Decode(&user)
+// usersWithRole returns the users that have the role with the given name
+func usersWithRole(list []models.User, name string) []models.User {
+	var users []models.User
+	for _, user := range list {
 		for _, role := range user.Role {
-			if role.Name == "TECH" {
+			if role.Name == name {
 				users = append(users, user)
 			}
 		}
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(users)
+	return users
 }
 
-// GetClients handles GET requests to get the list of clients
-func GetClients(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// GetTechnicians handles GET requests to get the list of technicians
+func GetTechnicians(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var users []models.User
-	for cursor.Next(ctx) {
-		var user models.User
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.PublicUsers(usersWithRole(list, "TECH")))
+}
 
-		cursor.Decode(&user)
-		for _, role := range user.Role {
-			if role.Name == "CLIENT" {
-				users = append(users, user)
-			}
-		}
+// GetClients handles GET requests to get the list of clients
+func GetClients(users store.UserStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	ctx := r.Context()
+	list, err := users.List(ctx)
+	if err != nil {
+		internalError(w, r, err)
+		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(models.PublicUsers(usersWithRole(list, "CLIENT")))
 }
 
-// UpdateUser handles PUT request to update one specific user
-func RegisterCompletion(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// RegisterCompletion handles PUT requests to finish the registration of a user, giving them their NIF; it
+// can only be done once, and a NIF only belongs to one user
+func RegisterCompletion(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var requestBody struct {
-		Email        string               `json:"email" bson:"email"`
-		Name         string               `json:"name" bson:"name"`
-		NIF          string               `json:"nif" bson:"nif"`
-		Phone        string               `json:"phone" bson:"phone"`
-		ServiceTypes []models.ServiceType `json:"service_types" bson:"service_types"`
-		Locality     string               `json:"locality" bson:"locality"`
-		WorkStart    string               `json:"workStart" bson:"workStart"`
-		WorkEnd      string               `json:"workEnd" bson:"workEnd"`
-	}
-
-	json.NewDecoder(r.Body).Decode(&requestBody)
-	if requestBody.Email == "" {
-		http.Error(w, "Email is required for update", http.StatusBadRequest)
-		return
-	}
-
-	collection := client.Database(dbName).Collection(userCollection)
-	if requestBody.Name == "" {
-		http.Error(w, "Name is required for registration", http.StatusBadRequest)
-		return
-	}
-	if requestBody.NIF == "" {
-		http.Error(w, "NIF is required for registration", http.StatusBadRequest)
-		return
-	}
-	if requestBody.Phone == "" {
-		http.Error(w, "Phone is required for registration", http.StatusBadRequest)
-		return
-	}
-	if requestBody.Locality == "" {
-		http.Error(w, "Locality is required for registration", http.StatusBadRequest)
-		return
+		Email        string               `json:"email" validate:"required,email"`
+		Name         string               `json:"name" validate:"required,max=100"`
+		NIF          string               `json:"nif" validate:"required,nif"`
+		Phone        string               `json:"phone" validate:"required,phone"`
+		ServiceTypes []models.ServiceType `json:"service_types"`
+		Locality     string               `json:"locality" validate:"required,max=100"`
+		WorkStart    string               `json:"workStart" validate:"required,datetime"`
+		WorkEnd      string               `json:"workEnd" validate:"required,datetime,gtfield=workStart"`
 	}
 
-	nif, err := strconv.Atoi(requestBody.NIF)
-	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	phone, err := strconv.Atoi(requestBody.Phone)
-	if err != nil {
-		http.Error(w, "Invalid Phone format", http.StatusBadRequest)
-		return
-	}
+	// The nif and phone rules already made sure both parse
+	nif, _ := strconv.Atoi(requestBody.NIF)
+	phone, _ := validate.Phone(requestBody.Phone)
 
-	var updateFields bson.M = bson.M{}
+	updateFields := store.Fields{}
 	updateFields["name"] = requestBody.Name
-	updateFields["nif"] = nif
 	updateFields["phone"] = phone
 	if len(requestBody.ServiceTypes) == 0 {
 		updateFields["role"] = []models.Role{
@@ -668,462 +676,371 @@ func RegisterCompletion(client *mongo.Client, dbName, userCollection string, w h
 		}
 	}
 
-	start, err := time.Parse("2006-01-02T15:04:05.999-07:00", requestBody.WorkStart)
+	updateFields["workStart"] = parseTime(requestBody.WorkStart)
+	updateFields["workEnd"] = parseTime(requestBody.WorkEnd)
+	updateFields["service_types"] = requestBody.ServiceTypes
+	updateFields["locality"] = requestBody.Locality
+	updateFields["is_active"] = true
+
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
-	updateFields["workStart"] = start
-	end, err := time.Parse("2006-01-02T15:04:05.999-07:00", requestBody.WorkEnd)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+
+	if !ownsUser(r, user) {
+		auth.Forbidden(w, r)
 		return
 	}
-	updateFields["workEnd"] = end
-	updateFields["service_types"] = requestBody.ServiceTypes
-	updateFields["locality"] = requestBody.Locality
-	updateFields["is_active"] = true
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
-	var updatedUser models.User
-	err = collection.FindOneAndUpdate(ctx, bson.M{"email": requestBody.Email}, bson.M{"$set": updateFields}, opts).Decode(&updatedUser)
+	user, err = users.CompleteRegistration(ctx, user.ID, nif, updateFields)
+	if err == store.ErrRegistered {
+		problem.Write(w, r, http.StatusConflict, problem.AlreadyRegistered, "The registration is already complete")
+		return
+	}
+	if err == store.ErrNIFTaken {
+		problem.Write(w, r, http.StatusConflict, problem.NIFRegistered, "NIF already registered")
+		return
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(updatedUser)
+	json.NewEncoder(w).Encode(user.Public())
 }
 
-func UpdateBlock(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// UpdateBlock handles PUT requests to toggle whether a user is blocked from services, signing a blocked user out
+func UpdateBlock(users store.UserStore, sessions store.SessionStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Email string `json:"email"`
+		Email string `json:"email" validate:"required,email"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	var user models.User
-
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.Email}).Decode(&user)
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
+	before := user.Public()
 	if !user.BlockServices {
 		user.BlockServices = true
 	} else {
 		user.BlockServices = false
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.UpdateOne(ctx, bson.M{"email": user.Email}, bson.M{"$set": user}, options.Update().SetUpsert(true))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	modified, err := users.Update(ctx, user.ID, store.Fields{"block_services": user.BlockServices})
+	if err != nil && err != store.ErrNotFound {
+		internalError(w, r, err)
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if !modified {
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "User not found")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("User updated successfully")
+	if user.BlockServices {
+		err = sessions.RevokeAll(ctx, user.ID)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
+	}
+
+	recordAudit(audit, r, models.AuditUserBlockChanged, "user", user.ID.Hex(), before, user.Public())
 
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(messageResponse{Message: "User updated successfully"})
 }
 
-func UpdateActive(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// UpdateActive handles PUT requests to toggle whether a user is active, signing a deactivated user out
+func UpdateActive(users store.UserStore, sessions store.SessionStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Email string `json:"email"`
+		Email string `json:"email" validate:"required,email"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	var user models.User
-
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	err = collection.FindOne(ctx, bson.M{"email": requestBody.Email}).Decode(&user)
+	ctx := r.Context()
+	user, err := users.FindByEmail(ctx, requestBody.Email)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
+	before := user.Public()
 	if !user.IsActive {
 		user.IsActive = true
 	} else {
 		user.IsActive = false
 	}
 
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.UpdateOne(ctx, bson.M{"email": user.Email}, bson.M{"$set": user}, options.Update().SetUpsert(true))
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	modified, err := users.Update(ctx, user.ID, store.Fields{"is_active": user.IsActive})
+	if err != nil && err != store.ErrNotFound {
+		internalError(w, r, err)
 		return
 	}
 
-	if result.ModifiedCount == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if !modified {
+		problem.Write(w, r, http.StatusNotFound, problem.UserNotFound, "User not found")
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("User updated successfully")
-
-}
-
-// GetTechnicians handles GET requests to get the list of technicians
-func OrderTechnicians(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	var requestBody struct {
-		Filter string `json:"filter"`
-	}
-
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
-		return
+	if !user.IsActive {
+		err = sessions.RevokeAll(ctx, user.ID)
+		if err != nil {
+			internalError(w, r, err)
+			return
+		}
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	defer cursor.Close(ctx)
+	recordAudit(audit, r, models.AuditUserActiveChanged, "user", user.ID.Hex(), before, user.Public())
 
-	var users []models.User
-	for cursor.Next(ctx) {
-		var user models.User
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(messageResponse{Message: "User updated successfully"})
+}
 
-		cursor.Decode(&user)
-		for _, role := range user.Role {
-			if role.Name == "TECH" {
-				users = append(users, user)
-			}
+// servicesDone returns how many services a user has done in the role with the given name
+func servicesDone(user models.User, name string) int {
+	for _, role := range user.Role {
+		if role.Name == name {
+			return role.ServicesDone
 		}
 	}
+	return 0
+}
 
-	if requestBody.Filter == "rating" {
+// orderUsers sorts users by rating or by the services done in the role with the given name
+func orderUsers(users []models.User, filter, name string) {
+	if filter == "rating" {
 		sort.Slice(users, func(i, j int) bool {
 			return users[i].Rating > users[j].Rating
 		})
 	}
-	if requestBody.Filter == "services" {
+	if filter == "services" {
 		sort.Slice(users, func(i, j int) bool {
-			var servicesDoneI, servicesDoneJ int
-
-			for _, role := range users[i].Role {
-				if role.Name == "TECH" {
-					servicesDoneI = role.ServicesDone
-					break
-				}
-			}
-
-			for _, role := range users[j].Role {
-				if role.Name == "TECH" {
-					servicesDoneJ = role.ServicesDone
-					break
-				}
-			}
-
-			return servicesDoneI > servicesDoneJ
+			return servicesDone(users[i], name) > servicesDone(users[j], name)
 		})
 	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(users)
 }
 
-// GetClients handles GET requests to get the list of clients
-func OrderClients(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+// GetTechnicians handles GET requests to get the list of technicians
+func OrderTechnicians(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		Filter string `json:"filter"`
+		Filter string `json:"filter" validate:"oneof=rating services"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var users []models.User
-	for cursor.Next(ctx) {
-		var user models.User
+	technicians := usersWithRole(list, "TECH")
+	orderUsers(technicians, requestBody.Filter, "TECH")
 
-		cursor.Decode(&user)
-		for _, role := range user.Role {
-			if role.Name == "CLIENT" {
-				users = append(users, user)
-			}
-		}
-	}
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(models.PublicUsers(technicians))
+}
 
-	if requestBody.Filter == "rating" {
-		sort.Slice(users, func(i, j int) bool {
-			return users[i].Rating > users[j].Rating
-		})
+// GetClients handles GET requests to get the list of clients
+func OrderClients(users store.UserStore, w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	var requestBody struct {
+		Filter string `json:"filter" validate:"oneof=rating services"`
 	}
-	if requestBody.Filter == "services" {
-		sort.Slice(users, func(i, j int) bool {
-			var servicesDoneI, servicesDoneJ int
 
-			for _, role := range users[i].Role {
-				if role.Name == "CLIENT" {
-					servicesDoneI = role.ServicesDone
-					break
-				}
-			}
-
-			for _, role := range users[j].Role {
-				if role.Name == "CLIENT" {
-					servicesDoneJ = role.ServicesDone
-					break
-				}
-			}
+	if !decodeBody(w, r, &requestBody) {
+		return
+	}
 
-			return servicesDoneI > servicesDoneJ
-		})
+	ctx := r.Context()
+	list, err := users.List(ctx)
+	if err != nil {
+		internalError(w, r, err)
+		return
 	}
 
+	clients := usersWithRole(list, "CLIENT")
+	orderUsers(clients, requestBody.Filter, "CLIENT")
+
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(users)
+	json.NewEncoder(w).Encode(models.PublicUsers(clients))
 }
 
 // GetUser handles GET requests to get one specific user by NIF
-func GetFeesByNif(client *mongo.Client, dbName, feesCollection string, w http.ResponseWriter, r *http.Request) {
+func GetFeesByNif(fees store.FeeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	vars := mux.Vars(r)
 
 	nifStr, exists := vars["nif"]
 	if !exists {
-		http.Error(w, "NIF is required", http.StatusBadRequest)
+		invalidField(w, r, "nif", "NIF is required")
 		return
 	}
 
 	nif, err := strconv.ParseInt(nifStr, 10, 64)
 	if err != nil {
-		http.Error(w, "Invalid NIF format", http.StatusBadRequest)
+		invalidField(w, r, "nif", "Invalid NIF format")
 		return
 	}
 
-	fees := make([]models.Fee, 0)
-
-	collection := client.Database(dbName).Collection(feesCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := fees.ListByNIF(ctx, nif)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	for cursor.Next(ctx) {
-		var fee models.Fee
-		cursor.Decode(&fee)
-		if fee.NIF == nif {
-			fees = append(fees, fee)
-		}
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(fees)
+	json.NewEncoder(w).Encode(list)
 }
 
 // GetUser handles GET requests to get one specific user by NIF
-func GetFees(client *mongo.Client, dbName, feesCollection string, w http.ResponseWriter, r *http.Request) {
+func GetFees(fees store.FeeStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	collection := client.Database(dbName).Collection(feesCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := fees.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
-
-	fees := make([]models.Fee, 0)
-
-	for cursor.Next(ctx) {
-		var fee models.Fee
-		cursor.Decode(&fee)
-		fees = append(fees, fee)
-	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(fees)
+	json.NewEncoder(w).Encode(list)
 }
 
-func CreateFee(client *mongo.Client, dbName, feesCollection string, userCollection string, w http.ResponseWriter, r *http.Request) {
+// CreateFee handles POST requests to charge a technician the fee of a period
+func CreateFee(fees store.FeeStore, users store.UserStore, audit store.AuditStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	var requestBody struct {
-		NIF   int     `json:"nif"`
-		Value float64 `json:"value"`
-		Day   string  `json:"day"`
-		Month string  `json:"month"`
-		Year  string  `json:"year"`
+		NIF   int     `json:"nif" validate:"required,nif"`
+		Value float64 `json:"value" validate:"required,gt=0"`
+		Day   string  `json:"day" validate:"required,numeric,max=2"`
+		Month string  `json:"month" validate:"required,max=20"`
+		Year  string  `json:"year" validate:"required,numeric,min=4,max=4"`
 	}
 
-	err := json.NewDecoder(r.Body).Decode(&requestBody)
-	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	if !decodeBody(w, r, &requestBody) {
 		return
 	}
 
-	var user models.User
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	err = collection.FindOne(ctx, bson.M{"nif": requestBody.NIF}).Decode(&user)
+	ctx := r.Context()
+	user, err := users.FindByNIF(ctx, int64(requestBody.NIF))
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		storeError(w, r, err, problem.UserNotFound, "User not found")
 		return
 	}
 
-	var servicesDone int
-
-	for _, role := range user.Role {
-		if role.Name == "TECH" {
-			servicesDone = role.ServicesDone
-		}
-	}
-
 	fee := models.Fee{
+		ID:       primitive.NewObjectID(),
 		NIF:      int64(requestBody.NIF),
 		Value:    requestBody.Value,
-		JobsDone: int64(servicesDone),
+		JobsDone: int64(servicesDone(user, "TECH")),
 		Paid:     false,
 		Day:      requestBody.Day,
 		Month:    requestBody.Month,
 		Year:     requestBody.Year,
 	}
 
-	collection = client.Database(dbName).Collection(feesCollection)
-	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	result, err := collection.InsertOne(ctx, fee)
+	err = fees.Insert(ctx, fee)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
+	recordAudit(audit, r, models.AuditFeeCreated, "fee", fee.ID.Hex(), nil, fee)
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(result)
+	json.NewEncoder(w).Encode(insertResult{InsertedID: fee.ID})
 }
 
-func PayFee(client *mongo.Client, dbName, feesCollection, userCollection string, w http.ResponseWriter, r *http.Request) {
+// PayFee handles PUT requests to mark a fee as paid and email its invoice, once
+func PayFee(fees store.FeeStore, users store.UserStore, audit store.AuditStore, mail mailer.Mailer, jobs *background.Group, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	vars := mux.Vars(r)
 	id, exists := vars["id"]
 	if !exists {
-		http.Error(w, "ID is required", http.StatusBadRequest)
+		invalidField(w, r, "id", "ID is required")
 		return
 	}
 	objectID, err := primitive.ObjectIDFromHex(id)
 	if err != nil {
-		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		invalidField(w, r, "id", "Invalid ID format")
 		return
 	}
 
-	collection := client.Database(dbName).Collection(feesCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	ctx := r.Context()
+	fee, err := fees.FindByID(ctx, objectID)
+	if err != nil {
+		storeError(w, r, err, problem.FeeNotFound, "Fee not found")
+		return
+	}
 
-	update := bson.M{"$set": bson.M{"paid": true}}
-	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetUpsert(true)
-	var updatedFee models.Fee
-	err = collection.FindOneAndUpdate(ctx, bson.M{"_id": objectID}, update, opts).Decode(&updatedFee)
+	if !ownsNIF(r, fee.NIF) {
+		auth.Forbidden(w, r)
+		return
+	}
+
+	updatedFee, err := fees.MarkPaid(ctx, objectID)
+	if err == store.ErrPaid {
+		problem.Write(w, r, http.StatusConflict, problem.FeePaid, "Fee already paid")
+		return
+	}
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			http.Error(w, "User not found", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		storeError(w, r, err, problem.FeeNotFound, "Fee not found")
 		return
 	}
 
-	generateInvoice(updatedFee, client, dbName, userCollection)
+	recordAudit(audit, r, models.AuditFeePaid, "fee", updatedFee.ID.Hex(), fee, updatedFee)
+
+	metrics.FeesPaid.Inc()
+
+	// The invoice is emailed after answering; shutdown waits for it
+	invoiceCtx := context.WithoutCancel(r.Context())
+	jobs.Go(func() { generateInvoice(invoiceCtx, updatedFee, users, mail) })
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode("Fee paid successfully")
+	json.NewEncoder(w).Encode(messageResponse{Message: "Fee paid successfully"})
 }
 
-func generateInvoice(invoice models.Fee, client *mongo.Client, dbName, userCollection string) {
-	var user models.User
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// Invoices are drawn with fontFile and written to invoiceDir, both relative to the working directory
+var (
+	invoiceDir = filepath.Join("api", "invoices")
+	fontFile   = filepath.Join("api", "fonts", "BebasNeue-Regular.ttf")
+)
+
+func generateInvoice(ctx context.Context, invoice models.Fee, users store.UserStore, mail mailer.Mailer) {
+	start := time.Now()
+	defer func() { metrics.InvoiceDuration.Observe(time.Since(start).Seconds()) }()
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
 	defer cancel()
 
-	err := collection.FindOne(ctx, bson.M{"nif": invoice.NIF}).Decode(&user)
+	user, err := users.FindByNIF(ctx, invoice.NIF)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			log.Print(err.Error())
-			return
-		}
-		log.Print(err.Error())
+		slog.ErrorContext(ctx, "Failed to find the technician of an invoice", "fee_id", invoice.ID.Hex(), "error", err)
 		return
 	}
 
@@ -1132,19 +1049,20 @@ func generateInvoice(invoice models.Fee, client *mongo.Client, dbName, userColle
 	pdf.AddPage()
 	currentDir, err := os.Getwd()
 	if err != nil {
-		log.Fatal(err)
+		slog.ErrorContext(ctx, "Failed to find the working directory", "fee_id", invoice.ID.Hex(), "error", err)
+		return
 	}
 
-	fontPath := filepath.Join(currentDir, "api", "fonts", "BebasNeue-Regular.ttf")
+	fontPath := filepath.Join(currentDir, fontFile)
 	err = pdf.AddTTFFont("BebasNeue-Regular", fontPath)
 	if err != nil {
-		log.Print(err.Error())
+		slog.ErrorContext(ctx, "Failed to load the invoice font", "fee_id", invoice.ID.Hex(), "error", err)
 		return
 	}
 
 	err = pdf.SetFont("BebasNeue-Regular", "", 14)
 	if err != nil {
-		log.Print(err.Error())
+		slog.ErrorContext(ctx, "Failed to set the invoice font", "fee_id", invoice.ID.Hex(), "error", err)
 		return
 	}
 
@@ -1153,7 +1071,7 @@ func generateInvoice(invoice models.Fee, client *mongo.Client, dbName, userColle
 	pdf.Br(20)
 	pdf.Cell(nil, "Address: Rua da Quinta das Flores, nº.23, Coimbra, 3040-100")
 	pdf.Br(20)
-	pdf.Cell(nil, fmt.Sprintf("Phone: %d | Email: %s", user.Phone, user.Email))
+	pdf.Cell(nil, fmt.Sprintf("Phone: %s | Email: %s", user.Phone, user.Email))
 	pdf.Br(20)
 	pdf.Cell(nil, "Website: www.fixfinder.com")
 	pdf.Br(20)
@@ -1219,70 +1137,49 @@ func generateInvoice(invoice models.Fee, client *mongo.Client, dbName, userColle
 	pdf.Cell(nil, fmt.Sprintf("Total: %.2f", invoice.Value))
 
 	pdfName := fmt.Sprintf("%s.pdf", invoice.ID.Hex())
-	pdfPath := filepath.Join(currentDir, "api", "invoices", pdfName)
-	pdf.WritePdf(pdfPath)
-
-	file, err := os.Open(pdfPath) // Replace with your invoice path
+	pdfPath := filepath.Join(currentDir, invoiceDir, pdfName)
+	err = pdf.WritePdf(pdfPath)
 	if err != nil {
-		log.Fatal(err)
-	}
-	defer file.Close()
-
-	fileInfo, err := file.Stat()
-	if err != nil {
-		log.Fatal(err)
+		slog.ErrorContext(ctx, "Failed to write the invoice", "fee_id", invoice.ID.Hex(), "path", pdfPath, "error", err)
+		return
 	}
 
-	fileContent := make([]byte, fileInfo.Size())
-	_, err = file.Read(fileContent)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	encodedFile := base64.StdEncoding.EncodeToString(fileContent)
-
-	attachment := mail.NewAttachment()
-	attachment.SetContent(encodedFile)
-	attachment.SetType("application/pdf")
-	attachment.SetFilename(pdfName)
-	attachment.SetDisposition("attachment")
-	from := mail.NewEmail("FixFinder", os.Getenv("FIXFINDER_EMAIL"))
-	to := mail.NewEmail("Provider", user.Email)
-	subject := fmt.Sprintf("FixFinder Invoice Fee %s, %s", invoice.Month, invoice.Year)
-	plainTextContent := "Making it easier to find technicians for certain domestic services​"
-	htmlContent := "<strong>Making it easier to find technicians for certain domestic services​</strong>"
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	message.AddAttachment(attachment)
-	sendgrid := sendgrid.NewSendClient(os.Getenv("SENDGRID_APIKEY"))
-	response, err := sendgrid.Send(message)
+	fileContent, err := os.ReadFile(pdfPath)
 	if err != nil {
-		log.Print(err.Error())
+		slog.ErrorContext(ctx, "Failed to read the invoice", "fee_id", invoice.ID.Hex(), "path", pdfPath, "error", err)
 		return
 	}
 
-	if response.StatusCode >= 400 {
-		log.Printf("Failed to send email, status code: %d", response.StatusCode)
+	message := mailer.Message{
+		ToName:    "Provider",
+		To:        user.Email,
+		Subject:   fmt.Sprintf("FixFinder Invoice Fee %s, %s", invoice.Month, invoice.Year),
+		PlainText: "Making it easier to find technicians for certain domestic services​",
+		HTML:      "<strong>Making it easier to find technicians for certain domestic services​</strong>",
+		Attachments: []mailer.Attachment{
+			{Filename: pdfName, Type: "application/pdf", Content: fileContent},
+		},
+	}
+	err = mail.Send(ctx, message)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to email the invoice", "fee_id", invoice.ID.Hex(), "error", err)
 		return
 	}
 }
 
 // GetUsers handles GET requests to get the list of users
-func GetServicesPerformed(client *mongo.Client, dbName, userCollection string, w http.ResponseWriter, r *http.Request) {
+func GetServicesPerformed(users store.UserStore, w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	collection := client.Database(dbName).Collection(userCollection)
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	cursor, err := collection.Find(ctx, bson.M{})
+	ctx := r.Context()
+	list, err := users.List(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		internalError(w, r, err)
 		return
 	}
-	defer cursor.Close(ctx)
+
 	var total int
-	for cursor.Next(ctx) {
-		var user models.User
-		cursor.Decode(&user)
+	for _, user := range list {
 		for _, role := range user.Role {
 			if role.Name == "TECH" {
 				total = total + role.ServicesDone
@@ -4,150 +4,523 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"log"
 	"net/http"
 	"net/http/httptest"
-	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
-	"PSbackend/config"
+	"PSbackend/auth"
+	"PSbackend/background"
+	"PSbackend/mailer"
+	"PSbackend/metrics"
 	"PSbackend/models"
+	"PSbackend/problem"
+	"PSbackend/store"
 
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-func setupRouter() *http.ServeMux {
-	router := http.NewServeMux()
-	ctx, _ := context.WithTimeout(context.Background(), time.Minute)
-	client, err := config.ConnectDB(ctx, os.Getenv("MONGO_URI"))
-	if err != nil {
-		log.Fatal("Error connecting to mongodb:", err)
+func setupRouter(t *testing.T) (*mux.Router, store.Stores, *mailer.Memory) {
+	t.Setenv("JWT_SECRET", "test-secret")
+	stores := store.NewMemoryStores()
+	mail := &mailer.Memory{}
+
+	router := mux.NewRouter()
+	router.Use(auth.Middleware(stores.Sessions))
+
+	router.HandleFunc("/api/v1/mb/users/register", func(w http.ResponseWriter, r *http.Request) {
+		VerificateEmail(w, r, stores.Users, mail)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/v1/mb/users/register-confirmation", func(w http.ResponseWriter, r *http.Request) {
+		ConfirmAuthCode(stores.Users, stores.Sessions, w, r)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/v1/mb/users/recovery", func(w http.ResponseWriter, r *http.Request) {
+		RecoveryEmail(w, r, stores.Users, mail)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/v1/mb/users/recovery-confirmation", func(w http.ResponseWriter, r *http.Request) {
+		ConfirmAuthCode(stores.Users, stores.Sessions, w, r)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/v1/mb/users/register-completion", func(w http.ResponseWriter, r *http.Request) {
+		RegisterCompletion(stores.Users, w, r)
+	}).Methods("PUT")
+
+	router.HandleFunc("/api/v1/mb/users/login", func(w http.ResponseWriter, r *http.Request) {
+		Login(stores.Users, stores.Sessions, w, r)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/v1/mb/users/token/refresh", func(w http.ResponseWriter, r *http.Request) {
+		RefreshToken(stores.Users, stores.Sessions, w, r)
+	}).Methods("POST")
+
+	router.HandleFunc("/api/v1/mb/users", func(w http.ResponseWriter, r *http.Request) {
+		GetUsers(stores.Users, w, r)
+	}).Methods("GET")
+
+	router.HandleFunc("/api/v1/mb/users", func(w http.ResponseWriter, r *http.Request) {
+		DeleteUser(stores.Users, stores.Sessions, stores.Audit, w, r)
+	}).Methods("DELETE")
+
+	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
+		GetUser(stores.Users, w, r)
+	}).Methods("GET")
+
+	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
+		UpdateUser(stores.Users, stores.Audit, w, r)
+	}).Methods("PUT")
+
+	return router, stores, mail
+}
+
+func serve(router *mux.Router, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(body)
+	req := httptest.NewRequest(method, path, bytes.NewBuffer(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
 	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
 
-	router.HandleFunc("/api/users", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == http.MethodGet {
-			GetUsers(client, "PSprojectTest", "Users", w, r)
-		} else if r.Method == http.MethodDelete {
-			DeleteUser(client, "PSprojectTest", "Users", w, r)
-		}
+// createUser registers a user through the verification email and returns an access token for it
+func createUser(t *testing.T, router *mux.Router, mail *mailer.Memory) string {
+	w := serve(router, http.MethodPost, "/api/v1/mb/users/register", "", map[string]interface{}{"email": "john@example.com"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	sent := mail.Sent()
+	if len(sent) != 1 || sent[0].To != "john@example.com" {
+		t.Fatalf("Expected one verification email to john@example.com, got %v", sent)
+	}
+	_, code, _ := strings.Cut(sent[0].Subject, "Code: ")
+	codeInt, _ := strconv.Atoi(code)
+
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/register-confirmation", "", map[string]interface{}{
+		"email":    "john@example.com",
+		"code":     codeInt,
+		"password": "password123",
 	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	token := login(t, router, "password123")
 
-	router.HandleFunc("/api/users/login", func(w http.ResponseWriter, r *http.Request) {
-		Login(client, "PSprojectTest", "Users", w, r)
+	w = serve(router, http.MethodPut, "/api/v1/mb/users/register-completion", token, map[string]interface{}{
+		"email":     "john@example.com",
+		"name":      "John Doe",
+		"nif":       "210422114",
+		"phone":     "912345678",
+		"locality":  "Coimbra",
+		"workStart": "2024-05-01T09:00:00.000+01:00",
+		"workEnd":   "2024-05-01T18:00:00.000+01:00",
 	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	// Log in again so the token carries the NIF given on completion
+	return login(t, router, "password123")
+}
 
-	router.HandleFunc("/api/users/phone", func(w http.ResponseWriter, r *http.Request) {
-		GetUser(client, "PSprojectTest", "Users", w, r)
+func login(t *testing.T, router *mux.Router, password string) string {
+	w := serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{
+		"email":    "john@example.com",
+		"password": password,
 	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
 
-	return router
+	var response struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	return response.Token
 }
 
 func TestCreateUser(t *testing.T) {
-	router := setupRouter()
-
-	user := models.User{
-		ID:       primitive.NewObjectID(),
-		Name:     "John Doe",
-		Password: "password123",
-		NIF:      210422113,
-		Phone:    1234567890,
-		Email:    "nuno.honorio2000@gmail.com",
-		Role: []models.Role{
-			{
-				Name: "Developer",
-			},
-		},
-		ServiceTypes: []models.ServiceType{
-			{
-				Name: "Developer",
-			},
-		},
-		Locality:      "Coimbra",
-		Rating:        4.5,
-		BlockServices: false,
-	}
-	userJSON, _ := json.Marshal(user)
+	router, stores, mail := setupRouter(t)
+	createUser(t, router, mail)
 
-	req := httptest.NewRequest(http.MethodPost, "/api/users", bytes.NewBuffer(userJSON))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	user, err := stores.Users.FindByEmail(context.Background(), "john@example.com")
+	if err != nil {
+		t.Fatalf("User wasn't stored: %v", err)
+	}
+	if user.Name != "John Doe" || user.NIF != 210422114 || user.Phone != "+351912345678" || !user.IsActive || user.Verification != nil {
+		t.Errorf("Registration wasn't completed: %+v", user)
+	}
+	if !auth.IsHashed(user.Password) {
+		t.Error("Password was stored in plaintext")
+	}
+}
 
-	router.ServeHTTP(w, req)
+func TestGetUsers(t *testing.T) {
+	router, _, mail := setupRouter(t)
+	token := createUser(t, router, mail)
 
+	w := serve(router, http.MethodGet, "/api/v1/mb/users", token, nil)
 	if w.Code != http.StatusOK {
 		t.Fatalf("Expected status code 200, got %v", w.Code)
 	}
+
+	var users []models.PublicUser
+	json.NewDecoder(w.Body).Decode(&users)
+	if len(users) != 1 || users[0].Email != "john@example.com" {
+		t.Errorf("Expected the registered user, got %v", users)
+	}
 }
 
-func TestGetUsers(t *testing.T) {
-	router := setupRouter()
+func TestGetUser(t *testing.T) {
+	router, _, mail := setupRouter(t)
+	token := createUser(t, router, mail)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
-	w := httptest.NewRecorder()
+	w := serve(router, http.MethodGet, "/api/v1/mb/users/210422114", token, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
 
-	router.ServeHTTP(w, req)
+	w = serve(router, http.MethodGet, "/api/v1/mb/users/123456789", token, nil)
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("Expected status code 404, got %v", w.Code)
+	}
 
-	if w.Code != http.StatusOK {
-		t.Fatalf("Expected status code 200, got %v", w.Code)
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Header().Get("Content-Type") != problem.ContentType || body.Code != problem.UserNotFound || body.Status != http.StatusNotFound {
+		t.Errorf("Expected a user_not_found problem, got %q %+v", w.Header().Get("Content-Type"), body)
 	}
 }
 
-func TestGetUser(t *testing.T) {
-	router := setupRouter()
+func TestLoginUser(t *testing.T) {
+	router, _, mail := setupRouter(t)
+	createUser(t, router, mail)
 
-	body := map[string]interface{}{
-		"phone": 1234567890,
+	w := serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{
+		"email":    "john@example.com",
+		"password": "wrong-password",
+	})
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status code 401, got %v", w.Code)
 	}
-	json, _ := json.Marshal(body)
 
-	req := httptest.NewRequest(http.MethodGet, "/api/users/phone", bytes.NewBuffer(json))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	if login(t, router, "password123") == "" {
+		t.Error("Login didn't return an access token")
+	}
+}
 
-	router.ServeHTTP(w, req)
+func TestDeleteUser(t *testing.T) {
+	router, stores, mail := setupRouter(t)
+	token := createUser(t, router, mail)
+
+	w := serve(router, http.MethodDelete, "/api/v1/mb/users", token, map[string]interface{}{"nif": 123456789})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status code 403, got %v", w.Code)
+	}
 
+	w = serve(router, http.MethodDelete, "/api/v1/mb/users", token, map[string]interface{}{"nif": 210422114})
 	if w.Code != http.StatusOK {
 		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
 	}
-}
 
-func TestLoginUser(t *testing.T) {
-	router := setupRouter()
+	_, err := stores.Users.FindByEmail(context.Background(), "john@example.com")
+	if err != store.ErrNotFound {
+		t.Errorf("Expected the user to be deleted, got %v", err)
+	}
 
-	loginData := map[string]interface{}{
-		"phone":    1234567890,
-		"password": "password123",
+	entries, _ := stores.Audit.Find(context.Background(), store.AuditQuery{})
+	if len(entries) != 1 || entries[0].Action != models.AuditUserDeleted {
+		t.Errorf("Expected one user deletion in the audit log, got %v", entries)
 	}
-	loginJSON, _ := json.Marshal(loginData)
 
-	req := httptest.NewRequest(http.MethodPost, "/api/users/login", bytes.NewBuffer(loginJSON))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	w = serve(router, http.MethodGet, "/api/v1/mb/users", token, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the sessions of the deleted user to be revoked, got %v. Response: %s", w.Code, w.Body.String())
+	}
+}
 
-	router.ServeHTTP(w, req)
+func TestPasswordResetRevokesSessions(t *testing.T) {
+	router, _, mail := setupRouter(t)
+	token := createUser(t, router, mail)
 
+	w := serve(router, http.MethodPost, "/api/v1/mb/users/recovery", "", map[string]interface{}{"email": "john@example.com"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	sent := mail.Sent()
+	_, code, _ := strings.Cut(sent[len(sent)-1].Subject, "Code: ")
+	codeInt, _ := strconv.Atoi(code)
+
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/recovery-confirmation", "", map[string]interface{}{
+		"email":    "john@example.com",
+		"code":     codeInt,
+		"password": "newpassword123",
+	})
 	if w.Code != http.StatusOK {
 		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
 	}
+
+	w = serve(router, http.MethodGet, "/api/v1/mb/users", token, nil)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the sessions opened before the reset to be revoked, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	login(t, router, "newpassword123")
 }
 
-func TestDeleteUser(t *testing.T) {
-	router := setupRouter()
+func TestRegisterCompletionValidation(t *testing.T) {
+	router, _, mail := setupRouter(t)
+	token := createUser(t, router, mail)
 
-	deleteData := map[string]interface{}{
-		"phone": 1234567890,
+	w := serve(router, http.MethodPut, "/api/v1/mb/users/register-completion", token, map[string]interface{}{
+		"email":     "john@example.com",
+		"nif":       "21042211A",
+		"workStart": "2024-05-01T09:00:00+01:00",
+		"workEnd":   "2024-05-01T08:00:00+01:00",
+	})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status code 400, got %v. Response: %s", w.Code, w.Body.String())
 	}
-	deleteJSON, _ := json.Marshal(deleteData)
 
-	req := httptest.NewRequest(http.MethodDelete, "/api/users", bytes.NewBuffer(deleteJSON))
-	req.Header.Set("Content-Type", "application/json")
-	w := httptest.NewRecorder()
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	var fields []string
+	for _, field := range body.Fields {
+		fields = append(fields, field.Field)
+	}
+	if body.Code != problem.InvalidField || strings.Join(fields, ",") != "name,nif,phone,locality,workEnd" {
+		t.Errorf("Expected every invalid field at once, got %+v", body)
+	}
+}
 
-	router.ServeHTTP(w, req)
+func TestUpdateUserRoleNeedsAdmin(t *testing.T) {
+	router, stores, mail := setupRouter(t)
+	token := createUser(t, router, mail)
+
+	w := serve(router, http.MethodPut, "/api/v1/mb/users/210422114", token, map[string]interface{}{
+		"role": []map[string]string{{"name": models.RoleAdmin}},
+	})
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("Expected status code 403, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	user, _ := stores.Users.FindByEmail(context.Background(), "john@example.com")
+	if len(user.Role) != 1 || user.Role[0].Name != models.RoleClient {
+		t.Errorf("Expected the client to keep their role, got %+v", user.Role)
+	}
 
+	w = serve(router, http.MethodPut, "/api/v1/mb/users/210422114", token, map[string]interface{}{"name": "John Smith"})
 	if w.Code != http.StatusOK {
-		t.Fatalf("Expected status code 200, got %v", w.Code)
+		t.Errorf("Expected the client to update their name, got %v. Response: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRegisterCompletionOnlyOnce(t *testing.T) {
+	router, stores, mail := setupRouter(t)
+	token := createUser(t, router, mail)
+
+	completion := map[string]interface{}{
+		"email":     "john@example.com",
+		"name":      "John Doe",
+		"nif":       "123456789",
+		"phone":     "912345678",
+		"locality":  "Coimbra",
+		"workStart": "2024-05-01T09:00:00.000+01:00",
+		"workEnd":   "2024-05-01T18:00:00.000+01:00",
+	}
+	w := serve(router, http.MethodPut, "/api/v1/mb/users/register-completion", token, completion)
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusConflict || body.Code != problem.AlreadyRegistered {
+		t.Fatalf("Expected a second completion to be refused, got %v %+v", w.Code, body)
+	}
+
+	// Another user can't take the NIF of the first one
+	password, _ := auth.HashPassword("password123")
+	stores.Users.UpsertByEmail(context.Background(), models.User{Email: "jane@example.com", Password: password})
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{"email": "jane@example.com", "password": "password123"})
+	var session struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(w.Body).Decode(&session)
+
+	completion["email"] = "jane@example.com"
+	completion["nif"] = "210422114"
+	w = serve(router, http.MethodPut, "/api/v1/mb/users/register-completion", session.Token, completion)
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusConflict || body.Code != problem.NIFRegistered {
+		t.Fatalf("Expected the NIF of another user to be refused, got %v %+v", w.Code, body)
+	}
+
+	jane, _ := stores.Users.FindByEmail(context.Background(), "jane@example.com")
+	if jane.NIF != 0 || jane.IsActive {
+		t.Errorf("Expected the refused completion to change nothing, got %+v", jane)
+	}
+}
+
+func TestDeactivatedUsersCantSignIn(t *testing.T) {
+	router, stores, mail := setupRouter(t)
+	createUser(t, router, mail)
+
+	w := serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{"email": "john@example.com", "password": "password123"})
+	var session struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	json.NewDecoder(w.Body).Decode(&session)
+
+	ctx := context.Background()
+	user, _ := stores.Users.FindByEmail(ctx, "john@example.com")
+
+	// Blocking closes the services, not the account
+	stores.Users.Update(ctx, user.ID, store.Fields{"block_services": true})
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{"email": "john@example.com", "password": "password123"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected a blocked user to log in, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	stores.Users.Update(ctx, user.ID, store.Fields{"is_active": false})
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{"email": "john@example.com", "password": "password123"})
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusForbidden || body.Code != problem.AccountDisabled {
+		t.Errorf("Expected login to be refused once deactivated, got %v %+v", w.Code, body)
+	}
+
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/token/refresh", "", map[string]interface{}{"refresh_token": session.RefreshToken})
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected refresh to be refused once deactivated, got %v. Response: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRevokedSessionTokensAreRefused(t *testing.T) {
+	router, stores, mail := setupRouter(t)
+	token := createUser(t, router, mail)
+
+	if w := serve(router, http.MethodGet, "/api/v1/mb/users", token, nil); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+
+	user, _ := stores.Users.FindByEmail(context.Background(), "john@example.com")
+	stores.Sessions.RevokeAll(context.Background(), user.ID)
+
+	w := serve(router, http.MethodGet, "/api/v1/mb/users", token, nil)
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusUnauthorized || body.Code != problem.SessionExpired {
+		t.Fatalf("Expected the access token of a revoked session to be refused, got %v %+v", w.Code, body)
+	}
+}
+
+func TestMobileLoginRequiresTwoFactor(t *testing.T) {
+	router, stores, mail := setupRouter(t)
+	createUser(t, router, mail)
+
+	secret, _ := auth.NewTOTPSecret()
+	user, _ := stores.Users.FindByEmail(context.Background(), "john@example.com")
+	stores.Users.Update(context.Background(), user.ID, store.Fields{"two_factor": models.TwoFactor{Secret: secret, Enabled: true}})
+
+	w := serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{"email": "john@example.com", "password": "password123"})
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusUnauthorized || body.Code != problem.TwoFactorRequired {
+		t.Fatalf("Expected the mobile login to ask for the second factor, got %v %+v", w.Code, body)
+	}
+
+	code, _ := auth.TOTPCode(secret, time.Now())
+	w = serve(router, http.MethodPost, "/api/v1/mb/users/login", "", map[string]interface{}{"email": "john@example.com", "password": "password123", "otp": code})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200 with the second factor, got %v. Response: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestResponsesHideCredentials(t *testing.T) {
+	stores := bookingStores(t)
+	ctx := context.Background()
+	secrets := []string{"$2a$10$password-hash", "TOTPSECRETBASE32", "recovery-code-hash", "verification-code-hash"}
+	for _, email := range []string{"client@example.com", "tech@example.com"} {
+		user, _ := stores.Users.FindByEmail(ctx, email)
+		user.Password = secrets[0]
+		user.TwoFactor = &models.TwoFactor{Secret: secrets[1], Enabled: true, RecoveryCodes: []string{secrets[2]}}
+		user.Verification = &models.VerificationCode{Hash: secrets[3], ExpiresAt: time.Now()}
+		if err := stores.Users.UpsertByEmail(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bookedID(t, stores, "2030-06-03T10:00:00Z", "2030-06-03T11:00:00Z")
+	client, _ := stores.Users.FindByEmail(ctx, "client@example.com")
+	if _, err := stores.Users.Update(ctx, client.ID, store.Fields{"nif": 210422113}); err != nil {
+		t.Fatal(err)
+	}
+
+	responses := map[string]func(w http.ResponseWriter, r *http.Request){
+		"user": func(w http.ResponseWriter, r *http.Request) {
+			GetUser(stores.Users, w, mux.SetURLVars(r, map[string]string{"nif": "210422113"}))
+		},
+		"users": func(w http.ResponseWriter, r *http.Request) {
+			GetUsers(stores.Users, w, r)
+		},
+		"appointments": func(w http.ResponseWriter, r *http.Request) {
+			GetAppointments(stores.Appointments, w, r)
+		},
+		"upcoming appointments": func(w http.ResponseWriter, r *http.Request) {
+			GetUpcommingAppointments(stores.Appointments, w, r)
+		},
+	}
+	for name, handler := range responses {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		var decoded interface{}
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &decoded) != nil {
+			t.Fatalf("%s: expected a JSON response, got %v. Response: %s", name, w.Code, w.Body.String())
+		}
+		body := w.Body.String()
+		for _, needle := range append(secrets, `"password"`, `"two_factor"`, `"verification_code"`) {
+			if strings.Contains(body, needle) {
+				t.Errorf("%s: response contains %s: %s", name, needle, body)
+			}
+		}
+	}
+}
+
+func TestPayFeeOnlyOnce(t *testing.T) {
+	stores := store.NewMemoryStores()
+	ctx := context.Background()
+	admin := models.User{ID: primitive.NewObjectID(), Email: "admin@example.com", Role: []models.Role{{Name: models.RoleAdmin}}}
+	fee := models.Fee{ID: primitive.NewObjectID(), NIF: 210422114, Value: 10}
+	if err := stores.Fees.Insert(ctx, fee); err != nil {
+		t.Fatal(err)
+	}
+	jobs := &background.Group{}
+	paid := testutil.ToFloat64(metrics.FeesPaid)
+
+	pay := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := adminRequest(admin, "pay", http.MethodPut, nil, map[string]string{"id": fee.ID.Hex()})
+		PayFee(stores.Fees, stores.Users, stores.Audit, &mailer.Memory{}, jobs, w, req)
+		jobs.Wait(ctx)
+		return w
+	}
+	if w := pay(); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v. Response: %s", w.Code, w.Body.String())
+	}
+	w := pay()
+	var body problem.Problem
+	json.NewDecoder(w.Body).Decode(&body)
+	if w.Code != http.StatusConflict || body.Code != problem.FeePaid {
+		t.Fatalf("Expected 409 with %s paying again, got %v %+v", problem.FeePaid, w.Code, body)
+	}
+
+	entries, _ := stores.Audit.Find(ctx, store.AuditQuery{Action: models.AuditFeePaid})
+	if len(entries) != 1 || testutil.ToFloat64(metrics.FeesPaid) != paid+1 {
+		t.Errorf("Expected the fee to be counted and audited once, got %d entries and %v payments", len(entries), testutil.ToFloat64(metrics.FeesPaid)-paid)
 	}
 }
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"PSbackend/models"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// codeDigits is the length of the codes emailed to users
+	codeDigits = 4
+	// codeTTL is how long a verification code can be used after it was emailed
+	codeTTL = 15 * time.Minute
+	// MaxCodeAttempts is how many guesses a user gets before having to request a new code
+	MaxCodeAttempts = 5
+)
+
+var (
+	ErrNoCode          = errors.New("no verification code was requested")
+	ErrCodeExpired     = errors.New("verification code expired")
+	ErrTooManyAttempts = errors.New("too many attempts, request a new verification code")
+	ErrIncorrectCode   = errors.New("incorrect verification code")
+)
+
+// NewVerificationCode generates a random numeric code and the hashed record to store for it
+func NewVerificationCode(now time.Time) (string, models.VerificationCode, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(10000))
+	if err != nil {
+		return "", models.VerificationCode{}, err
+	}
+	code := fmt.Sprintf("%0*d", codeDigits, n.Int64())
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", models.VerificationCode{}, err
+	}
+
+	return code, models.VerificationCode{
+		Hash:      string(hash),
+		ExpiresAt: now.Add(codeTTL),
+	}, nil
+}
+
+// FormatCode renders a code typed by the user the same way it was emailed
+func FormatCode(code int) string {
+	return fmt.Sprintf("%0*d", codeDigits, code)
+}
+
+// CheckVerificationCode validates code against the stored record, which must count the current attempt already
+func CheckVerificationCode(stored *models.VerificationCode, code string, now time.Time) error {
+	if stored == nil || stored.Hash == "" {
+		return ErrNoCode
+	}
+	if now.After(stored.ExpiresAt) {
+		return ErrCodeExpired
+	}
+	if stored.Attempts > MaxCodeAttempts {
+		return ErrTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.Hash), []byte(code)) != nil {
+		return ErrIncorrectCode
+	}
+	return nil
+}
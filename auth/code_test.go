@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckVerificationCode(t *testing.T) {
+	now := time.Date(2024, time.December, 1, 10, 0, 0, 0, time.UTC)
+
+	code, stored, err := NewVerificationCode(now)
+	if err != nil {
+		t.Fatalf("NewVerificationCode returned error: %v", err)
+	}
+	if len(code) != codeDigits {
+		t.Fatalf("Expected a %d digit code, got %q", codeDigits, code)
+	}
+	if stored.Hash == code {
+		t.Fatal("Verification code was stored in plaintext")
+	}
+
+	wrong := "0000"
+	if code == wrong {
+		wrong = "0001"
+	}
+
+	stored.Attempts = 1
+	if err := CheckVerificationCode(&stored, code, now.Add(time.Minute)); err != nil {
+		t.Errorf("Expected code to be accepted, got %v", err)
+	}
+	if err := CheckVerificationCode(&stored, wrong, now.Add(time.Minute)); err != ErrIncorrectCode {
+		t.Errorf("Expected %v, got %v", ErrIncorrectCode, err)
+	}
+	if err := CheckVerificationCode(&stored, code, now.Add(codeTTL+time.Second)); err != ErrCodeExpired {
+		t.Errorf("Expected %v, got %v", ErrCodeExpired, err)
+	}
+
+	stored.Attempts = MaxCodeAttempts + 1
+	if err := CheckVerificationCode(&stored, code, now.Add(time.Minute)); err != ErrTooManyAttempts {
+		t.Errorf("Expected %v, got %v", ErrTooManyAttempts, err)
+	}
+
+	if err := CheckVerificationCode(nil, code, now); err != ErrNoCode {
+		t.Errorf("Expected %v, got %v", ErrNoCode, err)
+	}
+}
+
+func TestFormatCode(t *testing.T) {
+	if got := FormatCode(42); got != "0042" {
+		t.Errorf("Expected 0042, got %s", got)
+	}
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"PSbackend/logging"
+	"PSbackend/problem"
+	"PSbackend/store"
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type contextKey struct{}
+
+// publicRoutes lists the route templates that can be called without an access token
+var publicRoutes = map[string]bool{
+	"/api/v1/mb/users/login":                 true,
+	"/api/v1/bo/users/login":                 true,
+	"/api/v1/mb/users/register":              true,
+	"/api/v1/bo/users/register":              true,
+	"/api/v1/mb/users/register-confirmation": true,
+	"/api/v1/bo/users/register-confirmation": true,
+	"/api/v1/mb/users/recovery":              true,
+	"/api/v1/bo/users/recovery":              true,
+	"/api/v1/mb/users/recovery-confirmation": true,
+	"/api/v1/bo/users/recovery-confirmation": true,
+	"/api/v1/mb/users/token/refresh":         true,
+	"/api/v1/bo/users/token/refresh":         true,
+	"/healthz":                               true,
+	"/readyz":                                true,
+}
+
+// WithIdentity returns a copy of ctx carrying the caller's identity
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the caller's identity stored by Middleware
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
+
+func isPublic(r *http.Request) bool {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return false
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return false
+	}
+	return publicRoutes[template]
+}
+
+// Middleware checks the bearer token in the Authorization header and that the session it was issued for is still
+// live, so logging out or revoking sessions takes effect at once, and puts the caller's identity into the request
+// context
+func Middleware(sessions store.SessionStore) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isPublic(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !found || token == "" {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				problem.Write(w, r, http.StatusUnauthorized, problem.MissingToken, "Missing authorization token")
+				return
+			}
+
+			identity, err := ParseToken(token)
+			var sessionID primitive.ObjectID
+			if err == nil {
+				sessionID, err = primitive.ObjectIDFromHex(identity.SessionID)
+			}
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				problem.Write(w, r, http.StatusUnauthorized, problem.InvalidToken, "Invalid authorization token")
+				return
+			}
+
+			session, err := sessions.FindByID(r.Context(), sessionID)
+			if err != nil && err != store.ErrNotFound {
+				slog.ErrorContext(r.Context(), "Failed to check the session of an access token", "session_id", identity.SessionID, "error", err)
+				problem.Write(w, r, http.StatusInternalServerError, problem.Internal, "Something went wrong, try again later")
+				return
+			}
+			if err == store.ErrNotFound || session.Revoked || time.Now().After(session.ExpiresAt) {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				problem.Write(w, r, http.StatusUnauthorized, problem.SessionExpired, "Session expired or revoked")
+				return
+			}
+
+			logging.SetUser(r.Context(), identity.UserID)
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), identity)))
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package auth
+
+import "testing"
+
+func TestCheckPassword(t *testing.T) {
+	hash, err := HashPassword("password123")
+	if err != nil {
+		t.Fatalf("HashPassword returned error: %v", err)
+	}
+
+	if !IsHashed(hash) || IsHashed("password123") {
+		t.Fatal("IsHashed didn't tell hashes apart from plaintext")
+	}
+
+	tests := []struct {
+		name     string
+		stored   string
+		password string
+		want     bool
+	}{
+		{"hash matches", hash, "password123", true},
+		{"hash mismatch", hash, "password124", false},
+		{"legacy plaintext matches", "password123", "password123", true},
+		{"legacy plaintext mismatch", "password123", "password124", false},
+		{"no password set", "", "", false},
+	}
+
+	for _, tt := range tests {
+		if got := CheckPassword(tt.stored, tt.password); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"PSbackend/problem"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// Policy decides whether an authenticated caller may call a route
+type Policy func(identity Identity, r *http.Request) bool
+
+// Authenticated lets through any caller holding a valid access token
+func Authenticated(identity Identity, r *http.Request) bool {
+	return true
+}
+
+// Roles lets through callers holding at least one of the given roles
+func Roles(names ...string) Policy {
+	return func(identity Identity, r *http.Request) bool {
+		for _, name := range names {
+			if identity.HasRole(name) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// SelfOr lets through callers whose NIF matches the route variable param, or who hold one of the given roles
+func SelfOr(param string, names ...string) Policy {
+	roles := Roles(names...)
+	return func(identity Identity, r *http.Request) bool {
+		nif, err := strconv.Atoi(mux.Vars(r)[param])
+		if err == nil && nif == identity.NIF {
+			return true
+		}
+		return roles(identity, r)
+	}
+}
+
+// Self lets through callers whose NIF matches the route variable param
+func Self(param string) Policy {
+	return SelfOr(param)
+}
+
+// Require wraps handler so that it only runs for callers allowed by policy
+func Require(policy Policy, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := FromContext(r.Context())
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			problem.Write(w, r, http.StatusUnauthorized, problem.MissingToken, "Missing authorization token")
+			return
+		}
+
+		if !policy(identity, r) {
+			Forbidden(w, r)
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// Forbidden replies to a request the caller isn't allowed to make
+func Forbidden(w http.ResponseWriter, r *http.Request) {
+	problem.Write(w, r, http.StatusForbidden, problem.Forbidden, "You don't have permission to access this resource")
+}
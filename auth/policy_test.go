@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequire(t *testing.T) {
+	router := mux.NewRouter()
+	router.HandleFunc("/admin", Require(Roles("ADMIN"), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	router.HandleFunc("/clients/{nif}", Require(SelfOr("nif", "TECH"), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	client := Identity{NIF: 210422113, Roles: []string{"CLIENT"}}
+	tech := Identity{NIF: 123456789, Roles: []string{"TECH"}}
+	admin := Identity{NIF: 987654321, Roles: []string{"ADMIN"}}
+
+	tests := []struct {
+		name     string
+		path     string
+		identity *Identity
+		want     int
+	}{
+		{"anonymous caller", "/admin", nil, http.StatusUnauthorized},
+		{"admin route as client", "/admin", &client, http.StatusForbidden},
+		{"admin route as admin", "/admin", &admin, http.StatusOK},
+		{"own appointments", "/clients/210422113", &client, http.StatusOK},
+		{"other client's appointments", "/clients/210422114", &client, http.StatusForbidden},
+		{"client's appointments as tech", "/clients/210422113", &tech, http.StatusOK},
+		{"client's appointments as admin", "/clients/210422113", &admin, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.identity != nil {
+			req = req.WithContext(WithIdentity(req.Context(), *tt.identity))
+		}
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"PSbackend/models"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessTokenTTL is how long an access token stays valid; clients renew it with their refresh token
+const accessTokenTTL = 15 * time.Minute
+
+const issuer = "fixfinder"
+
+// Claims are the claims carried by every access token issued on login
+type Claims struct {
+	NIF       int      `json:"nif"`
+	Roles     []string `json:"roles"`
+	SessionID string   `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// Identity is the authenticated caller of a request
+type Identity struct {
+	UserID    string
+	NIF       int
+	Roles     []string
+	SessionID string
+}
+
+// HasRole reports whether the caller holds the role with the given name
+func (i Identity) HasRole(name string) bool {
+	for _, role := range i.Roles {
+		if role == name {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredSecret signs access tokens once set with SetSecret; until then JWT_SECRET is read from the environment
+var configuredSecret string
+
+// SetSecret sets the secret that signs and verifies access tokens
+func SetSecret(secret string) {
+	configuredSecret = secret
+}
+
+func signingKey() ([]byte, error) {
+	secret := configuredSecret
+	if secret == "" {
+		secret = os.Getenv("JWT_SECRET")
+	}
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET is not set")
+	}
+	return []byte(secret), nil
+}
+
+// IssueToken signs an access token for the given user and session with its ID, NIF and role names as claims
+func IssueToken(user models.User, sessionID string) (string, error) {
+	key, err := signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	roles := make([]string, 0, len(user.Role))
+	for _, role := range user.Role {
+		roles = append(roles, role.Name)
+	}
+
+	now := time.Now()
+	claims := Claims{
+		NIF:       user.NIF,
+		Roles:     roles,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   user.ID.Hex(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(accessTokenTTL)),
+		},
+	}
+
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(key)
+}
+
+// ParseToken validates the signature and expiry of an access token and returns the caller's identity
+func ParseToken(tokenString string) (Identity, error) {
+	key, err := signingKey()
+	if err != nil {
+		return Identity{}, err
+	}
+
+	var claims Claims
+	_, err = jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithIssuer(issuer), jwt.WithExpirationRequired())
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid token: %w", err)
+	}
+
+	return Identity{
+		UserID:    claims.Subject,
+		NIF:       claims.NIF,
+		Roles:     claims.Roles,
+		SessionID: claims.SessionID,
+	}, nil
+}
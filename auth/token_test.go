@@ -0,0 +1,111 @@
+package auth
+
+import (
+	"PSbackend/models"
+	"PSbackend/store"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestIssueAndParseToken(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	user := models.User{
+		ID:   primitive.NewObjectID(),
+		NIF:  210422113,
+		Role: []models.Role{{Name: "CLIENT"}, {Name: "TECH"}},
+	}
+
+	token, err := IssueToken(user, "session-id")
+	if err != nil {
+		t.Fatalf("IssueToken returned error: %v", err)
+	}
+
+	identity, err := ParseToken(token)
+	if err != nil {
+		t.Fatalf("ParseToken returned error: %v", err)
+	}
+
+	if identity.UserID != user.ID.Hex() || identity.NIF != user.NIF || identity.SessionID != "session-id" {
+		t.Fatalf("Unexpected identity %+v", identity)
+	}
+	if !identity.HasRole("TECH") || identity.HasRole("ADMIN") {
+		t.Fatalf("Unexpected roles %v", identity.Roles)
+	}
+
+	t.Setenv("JWT_SECRET", "another-secret")
+	if _, err := ParseToken(token); err == nil {
+		t.Fatal("Expected token signed with another secret to be rejected")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	sessions := store.NewMemoryStores().Sessions
+	user := models.User{ID: primitive.NewObjectID(), NIF: 210422113}
+	live := models.Session{ID: primitive.NewObjectID(), UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	revoked := models.Session{ID: primitive.NewObjectID(), UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour), Revoked: true}
+	for _, session := range []models.Session{live, revoked} {
+		if err := sessions.Insert(context.Background(), session); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	router := mux.NewRouter()
+	router.Use(Middleware(sessions))
+	router.HandleFunc("/api/v1/mb/users/login", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := FromContext(r.Context())
+		if !ok || identity.NIF != 210422113 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	token := func(sessionID string) string {
+		token, err := IssueToken(user, sessionID)
+		if err != nil {
+			t.Fatalf("IssueToken returned error: %v", err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"public route", "/api/v1/mb/users/login", "", http.StatusOK},
+		{"missing token", "/api/v1/mb/users/210422113", "", http.StatusUnauthorized},
+		{"invalid token", "/api/v1/mb/users/210422113", "Bearer invalid", http.StatusUnauthorized},
+		{"valid token", "/api/v1/mb/users/210422113", "Bearer " + token(live.ID.Hex()), http.StatusOK},
+		{"revoked session", "/api/v1/mb/users/210422113", "Bearer " + token(revoked.ID.Hex()), http.StatusUnauthorized},
+		{"unknown session", "/api/v1/mb/users/210422113", "Bearer " + token(primitive.NewObjectID().Hex()), http.StatusUnauthorized},
+		{"no session", "/api/v1/mb/users/210422113", "Bearer " + token(""), http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		w := httptest.NewRecorder()
+
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.want {
+			t.Errorf("%s: expected status code %d, got %d", tt.name, tt.want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors
+var rfc6238Secret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// Last six digits of the RFC 6238 appendix B vectors for SHA1
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, v := range vectors {
+		code, err := TOTPCode(rfc6238Secret, time.Unix(v.unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode returned error: %v", err)
+		}
+		if code != v.code {
+			t.Errorf("At %d expected %s, got %s", v.unix, v.code, code)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code, _ := TOTPCode(rfc6238Secret, now)
+
+	step, ok := MatchTOTP(rfc6238Secret, code, now)
+	if !ok || step != now.Unix()/totpPeriod {
+		t.Fatalf("Expected the current code to match its step, got %d, %v", step, ok)
+	}
+
+	if _, ok := MatchTOTP(rfc6238Secret, code, now.Add(totpPeriod*time.Second)); !ok {
+		t.Error("Expected the previous period's code to be accepted for clock drift")
+	}
+	if _, ok := MatchTOTP(rfc6238Secret, code, now.Add(3*totpPeriod*time.Second)); ok {
+		t.Error("Expected an old code to be rejected")
+	}
+	if _, ok := MatchTOTP(rfc6238Secret, "123", now); ok {
+		t.Error("Expected a malformed code to be rejected")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("JBSWY3DPEHPK3PXP", "admin@fixfinder.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/fixfinder:admin@fixfinder.com?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := NewRecoveryCodes()
+	if err != nil {
+		t.Fatalf("NewRecoveryCodes returned error: %v", err)
+	}
+	if len(codes) != recoveryCodeCount || len(hashes) != recoveryCodeCount {
+		t.Fatalf("Expected %d codes, got %d", recoveryCodeCount, len(codes))
+	}
+	if HashRecoveryCode(strings.ToUpper(codes[0])) != hashes[0] {
+		t.Error("Expected recovery codes to be case insensitive")
+	}
+}
@@ -0,0 +1,38 @@
+// Package background runs jobs that outlive the request that started them, such as invoice emails,
+// so shutdown can wait for them to finish, and time-based jobs on a schedule.
+package background
+
+import (
+	"context"
+	"sync"
+)
+
+// Group tracks the jobs started with Go
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// Go runs job in its own goroutine
+func (g *Group) Go(job func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		job()
+	}()
+}
+
+// Wait blocks until every job has finished, or returns the context's error if it ends first
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,28 @@
+package background
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWait(t *testing.T) {
+	var jobs Group
+	release := make(chan struct{})
+	finished := false
+	jobs.Go(func() {
+		<-release
+		finished = true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := jobs.Wait(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Expected Wait to give up while a job runs, got %v", err)
+	}
+
+	close(release)
+	if err := jobs.Wait(context.Background()); err != nil || !finished {
+		t.Fatalf("Expected Wait to return once the job finished, got %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package background
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Clock tells the time to the scheduler and its jobs, so tests can move it along
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the clock of the machine
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Locker elects which replica runs the jobs, see store.LockStore
+type Locker interface {
+	Acquire(ctx context.Context, name, owner string, now, expiresAt time.Time) (bool, error)
+	Release(ctx context.Context, name, owner string) error
+}
+
+// Job is time-based work run on every tick, given the time of the tick
+type Job func(ctx context.Context, now time.Time) error
+
+// leaderLock names the lock held by the replica running the jobs
+const leaderLock = "scheduler"
+
+// Scheduler runs its jobs every Interval on one replica at a time: the one holding the leader lock, which
+// expires after three intervals so another replica takes over when the leader goes away
+type Scheduler struct {
+	locker   Locker
+	clock    Clock
+	interval time.Duration
+	owner    string
+	names    []string
+	jobs     []Job
+}
+
+// NewScheduler returns a scheduler with no jobs yet
+func NewScheduler(locker Locker, clock Clock, interval time.Duration) *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		locker:   locker,
+		clock:    clock,
+		interval: interval,
+		owner:    fmt.Sprintf("%s/%d/%s", host, os.Getpid(), primitive.NewObjectID().Hex()),
+	}
+}
+
+// Add registers a job, run on every tick after the ones added before it
+func (s *Scheduler) Add(name string, job Job) {
+	s.names = append(s.names, name)
+	s.jobs = append(s.jobs, job)
+}
+
+// Tick runs every job once if this replica holds, or takes, the leader lock, and reports whether it did;
+// a failing job is logged and doesn't keep the others from running
+func (s *Scheduler) Tick(ctx context.Context) bool {
+	now := s.clock.Now()
+	leader, err := s.locker.Acquire(ctx, leaderLock, s.owner, now, now.Add(3*s.interval))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to acquire the scheduler lock", "error", err)
+		return false
+	}
+	if !leader {
+		return false
+	}
+
+	// Leave the last interval of the lock free, so jobs running late can't outlive it
+	ctx, cancel := context.WithTimeout(ctx, 2*s.interval)
+	defer cancel()
+	for i, job := range s.jobs {
+		err := job(ctx, now)
+		if err != nil {
+			slog.ErrorContext(ctx, "Background job failed", "job", s.names[i], "error", err)
+		}
+	}
+	return true
+}
+
+// Run ticks every interval until ctx ends, then gives up the leader lock so another replica can take over
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			release, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+			defer cancel()
+			if err := s.locker.Release(release, leaderLock, s.owner); err != nil {
+				slog.Error("Failed to release the scheduler lock", "error", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
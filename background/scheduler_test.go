@@ -0,0 +1,94 @@
+package background
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"PSbackend/store"
+)
+
+// fakeClock is a clock the test moves along by hand
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestSchedulerLeaderElection(t *testing.T) {
+	ctx := context.Background()
+	locks := store.NewMemoryStores().Locks
+	clock := &fakeClock{now: time.Date(2030, 6, 3, 10, 0, 0, 0, time.UTC)}
+
+	runs := map[string][]time.Time{}
+	scheduler := func(name string) *Scheduler {
+		s := NewScheduler(locks, clock, time.Minute)
+		s.Add("count", func(ctx context.Context, now time.Time) error {
+			runs[name] = append(runs[name], now)
+			return nil
+		})
+		return s
+	}
+	first, second := scheduler("first"), scheduler("second")
+
+	if !first.Tick(ctx) {
+		t.Fatal("Expected the first replica to take the free lock")
+	}
+	if second.Tick(ctx) {
+		t.Fatal("Expected the second replica to wait while the first holds the lock")
+	}
+
+	// The leader keeps the lock as long as it ticks
+	clock.now = clock.now.Add(2 * time.Minute)
+	if !first.Tick(ctx) || second.Tick(ctx) {
+		t.Fatal("Expected the first replica to keep the lock it renewed")
+	}
+
+	// Once it stops ticking, its lock expires and the other replica takes over
+	clock.now = clock.now.Add(3 * time.Minute)
+	if !second.Tick(ctx) {
+		t.Fatal("Expected the second replica to take the expired lock")
+	}
+	if first.Tick(ctx) {
+		t.Fatal("Expected the first replica to lose the lock it let expire")
+	}
+
+	if len(runs["first"]) != 2 || len(runs["second"]) != 1 || !runs["second"][0].Equal(clock.now) {
+		t.Fatalf("Expected the jobs to run on the leader only, at the time of the tick, got %v", runs)
+	}
+}
+
+func TestSchedulerKeepsRunningAfterAFailingJob(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2030, 6, 3, 10, 0, 0, 0, time.UTC)}
+	s := NewScheduler(store.NewMemoryStores().Locks, clock, time.Minute)
+	ran := false
+	s.Add("failing", func(ctx context.Context, now time.Time) error {
+		return errors.New("boom")
+	})
+	s.Add("next", func(ctx context.Context, now time.Time) error {
+		ran = true
+		return nil
+	})
+
+	if !s.Tick(context.Background()) || !ran {
+		t.Fatal("Expected the jobs after a failing one to run")
+	}
+}
+
+func TestSchedulerReleasesTheLockOnStop(t *testing.T) {
+	locks := store.NewMemoryStores().Locks
+	clock := &fakeClock{now: time.Date(2030, 6, 3, 10, 0, 0, 0, time.UTC)}
+	first := NewScheduler(locks, clock, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first.Run(ctx)
+
+	// The lock is free long before it would have expired
+	if !NewScheduler(locks, clock, time.Hour).Tick(context.Background()) {
+		t.Fatal("Expected another replica to take the lock released on stop")
+	}
+}
@@ -0,0 +1,53 @@
+// Command migrate-appointments removes the credentials of the provider and client embedded by older versions in
+// every appointment, leaving the public representation of its users that appointments are now stored with.
+//
+// It is safe to run more than once: appointments without credentials are left as they are.
+package main
+
+import (
+	"PSbackend/config"
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// private are the fields of a user kept out of its public representation, along with the recovery code of
+// older versions
+var private = []string{"password", "verification_code", "recovery_code", "schedule", "failed_logins", "locked_until", "two_factor", "counted"}
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Load the configuration from the environment, an optional file and the flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Error loading configuration: ", err)
+	}
+
+	client, err := config.ConnectDB(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal("Error connecting to mongodb:", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	unset := bson.M{}
+	var found bson.A
+	for _, party := range []string{"provider", "client"} {
+		for _, field := range private {
+			unset[party+"."+field] = ""
+			found = append(found, bson.M{party + "." + field: bson.M{"$exists": true}})
+		}
+	}
+
+	collection := client.Database(cfg.DBName).Collection(cfg.Collections.Appointments)
+	result, err := collection.UpdateMany(ctx, bson.M{"$or": found}, bson.M{"$unset": unset})
+	if err != nil {
+		log.Fatal("Error updating appointments:", err)
+	}
+
+	log.Printf("Removed the credentials embedded in %d appointments", result.ModifiedCount)
+}
@@ -0,0 +1,70 @@
+// Command migrate-passwords hashes every plaintext password left in the Users collection.
+//
+// It is safe to run more than once: documents whose password is already a hash are skipped.
+package main
+
+import (
+	"PSbackend/auth"
+	"PSbackend/config"
+	"PSbackend/models"
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Load the configuration from the environment, an optional file and the flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Error loading configuration: ", err)
+	}
+
+	client, err := config.ConnectDB(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal("Error connecting to mongodb:", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := client.Database(cfg.DBName).Collection(cfg.Collections.Users)
+	cursor, err := collection.Find(ctx, bson.M{"password": bson.M{"$nin": bson.A{"", nil}}})
+	if err != nil {
+		log.Fatal("Error listing users:", err)
+	}
+	defer cursor.Close(ctx)
+
+	var migrated, skipped int
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			log.Fatal("Error decoding user:", err)
+		}
+
+		if auth.IsHashed(user.Password) {
+			skipped++
+			continue
+		}
+
+		hashedPassword, err := auth.HashPassword(user.Password)
+		if err != nil {
+			log.Fatal("Error hashing password:", err)
+		}
+
+		// Match on the old value so a password changed meanwhile isn't overwritten
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID, "password": user.Password}, bson.M{"$set": bson.M{"password": hashedPassword}})
+		if err != nil {
+			log.Fatal("Error updating user:", err)
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatal("Error iterating users:", err)
+	}
+
+	log.Printf("Hashed %d passwords, %d were already hashed", migrated, skipped)
+}
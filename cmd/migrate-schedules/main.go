@@ -0,0 +1,66 @@
+// Command migrate-schedules converts the workStart and workEnd of every user without a schedule into a
+// schedule of the same hours every day, read in TIME_ZONE.
+//
+// It is safe to run more than once: users that already have a schedule, or no working hours, are skipped.
+package main
+
+import (
+	"PSbackend/config"
+	"PSbackend/models"
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func main() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	// Load the configuration from the environment, an optional file and the flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Error loading configuration: ", err)
+	}
+
+	client, err := config.ConnectDB(ctx, cfg.MongoURI)
+	if err != nil {
+		log.Fatal("Error connecting to mongodb:", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	collection := client.Database(cfg.DBName).Collection(cfg.Collections.Users)
+	cursor, err := collection.Find(ctx, bson.M{"schedule": bson.M{"$exists": false}})
+	if err != nil {
+		log.Fatal("Error listing users:", err)
+	}
+	defer cursor.Close(ctx)
+
+	var migrated, skipped int
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			log.Fatal("Error decoding user:", err)
+		}
+
+		schedule, ok := user.LegacySchedule(cfg.Booking.Zone)
+		if !ok {
+			skipped++
+			continue
+		}
+
+		// Match on the missing schedule so one set meanwhile isn't overwritten
+		_, err = collection.UpdateOne(ctx, bson.M{"_id": user.ID, "schedule": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"schedule": schedule}})
+		if err != nil {
+			log.Fatal("Error updating user:", err)
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		log.Fatal("Error iterating users:", err)
+	}
+
+	log.Printf("Converted the working hours of %d users into schedules, %d had none", migrated, skipped)
+}
@@ -0,0 +1,315 @@
+package config
+
+import (
+	"PSbackend/deadline"
+	"PSbackend/ratelimit"
+	"PSbackend/store"
+	"PSbackend/validate"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// defaultFile is read when it exists and no other file is given with -config
+const defaultFile = ".env"
+
+// defaultRouteTimeouts give more time to the routes that wait for SendGrid and to the audit log search
+const defaultRouteTimeouts = "/api/v1/mb/users/register=30s,/api/v1/bo/users/register=30s," +
+	"/api/v1/mb/users/recovery=30s,/api/v1/bo/users/recovery=30s,/api/v1/bo/audit=30s"
+
+// RateLimits are the limits of the public credential routes, written as "<calls>/<duration>"
+type RateLimits struct {
+	LoginIP    string
+	LoginEmail string
+	EmailIP    string
+	EmailEmail string
+	CodeIP     string
+	CodeEmail  string
+	RefreshIP  string
+}
+
+// Config is the configuration of the server, built once at startup
+type Config struct {
+	Host           string
+	Port           string
+	MetricsAddr    string
+	MongoURI       string
+	DBName         string
+	Collections    store.Collections
+	FromEmail      string
+	SendGridAPIKey string
+	JWTSecret      string
+	ConnectTimeout time.Duration
+	Server         ServerTimeouts
+	Timeouts       deadline.Budgets
+	Booking        Booking
+	JobInterval    time.Duration
+	RateLimits     RateLimits
+	Proxies        ratelimit.Proxies
+	LogLevel       slog.Level
+}
+
+// ServerTimeouts bound how long the HTTP server spends on a connection and on shutting down
+type ServerTimeouts struct {
+	Read     time.Duration
+	Write    time.Duration
+	Idle     time.Duration
+	Shutdown time.Duration
+}
+
+// Booking shapes the slots technicians offer and take appointments in
+type Booking struct {
+	// Granularity is how far apart the free slots offered by the availability routes start
+	Granularity time.Duration
+	// Buffer is the time a technician keeps free after each appointment, such as to travel to the next one
+	Buffer time.Duration
+	// Zone is the time zone of technicians without a schedule of their own; nil means UTC
+	Zone *time.Location
+	// MaxLength is how long an appointment can last at most
+	MaxLength time.Duration
+}
+
+// Addr is the address the HTTP server listens on
+func (c Config) Addr() string {
+	return net.JoinHostPort(c.Host, c.Port)
+}
+
+// setting is one configuration key, read from the file, the environment and a flag in that order
+type setting struct {
+	key      string
+	value    *string
+	fallback string
+	required bool
+	parse    func(value string) error
+}
+
+// durationSetting is a setting parsed into target as a positive duration
+func durationSetting(key string, target *time.Duration, fallback string) setting {
+	parse := func(value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("%s %q must be a positive duration", key, value)
+		}
+		*target = duration
+		return nil
+	}
+	return setting{key: key, value: new(string), fallback: fallback, parse: parse}
+}
+
+// optionalDurationSetting is like durationSetting but also accepts 0s, which turns the setting off
+func optionalDurationSetting(key string, target *time.Duration, fallback string) setting {
+	parse := func(value string) error {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration < 0 {
+			return fmt.Errorf("%s %q must be a duration of 0s or more", key, value)
+		}
+		*target = duration
+		return nil
+	}
+	return setting{key: key, value: new(string), fallback: fallback, parse: parse}
+}
+
+// routeTimeoutsSetting is a setting parsed into target as the timeouts of some routes, see deadline.ParseRoutes
+func routeTimeoutsSetting(key string, target *map[string]time.Duration, fallback string) setting {
+	parse := func(value string) error {
+		routes, err := deadline.ParseRoutes(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		*target = routes
+		return nil
+	}
+	return setting{key: key, value: new(string), fallback: fallback, parse: parse}
+}
+
+// zoneSetting is a setting parsed into target as an IANA time zone such as Europe/Lisbon
+func zoneSetting(key string, target **time.Location, fallback string) setting {
+	parse := func(value string) error {
+		zone, err := validate.TimeZone(value)
+		if err != nil {
+			return fmt.Errorf("%s %q must be an IANA time zone such as Europe/Lisbon", key, value)
+		}
+		*target = zone
+		return nil
+	}
+	return setting{key: key, value: new(string), fallback: fallback, parse: parse}
+}
+
+// levelSetting is a setting parsed into target as a log level such as info or debug
+func levelSetting(key string, target *slog.Level, fallback string) setting {
+	parse := func(value string) error {
+		err := target.UnmarshalText([]byte(value))
+		if err != nil {
+			return fmt.Errorf("%s %q must be debug, info, warn or error", key, value)
+		}
+		return nil
+	}
+	return setting{key: key, value: new(string), fallback: fallback, parse: parse}
+}
+
+// networksSetting is a setting parsed into target as a list of addresses and CIDR ranges, see
+// ratelimit.ParseNetworks
+func networksSetting(key string, target *[]*net.IPNet, fallback string) setting {
+	parse := func(value string) error {
+		networks, err := ratelimit.ParseNetworks(value)
+		if err != nil {
+			return fmt.Errorf("%s: %v", key, err)
+		}
+		*target = networks
+		return nil
+	}
+	return setting{key: key, value: new(string), fallback: fallback, parse: parse}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{key: "HOST", value: &c.Host},
+		{key: "PORT", value: &c.Port, fallback: "8080"},
+		{key: "METRICS_ADDR", value: &c.MetricsAddr, fallback: "localhost:9090"},
+		{key: "MONGO_URI", value: &c.MongoURI, required: true},
+		{key: "DB_NAME", value: &c.DBName, required: true},
+		{key: "USER_COLLECTION", value: &c.Collections.Users, fallback: "Users"},
+		{key: "APPOINTMENT_COLLECTION", value: &c.Collections.Appointments, fallback: "Appointments"},
+		{key: "FEES_COLLECTION", value: &c.Collections.Fees, fallback: "Fees"},
+		{key: "SERVICE_COLLECTION", value: &c.Collections.Services, fallback: "Services"},
+		{key: "SERVICE_TYPE_COLLECTION", value: &c.Collections.ServiceTypes, fallback: "ServiceTypes"},
+		{key: "REVIEW_COLLECTION", value: &c.Collections.Reviews, fallback: "Reviews"},
+		{key: "ROLES_COLLECTION", value: &c.Collections.Roles, fallback: "Roles"},
+		{key: "SESSION_COLLECTION", value: &c.Collections.Sessions, fallback: "Sessions"},
+		{key: "AUDIT_COLLECTION", value: &c.Collections.Audit, fallback: "Audit"},
+		{key: "RESERVATION_COLLECTION", value: &c.Collections.Reservations, fallback: "Reservations"},
+		{key: "LOCK_COLLECTION", value: &c.Collections.Locks, fallback: "Locks"},
+		{key: "FIXFINDER_EMAIL", value: &c.FromEmail},
+		{key: "SENDGRID_APIKEY", value: &c.SendGridAPIKey},
+		{key: "JWT_SECRET", value: &c.JWTSecret, required: true},
+		durationSetting("CONNECT_TIMEOUT", &c.ConnectTimeout, "30s"),
+		durationSetting("READ_TIMEOUT", &c.Server.Read, "15s"),
+		durationSetting("WRITE_TIMEOUT", &c.Server.Write, "60s"),
+		durationSetting("IDLE_TIMEOUT", &c.Server.Idle, "120s"),
+		durationSetting("SHUTDOWN_TIMEOUT", &c.Server.Shutdown, "30s"),
+		durationSetting("REQUEST_TIMEOUT", &c.Timeouts.Default, "10s"),
+		routeTimeoutsSetting("ROUTE_TIMEOUTS", &c.Timeouts.Routes, defaultRouteTimeouts),
+		durationSetting("SLOT_GRANULARITY", &c.Booking.Granularity, "30m"),
+		optionalDurationSetting("BOOKING_BUFFER", &c.Booking.Buffer, "0s"),
+		zoneSetting("TIME_ZONE", &c.Booking.Zone, "Europe/Lisbon"),
+		durationSetting("MAX_APPOINTMENT_LENGTH", &c.Booking.MaxLength, "24h"),
+		durationSetting("JOB_INTERVAL", &c.JobInterval, "1m"),
+		levelSetting("LOG_LEVEL", &c.LogLevel, "info"),
+		{key: "LOGIN_RATE_LIMIT_IP", value: &c.RateLimits.LoginIP, fallback: "20/1m"},
+		{key: "LOGIN_RATE_LIMIT_EMAIL", value: &c.RateLimits.LoginEmail, fallback: "10/15m"},
+		{key: "EMAIL_RATE_LIMIT_IP", value: &c.RateLimits.EmailIP, fallback: "10/1h"},
+		{key: "EMAIL_RATE_LIMIT_EMAIL", value: &c.RateLimits.EmailEmail, fallback: "3/1h"},
+		{key: "CODE_RATE_LIMIT_IP", value: &c.RateLimits.CodeIP, fallback: "20/1m"},
+		{key: "CODE_RATE_LIMIT_EMAIL", value: &c.RateLimits.CodeEmail, fallback: "10/15m"},
+		{key: "REFRESH_RATE_LIMIT_IP", value: &c.RateLimits.RefreshIP, fallback: "60/1m"},
+		{key: "TRUSTED_PROXY_HEADER", value: &c.Proxies.Header},
+		networksSetting("TRUSTED_PROXIES", &c.Proxies.Networks, "127.0.0.1,::1"),
+	}
+}
+
+// flagName turns a key such as MONGO_URI into the flag -mongo-uri
+func flagName(key string) string {
+	return strings.ReplaceAll(strings.ToLower(key), "_", "-")
+}
+
+// Load builds the configuration from the defaults, the file given with -config (or .env when it exists),
+// the environment and the command-line flags, each one overriding the previous ones
+func Load(args []string) (Config, error) {
+	var c Config
+	settings := c.settings()
+
+	flags := flag.NewFlagSet("fixfinder", flag.ContinueOnError)
+	file := flags.String("config", "", "file with KEY=value settings (default .env when it exists)")
+	values := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		values[s.key] = flags.String(flagName(s.key), "", "overrides "+s.key)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	fromFile, err := readFile(*file)
+	if err != nil {
+		return Config{}, err
+	}
+
+	setByFlag := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { setByFlag[f.Name] = true })
+
+	for _, s := range settings {
+		*s.value = s.fallback
+		if value, ok := fromFile[s.key]; ok && value != "" {
+			*s.value = value
+		}
+		if value := os.Getenv(s.key); value != "" {
+			*s.value = value
+		}
+		if setByFlag[flagName(s.key)] {
+			*s.value = *values[s.key]
+		}
+	}
+
+	err = c.validate(settings)
+	if err != nil {
+		return Config{}, err
+	}
+	return c, nil
+}
+
+// readFile reads the settings in path, or in .env when no path is given and it exists
+func readFile(path string) (map[string]string, error) {
+	if path == "" {
+		values, err := godotenv.Read(defaultFile)
+		if errors.Is(err, fs.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return values, err
+	}
+	return godotenv.Read(path)
+}
+
+// validate parses the typed settings and reports every missing or invalid setting at once
+func (c Config) validate(settings []setting) error {
+	var problems []string
+	for _, s := range settings {
+		if s.required && *s.value == "" {
+			problems = append(problems, s.key+" is required")
+		}
+		if s.parse != nil {
+			if err := s.parse(*s.value); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+
+	limits := map[string]string{
+		"LOGIN_RATE_LIMIT_IP":    c.RateLimits.LoginIP,
+		"LOGIN_RATE_LIMIT_EMAIL": c.RateLimits.LoginEmail,
+		"EMAIL_RATE_LIMIT_IP":    c.RateLimits.EmailIP,
+		"EMAIL_RATE_LIMIT_EMAIL": c.RateLimits.EmailEmail,
+		"CODE_RATE_LIMIT_IP":     c.RateLimits.CodeIP,
+		"CODE_RATE_LIMIT_EMAIL":  c.RateLimits.CodeEmail,
+		"REFRESH_RATE_LIMIT_IP":  c.RateLimits.RefreshIP,
+	}
+	for _, s := range settings {
+		if value, ok := limits[s.key]; ok {
+			if _, err := ratelimit.Parse(value); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", s.key, err))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoad(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "fixfinder.env")
+	content := "MONGO_URI=mongodb://file\nDB_NAME=FromFile\nJWT_SECRET=secret\nUSER_COLLECTION=FileUsers\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_NAME", "FromEnv")
+
+	cfg, err := Load([]string{"-config", file, "-port", "9090"})
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+
+	if cfg.MongoURI != "mongodb://file" || cfg.Collections.Users != "FileUsers" {
+		t.Errorf("File settings weren't read: %+v", cfg)
+	}
+	if cfg.DBName != "FromEnv" {
+		t.Errorf("Expected the environment to override the file, got %q", cfg.DBName)
+	}
+	if cfg.Addr() != ":9090" {
+		t.Errorf("Expected the flag to set the port, got %q", cfg.Addr())
+	}
+	if cfg.Collections.Appointments != "Appointments" || cfg.ConnectTimeout != 30*time.Second || cfg.RateLimits.LoginIP != "20/1m" {
+		t.Errorf("Defaults weren't applied: %+v", cfg)
+	}
+	if cfg.Timeouts.Default != 10*time.Second || cfg.Timeouts.For("/api/v1/bo/audit") != 30*time.Second {
+		t.Errorf("Default request timeouts weren't applied: %+v", cfg.Timeouts)
+	}
+	if cfg.Booking.Zone == nil || cfg.Booking.Zone.String() != "Europe/Lisbon" {
+		t.Errorf("Expected the default time zone, got %v", cfg.Booking.Zone)
+	}
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("MONGO_URI", "mongodb://env")
+	t.Setenv("DB_NAME", "FixFinder")
+	t.Setenv("JWT_SECRET", "secret")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Expected .env to be optional, got %v", err)
+	}
+	if cfg.Addr() != ":8080" {
+		t.Errorf("Expected the default port, got %q", cfg.Addr())
+	}
+	if cfg.MetricsAddr != "localhost:9090" {
+		t.Errorf("Expected the metrics on the loopback interface by default, got %q", cfg.MetricsAddr)
+	}
+	if cfg.Proxies.Header != "" || len(cfg.Proxies.Networks) != 2 {
+		t.Errorf("Expected no proxy header and the loopback proxies by default, got %+v", cfg.Proxies)
+	}
+
+	if _, err := Load([]string{"-config", filepath.Join(t.TempDir(), "missing.env")}); err == nil {
+		t.Error("Expected an error for a missing file given with -config")
+	}
+}
+
+func TestLoadValidation(t *testing.T) {
+	t.Setenv("LOGIN_RATE_LIMIT_IP", "fast")
+	t.Setenv("ROUTE_TIMEOUTS", "/api/v1/bo/audit=never")
+	t.Setenv("TIME_ZONE", "Local")
+	t.Setenv("TRUSTED_PROXIES", "10.0.0.0/33")
+
+	_, err := Load([]string{"-connect-timeout", "0s"})
+	if err == nil {
+		t.Fatal("Expected an invalid configuration")
+	}
+	for _, problem := range []string{"MONGO_URI is required", "DB_NAME is required", "JWT_SECRET is required", "CONNECT_TIMEOUT", "LOGIN_RATE_LIMIT_IP", "ROUTE_TIMEOUTS", "TIME_ZONE", "TRUSTED_PROXIES"} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Expected %q in %q", problem, err)
+		}
+	}
+}
@@ -1,27 +1,45 @@
 package config
 
 import (
+	"PSbackend/metrics"
 	"context"
-	"log"
+	"log/slog"
 
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 func ConnectDB(ctx context.Context, uri string) (*mongo.Client, error) {
 
-	clientOptions := options.Client().ApplyURI(uri)
+	clientOptions := options.Client().ApplyURI(uri).SetMonitor(monitor())
 
 	client, err := mongo.Connect(ctx, clientOptions)
 	if err != nil {
 		return nil, err
 	}
 
-	log.Println("Connected to MongoDB")
+	slog.Info("Connected to MongoDB")
 
 	return client, nil
 }
 
+// monitor reports every MongoDB command to the metrics, and logs them with the ID of the request that ran them
+func monitor() *event.CommandMonitor {
+	measure := metrics.NewMongoMonitor()
+	return &event.CommandMonitor{
+		Started: measure.Started,
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			measure.Succeeded(ctx, e)
+			slog.DebugContext(ctx, "MongoDB command", "command", e.CommandName, "duration", e.Duration)
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			measure.Failed(ctx, e)
+			slog.WarnContext(ctx, "MongoDB command failed", "command", e.CommandName, "duration", e.Duration, "error", e.Failure)
+		},
+	}
+}
+
 func TestConnection(ctx context.Context, client mongo.Client) error {
 	err := client.Ping(ctx, nil)
 	if err != nil {
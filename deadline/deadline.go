@@ -0,0 +1,66 @@
+// Package deadline bounds how long each route can spend on a request, so a client that disconnects
+// or a route that overruns cancels the MongoDB queries and emails made on its behalf.
+package deadline
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Budgets are the timeouts of the routes, by route template, and the one of every other route
+type Budgets struct {
+	Default time.Duration
+	Routes  map[string]time.Duration
+}
+
+// For returns the budget of a route template
+func (b Budgets) For(template string) time.Duration {
+	if budget, ok := b.Routes[template]; ok {
+		return budget
+	}
+	return b.Default
+}
+
+// ParseRoutes reads budgets written as "<route template>=<duration>" separated by commas, such as
+// "/api/v1/bo/audit=30s,/api/v1/mb/users/recovery=30s"
+func ParseRoutes(value string) (map[string]time.Duration, error) {
+	routes := map[string]time.Duration{}
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		template, duration, found := strings.Cut(entry, "=")
+		if !found || !strings.HasPrefix(template, "/") {
+			return nil, fmt.Errorf("route timeout %q must look like /api/v1/bo/audit=30s", entry)
+		}
+		budget, err := time.ParseDuration(duration)
+		if err != nil || budget <= 0 {
+			return nil, fmt.Errorf("route timeout %q has an invalid duration", entry)
+		}
+		routes[template] = budget
+	}
+	return routes, nil
+}
+
+// Middleware gives the context of every request the deadline of its route; the context is also
+// canceled when the client goes away
+func Middleware(budgets Budgets) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			template := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				template, _ = route.GetPathTemplate()
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), budgets.For(template))
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package deadline
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes(" /api/v1/bo/audit=30s, /api/v1/mb/users/{nif}=2s,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes["/api/v1/bo/audit"] != 30*time.Second || routes["/api/v1/mb/users/{nif}"] != 2*time.Second {
+		t.Fatalf("Unexpected routes %v", routes)
+	}
+
+	for _, value := range []string{"/api/v1/bo/audit", "api/v1/bo/audit=30s", "/api/v1/bo/audit=0s", "/api/v1/bo/audit=soon"} {
+		if _, err := ParseRoutes(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	budgets := Budgets{Default: time.Second, Routes: map[string]time.Duration{"/slow/{id}": time.Minute}}
+	left := map[string]time.Duration{}
+
+	router := mux.NewRouter()
+	router.Use(Middleware(budgets))
+	for _, path := range []string{"/fast", "/slow/{id}"} {
+		router.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			deadline, ok := r.Context().Deadline()
+			if !ok {
+				t.Errorf("Expected a deadline for %s", r.URL.Path)
+			}
+			left[r.URL.Path] = time.Until(deadline)
+		})
+	}
+
+	for _, path := range []string{"/fast", "/slow/42"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if left["/fast"] > time.Second || left["/fast"] < 500*time.Millisecond {
+		t.Errorf("Expected the default budget for /fast, got %v", left["/fast"])
+	}
+	if left["/slow/42"] <= time.Second {
+		t.Errorf("Expected the route budget for /slow/42, got %v", left["/slow/42"])
+	}
+}
@@ -0,0 +1,95 @@
+// Package lifecycle moves appointments along as time passes, taking the transitions of models.Transitions
+// that belong to the system.
+package lifecycle
+
+import (
+	"PSbackend/background"
+	"PSbackend/models"
+	"PSbackend/store"
+	"context"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FinishEnded completes the appointments that ended while in progress
+func FinishEnded(appointments store.AppointmentStore) background.Job {
+	return func(ctx context.Context, now time.Time) error {
+		return moveAll(ctx, appointments, models.ActionFinish, store.AppointmentQuery{EndedBy: now}, now, "")
+	}
+}
+
+// ExpireRequested rejects the requested appointments that started before their technician accepted them
+func ExpireRequested(appointments store.AppointmentStore) background.Job {
+	return func(ctx context.Context, now time.Time) error {
+		return moveAll(ctx, appointments, models.ActionExpire, store.AppointmentQuery{To: now}, now, "Not accepted before the start")
+	}
+}
+
+// CountCompleted counts the completed appointments not counted yet as services done, whether the system
+// completed them or counting them failed when their technician did
+func CountCompleted(appointments store.AppointmentStore, users store.UserStore) background.Job {
+	return func(ctx context.Context, now time.Time) error {
+		list, err := appointments.Find(ctx, store.AppointmentQuery{Statuses: []string{models.StatusCompleted}, Uncounted: true})
+		if err != nil {
+			return err
+		}
+		for _, appointment := range list {
+			if err := CountDone(ctx, users, appointments, appointment); err != nil {
+				return err
+			}
+		}
+
+		if len(list) > 0 {
+			slog.InfoContext(ctx, "Counted completed appointments", "count", len(list))
+		}
+		return nil
+	}
+}
+
+// CountDone counts a completed appointment as a service done by its client and by its technician, then marks it
+// counted; it counts an appointment once however many times it's called
+func CountDone(ctx context.Context, users store.UserStore, appointments store.AppointmentStore, appointment models.Appointment) error {
+	parties := []struct {
+		id   primitive.ObjectID
+		role string
+	}{{appointment.Client.ID, models.RoleClient}, {appointment.Provider.ID, models.RoleTech}}
+	for _, party := range parties {
+		err := users.CountServiceDone(ctx, party.id, party.role, appointment.ID)
+		if err != nil && err != store.ErrNotFound {
+			// A party deleted since, or without the role, has nothing to count
+			return err
+		}
+	}
+	return appointments.MarkCounted(ctx, appointment.ID)
+}
+
+// moveAll takes the system action on every appointment matching query that it can leave
+func moveAll(ctx context.Context, appointments store.AppointmentStore, action string, query store.AppointmentQuery, now time.Time, reason string) error {
+	transition, _ := models.FindTransition(action, models.BySystem)
+	query.Statuses = transition.From
+	list, err := appointments.Find(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	moved := 0
+	for _, appointment := range list {
+		change := models.StatusChange{From: appointment.Status, To: transition.To, At: now, By: models.BySystem, Reason: reason}
+		_, err := appointments.Transition(ctx, appointment.ID, change)
+		if err == store.ErrStatusChanged {
+			// Its technician or client moved it meanwhile
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		moved++
+	}
+
+	if moved > 0 {
+		slog.InfoContext(ctx, "Moved appointments along", "action", action, "count", moved)
+	}
+	return nil
+}
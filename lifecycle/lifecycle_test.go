@@ -0,0 +1,132 @@
+package lifecycle
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"PSbackend/models"
+	"PSbackend/store"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestJobsMoveAppointmentsAlong(t *testing.T) {
+	ctx := context.Background()
+	stores := store.NewMemoryStores()
+	appointments := stores.Appointments
+	now := time.Date(2030, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	client := models.User{ID: primitive.NewObjectID(), Email: "client@example.com", Role: []models.Role{{Name: models.RoleClient}}}
+	tech := models.User{ID: primitive.NewObjectID(), Email: "tech@example.com", Role: []models.Role{{Name: models.RoleTech}}}
+	for _, user := range []models.User{client, tech} {
+		if err := stores.Users.UpsertByEmail(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	insert := func(status string, start, end time.Time) primitive.ObjectID {
+		t.Helper()
+		id := primitive.NewObjectID()
+		err := appointments.Insert(ctx, models.Appointment{ID: id, Client: client.Public(), Provider: tech.Public(), Status: status, Start: start, End: end})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	ended := insert(models.StatusInProgress, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	legacy := insert(models.StatusScheduled, now.Add(-2*time.Hour), now)
+	running := insert(models.StatusInProgress, now.Add(-time.Hour), now.Add(time.Hour))
+	unanswered := insert(models.StatusRequested, now.Add(-time.Hour), now.Add(time.Hour))
+	requested := insert(models.StatusRequested, now.Add(time.Hour), now.Add(2*time.Hour))
+	accepted := insert(models.StatusAccepted, now.Add(-2*time.Hour), now.Add(-time.Hour))
+
+	if err := FinishEnded(appointments)(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExpireRequested(appointments)(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[primitive.ObjectID]string{
+		ended:      models.StatusCompleted,
+		legacy:     models.StatusCompleted,
+		running:    models.StatusInProgress,
+		unanswered: models.StatusRejected,
+		requested:  models.StatusRequested,
+		// The technician reports whether the client showed up
+		accepted: models.StatusAccepted,
+	}
+	for id, status := range expected {
+		appointment, err := appointments.FindByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if appointment.Status != status {
+			t.Errorf("Expected %s, got %s for the appointment starting %v", status, appointment.Status, appointment.Start)
+		}
+	}
+
+	rejected, _ := appointments.FindByID(ctx, unanswered)
+	if len(rejected.History) != 1 || rejected.History[0].By != models.BySystem || !rejected.History[0].At.Equal(now) {
+		t.Fatalf("Expected the expiry in the history, got %+v", rejected.History)
+	}
+
+	// Running the jobs again moves nothing else
+	if err := FinishEnded(appointments)(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	completed, _ := appointments.FindByID(ctx, ended)
+	if len(completed.History) != 1 {
+		t.Fatalf("Expected the appointment to finish once, got %+v", completed.History)
+	}
+
+	// Only the two finished appointments count as done, however many times they're counted
+	for i := 0; i < 2; i++ {
+		if err := CountCompleted(appointments, stores.Users)(ctx, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := CountDone(ctx, stores.Users, appointments, completed); err != nil {
+		t.Fatal(err)
+	}
+	for _, email := range []string{client.Email, tech.Email} {
+		user, _ := stores.Users.FindByEmail(ctx, email)
+		if user.Role[0].ServicesDone != 2 {
+			t.Errorf("Expected %s to have 2 services done, got %+v", email, user.Role)
+		}
+	}
+	uncounted, _ := appointments.Find(ctx, store.AppointmentQuery{Uncounted: true})
+	if len(uncounted) != 0 {
+		t.Errorf("Expected every completed appointment to be marked counted, got %d left", len(uncounted))
+	}
+}
+
+func TestCountCompletedRetriesAFailedCount(t *testing.T) {
+	ctx := context.Background()
+	stores := store.NewMemoryStores()
+	now := time.Date(2030, 6, 3, 12, 0, 0, 0, time.UTC)
+
+	// The technician completed it, but counting it failed then
+	tech := models.User{ID: primitive.NewObjectID(), Email: "tech@example.com", Role: []models.Role{{Name: models.RoleTech}}}
+	if err := stores.Users.UpsertByEmail(ctx, tech); err != nil {
+		t.Fatal(err)
+	}
+	id := primitive.NewObjectID()
+	err := stores.Appointments.Insert(ctx, models.Appointment{ID: id, Provider: tech.Public(), Status: models.StatusInProgress, Start: now.Add(-2 * time.Hour), End: now.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	change := models.StatusChange{From: models.StatusInProgress, To: models.StatusCompleted, At: now, By: models.ByProvider}
+	if _, err := stores.Appointments.Transition(ctx, id, change); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CountCompleted(stores.Appointments, stores.Users)(ctx, now); err != nil {
+		t.Fatal(err)
+	}
+	user, _ := stores.Users.FindByEmail(ctx, tech.Email)
+	if user.Role[0].ServicesDone != 1 {
+		t.Fatalf("Expected the job to count the completed appointment, got %+v", user.Role)
+	}
+}
@@ -0,0 +1,71 @@
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// maxRequestIDLength caps the X-Request-ID accepted from clients
+const maxRequestIDLength = 128
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+// validRequestID accepts IDs of printable ASCII so they can't forge log lines
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return template
+		}
+	}
+	return r.URL.Path
+}
+
+// Middleware gives every request an ID, taken from X-Request-ID when the client sends a valid one,
+// returns it in the response and logs the request once served
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := WithRequestID(r.Context(), id)
+		recorder := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		req := ctx.Value(requestKey{}).(*request)
+		slog.InfoContext(ctx, "request",
+			"method", r.Method,
+			"route", routeTemplate(r),
+			"status", recorder.code,
+			"duration", time.Since(start),
+			"user_id", req.userID,
+		)
+	})
+}
@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(New(&logs, slog.LevelInfo))
+
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
+		SetUser(r.Context(), "user-id")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/210422113", nil)
+	req.Header.Set("X-Request-ID", "abc-123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Header().Get("X-Request-ID") != "abc-123" {
+		t.Errorf("Expected the client's request ID to be kept, got %q", w.Header().Get("X-Request-ID"))
+	}
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("Expected one JSON log line, got %q", logs.String())
+	}
+	if line["request_id"] != "abc-123" || line["route"] != "/api/v1/mb/users/{nif}" || line["status"] != float64(http.StatusTeapot) || line["user_id"] != "user-id" {
+		t.Errorf("Unexpected log line %v", line)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/210422113", nil)
+	req.Header.Set("X-Request-ID", "forged\nline")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if id := w.Header().Get("X-Request-ID"); id == "" || id == "forged\nline" {
+		t.Errorf("Expected a new request ID for an invalid one, got %q", id)
+	}
+}
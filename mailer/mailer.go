@@ -0,0 +1,104 @@
+package mailer
+
+import (
+	"PSbackend/metrics"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+)
+
+// Attachment is a file sent along with an email
+type Attachment struct {
+	Filename string
+	Type     string
+	Content  []byte
+}
+
+// Message is an email sent by FixFinder
+type Message struct {
+	ToName      string
+	To          string
+	Subject     string
+	PlainText   string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SendGrid sends emails through the SendGrid API
+type SendGrid struct {
+	FromName string
+	From     string
+	APIKey   string
+}
+
+// NewSendGrid returns a mailer that sends emails from the FixFinder address with the given API key
+func NewSendGrid(from, apiKey string) SendGrid {
+	return SendGrid{FromName: "FixFinder", From: from, APIKey: apiKey}
+}
+
+// Send sends a message, failing when SendGrid doesn't accept it
+func (s SendGrid) Send(ctx context.Context, message Message) error {
+	from := mail.NewEmail(s.FromName, s.From)
+	to := mail.NewEmail(message.ToName, message.To)
+	email := mail.NewSingleEmail(from, message.Subject, to, message.PlainText, message.HTML)
+	for _, file := range message.Attachments {
+		attachment := mail.NewAttachment()
+		attachment.SetContent(base64.StdEncoding.EncodeToString(file.Content))
+		attachment.SetType(file.Type)
+		attachment.SetFilename(file.Filename)
+		attachment.SetDisposition("attachment")
+		email.AddAttachment(attachment)
+	}
+
+	err := s.send(ctx, email)
+	metrics.EmailsSent.WithLabelValues(metrics.Result(err)).Inc()
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to send email", "provider", "sendgrid", "error", err)
+		return err
+	}
+	slog.InfoContext(ctx, "Sent email", "provider", "sendgrid", "attachments", len(message.Attachments))
+	return nil
+}
+
+func (s SendGrid) send(ctx context.Context, email *mail.SGMailV3) error {
+	response, err := sendgrid.NewSendClient(s.APIKey).SendWithContext(ctx, email)
+	if err != nil {
+		return err
+	}
+
+	if response.StatusCode >= 400 {
+		return fmt.Errorf("Failed to send email, status code: %d", response.StatusCode)
+	}
+	return nil
+}
+
+// Memory keeps the messages it's asked to send instead of sending them, for tests
+type Memory struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+// Send records a message
+func (m *Memory) Send(ctx context.Context, message Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+// Sent returns the messages recorded so far
+func (m *Memory) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.messages...)
+}
@@ -1,16 +1,25 @@
 package main
 
 import (
+	"PSbackend/auth"
+	"PSbackend/background"
 	"PSbackend/config"
+	"PSbackend/deadline"
+	"PSbackend/lifecycle"
+	"PSbackend/logging"
+	"PSbackend/mailer"
+	"PSbackend/metrics"
+	"PSbackend/ratelimit"
 	"PSbackend/routes"
+	"PSbackend/store"
 	"context"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
 	"github.com/gorilla/mux"
-	"github.com/joho/godotenv"
 )
 
 var allowedOrigins = map[string]bool{
@@ -36,46 +45,147 @@ func corsMiddleware(next http.Handler) http.Handler {
 }
 
 func main() {
+	// Load the configuration from the environment, an optional file and the flags
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+	auth.SetSecret(cfg.JWTSecret)
+
+	// Log as JSON, tagging the lines of each request with its ID
+	slog.SetDefault(logging.New(os.Stdout, cfg.LogLevel))
+
 	// Create context with timeout for connecting to MongoDB
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
-	// Load environment variables from .env file
-	err := godotenv.Load()
+	// Initialize the MongoDB connection
+	client, err := config.ConnectDB(ctx, cfg.MongoURI)
 	if err != nil {
-		log.Fatal("Error loading .env file")
-		return
+		slog.Error("Error connecting to mongodb", "error", err)
+		os.Exit(1)
 	}
 
-	// Initialize the MongoDB connection
-	client, err := config.ConnectDB(ctx, os.Getenv("MONGO_URI"))
+	err = config.TestConnection(ctx, *client)
 	if err != nil {
-		log.Fatal("Error connecting to mongodb:", err)
-		return
+		slog.Error("Error testing connection with mongodb", "error", err)
+		os.Exit(1)
 	}
 
-	err = config.TestConnection(ctx, *client)
+	slog.Info("Connected and Tested MongoDB with success")
+
+	// Create the indexes the stores rely on, such as the unique slot index that prevents double bookings
+	err = store.EnsureIndexes(ctx, client.Database(cfg.DBName), cfg.Collections)
 	if err != nil {
-		log.Fatal("Error testing connection with mongodb:", err)
-		return
+		slog.Error("Error creating mongodb indexes", "error", err)
+		os.Exit(1)
 	}
 
-	log.Println("Connected and Tested MongoDB with success")
+	// Access the collections through the stores and send emails through SendGrid
+	stores := store.NewMongoStores(client.Database(cfg.DBName), cfg.Collections)
+	mail := mailer.NewSendGrid(cfg.FromEmail, cfg.SendGridAPIKey)
 
 	// Initialize Gorilla Mux router
 	router := mux.NewRouter()
 
+	// Take the client address from the trusted reverse proxies, when they're configured
+	router.Use(ratelimit.TrustProxies(cfg.Proxies))
+
+	// Give every request an ID and log it once served
+	router.Use(logging.Middleware)
+
+	// Count and time every request by route template
+	router.Use(metrics.Middleware)
+
+	// Cancel the work of a request when its client disconnects or its route runs out of time
+	router.Use(deadline.Middleware(cfg.Timeouts))
+
+	// Require a valid access token of a live session on every route that isn't public
+	router.Use(auth.Middleware(stores.Sessions))
+
 	// Register user-related routes
-	routes.UserRoutes(client, os.Getenv("DB_NAME"), os.Getenv("USER_COLLECTION"), router)
+	var jobs background.Group
+	routes.UserRoutes(cfg, stores, mail, &jobs, router)
 
 	// Register service-related routes
-	routes.ServiceRoutes(client, os.Getenv("DB_NAME"), os.Getenv("SERVICE_COLLECTION"), os.Getenv("USER_COLLECTION"), router)
+	routes.ServiceRoutes(cfg, stores, router)
 
-	log.Println("Starting the http server at port :8080")
-	// Start the HTTP server on port 8080
-	err = http.ListenAndServe(":8080", corsMiddleware(router))
+	// Register health and readiness routes
+	routes.HealthRoutes(client, cfg, router)
+
+	server := &http.Server{
+		Addr:         cfg.Addr(),
+		Handler:      corsMiddleware(router),
+		ReadTimeout:  cfg.Server.Read,
+		WriteTimeout: cfg.Server.Write,
+		IdleTimeout:  cfg.Server.Idle,
+	}
+
+	// Serve the metrics on a listener of their own, kept off the public one
+	metricsRouter := mux.NewRouter()
+	routes.MetricsRoutes(metricsRouter)
+	metricsServer := &http.Server{
+		Addr:         cfg.MetricsAddr,
+		Handler:      metricsRouter,
+		ReadTimeout:  cfg.Server.Read,
+		WriteTimeout: cfg.Server.Write,
+		IdleTimeout:  cfg.Server.Idle,
+	}
+
+	// Stop on SIGINT or SIGTERM
+	signals, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
+
+	// Move the appointments along on time, such as finishing the ones that ended, on one replica at a time
+	scheduler := background.NewScheduler(stores.Locks, background.SystemClock{}, cfg.JobInterval)
+	scheduler.Add("finish-appointments", lifecycle.FinishEnded(stores.Appointments))
+	scheduler.Add("count-completed", lifecycle.CountCompleted(stores.Appointments, stores.Users))
+	scheduler.Add("expire-requests", lifecycle.ExpireRequested(stores.Appointments))
+	jobs.Go(func() { scheduler.Run(signals) })
+
+	slog.Info("Starting the http server", "addr", cfg.Addr(), "metrics_addr", cfg.MetricsAddr)
+	// Start the HTTP servers on the configured addresses
+	serverErr := make(chan error, 2)
+	go func() {
+		serverErr <- server.ListenAndServe()
+	}()
+	go func() {
+		serverErr <- metricsServer.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serverErr:
+		slog.Error("Error starting the http server", "error", err)
+		os.Exit(1)
+	case <-signals.Done():
+	}
+
+	slog.Info("Shutting down the http server")
+	shutdown, cancelShutdown := context.WithTimeout(context.Background(), cfg.Server.Shutdown)
+	defer cancelShutdown()
+
+	// Drain the requests in flight, then wait for the jobs they started, such as invoice emails, and for the
+	// scheduler to give up its lock
+	err = server.Shutdown(shutdown)
 	if err != nil {
-		log.Fatal("Error starting the http server:", err)
-		return
+		slog.Error("Error shutting down the http server", "error", err)
 	}
+
+	err = metricsServer.Shutdown(shutdown)
+	if err != nil {
+		slog.Error("Error shutting down the metrics server", "error", err)
+	}
+
+	err = jobs.Wait(shutdown)
+	if err != nil {
+		slog.Error("Error waiting for background jobs", "error", err)
+	}
+
+	err = client.Disconnect(shutdown)
+	if err != nil {
+		slog.Error("Error disconnecting from mongodb", "error", err)
+	}
+
+	slog.Info("Stopped the http server")
 }
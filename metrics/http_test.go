@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMiddleware(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(Middleware)
+	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "User not found", http.StatusNotFound)
+	})
+
+	for _, nif := range []string{"210422113", "123456789"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/v1/mb/users/"+nif, nil))
+	}
+
+	count := testutil.ToFloat64(HTTPRequests.WithLabelValues("/api/v1/mb/users/{nif}", http.MethodGet, "404"))
+	if count != 2 {
+		t.Fatalf("Expected 2 requests counted under the route template, got %v", count)
+	}
+}
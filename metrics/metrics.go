@@ -0,0 +1,68 @@
+// Package metrics exposes Prometheus metrics for the HTTP API, MongoDB, emails and invoices.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// HTTPRequests counts the requests served, by route template, method and status code
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fixfinder_http_requests_total",
+		Help: "HTTP requests served, by route template, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPDuration measures how long requests take, by route template and method
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fixfinder_http_request_duration_seconds",
+		Help:    "Time spent serving HTTP requests, by route template and method.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	// MongoDuration measures MongoDB commands, by collection and command
+	MongoDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "fixfinder_mongo_operation_duration_seconds",
+		Help:    "Time spent on MongoDB commands, by collection and command.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"collection", "operation"})
+
+	// MongoErrors counts failed MongoDB commands, by collection and command
+	MongoErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fixfinder_mongo_operation_errors_total",
+		Help: "Failed MongoDB commands, by collection and command.",
+	}, []string{"collection", "operation"})
+
+	// EmailsSent counts emails handed to the mail provider, by result
+	EmailsSent = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "fixfinder_emails_sent_total",
+		Help: "Emails sent through the mail provider, by result (success or failure).",
+	}, []string{"result"})
+
+	// InvoiceDuration measures how long an invoice takes to draw and email
+	InvoiceDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "fixfinder_invoice_generation_duration_seconds",
+		Help:    "Time spent drawing and emailing an invoice.",
+		Buckets: prometheus.DefBuckets,
+	})
+
+	// AppointmentsCreated counts the appointments booked
+	AppointmentsCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fixfinder_appointments_created_total",
+		Help: "Appointments created.",
+	})
+
+	// FeesPaid counts the fees marked as paid
+	FeesPaid = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "fixfinder_fees_paid_total",
+		Help: "Fees paid.",
+	})
+)
+
+// Result labels an operation as a success or a failure
+func Result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
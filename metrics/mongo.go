@@ -0,0 +1,38 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+)
+
+// NewMongoMonitor times every MongoDB command and counts the failed ones, by collection and command
+func NewMongoMonitor() *event.CommandMonitor {
+	// The collection is only known when a command starts, so it's kept until the command ends
+	var collections sync.Map
+
+	finished := func(requestID int64) string {
+		collection, ok := collections.LoadAndDelete(requestID)
+		if !ok {
+			return ""
+		}
+		return collection.(string)
+	}
+
+	return &event.CommandMonitor{
+		Started: func(ctx context.Context, e *event.CommandStartedEvent) {
+			collection, _ := e.Command.Lookup(e.CommandName).StringValueOK()
+			collections.Store(e.RequestID, collection)
+		},
+		Succeeded: func(ctx context.Context, e *event.CommandSucceededEvent) {
+			collection := finished(e.RequestID)
+			MongoDuration.WithLabelValues(collection, e.CommandName).Observe(e.Duration.Seconds())
+		},
+		Failed: func(ctx context.Context, e *event.CommandFailedEvent) {
+			collection := finished(e.RequestID)
+			MongoDuration.WithLabelValues(collection, e.CommandName).Observe(e.Duration.Seconds())
+			MongoErrors.WithLabelValues(collection, e.CommandName).Inc()
+		},
+	}
+}
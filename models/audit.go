@@ -0,0 +1,46 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions recorded in the audit log
+const (
+	AuditUserActiveChanged   = "user.active_changed"
+	AuditUserBlockChanged    = "user.block_changed"
+	AuditUserDeleted         = "user.deleted"
+	AuditUserRoleChanged     = "user.role_changed"
+	AuditFeeCreated          = "fee.created"
+	AuditFeePaid             = "fee.paid"
+	AuditServiceTypeDeleted  = "service_type.deleted"
+	AuditAppointmentCanceled = "appointment.canceled"
+	AuditAppointmentMoved    = "appointment.status_changed"
+)
+
+// AuditEntry is an append-only record of who changed what, and how
+type AuditEntry struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	At         time.Time          `json:"at" bson:"at"`
+	ActorID    string             `json:"actor_id" bson:"actor_id"`
+	ActorNIF   int                `json:"actor_nif" bson:"actor_nif"`
+	ActorRoles []string           `json:"actor_roles" bson:"actor_roles"`
+	Action     string             `json:"action" bson:"action"`
+	TargetType string             `json:"target_type" bson:"target_type"`
+	TargetID   string             `json:"target_id" bson:"target_id"`
+	Before     bson.M             `json:"before,omitempty" bson:"before,omitempty"`
+	After      bson.M             `json:"after,omitempty" bson:"after,omitempty"`
+	Request    AuditRequest       `json:"request" bson:"request"`
+}
+
+// AuditRequest describes the HTTP request that performed an audited action
+type AuditRequest struct {
+	// ID is the request ID its logs are tagged with
+	ID        string `json:"id" bson:"id"`
+	Method    string `json:"method" bson:"method"`
+	Path      string `json:"path" bson:"path"`
+	IP        string `json:"ip" bson:"ip"`
+	UserAgent string `json:"user_agent" bson:"user_agent"`
+}
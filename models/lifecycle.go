@@ -0,0 +1,120 @@
+package models
+
+import "time"
+
+// Statuses of an appointment
+const (
+	StatusRequested          = "REQUESTED"
+	StatusAccepted           = "ACCEPTED"
+	StatusRejected           = "REJECTED"
+	StatusInProgress         = "IN_PROGRESS"
+	StatusCompleted          = "COMPLETED"
+	StatusCanceledByClient   = "CANCELED_BY_CLIENT"
+	StatusCanceledByProvider = "CANCELED_BY_PROVIDER"
+	StatusNoShow             = "NO_SHOW"
+)
+
+// Statuses written by older versions: a SCHEDULED appointment moves on like an ACCEPTED one, and a
+// CANCELED one is closed
+const (
+	StatusScheduled = "SCHEDULED"
+	StatusCanceled  = "CANCELED"
+)
+
+// HoldingStatuses are the statuses of the appointments that keep their technician busy
+var HoldingStatuses = []string{StatusRequested, StatusAccepted, StatusScheduled, StatusInProgress}
+
+// ClosedStatuses are the statuses of the appointments that can't move anymore, see IsClosed
+var ClosedStatuses = []string{
+	StatusRejected, StatusCompleted, StatusCanceledByClient, StatusCanceledByProvider, StatusNoShow, StatusCanceled,
+}
+
+// Parties that move an appointment from one status to another
+const (
+	ByClient   = "client"
+	ByProvider = "provider"
+	ByAdmin    = "admin"
+	BySystem   = "system"
+)
+
+// Actions that move an appointment from one status to another
+const (
+	ActionAccept   = "accept"
+	ActionReject   = "reject"
+	ActionStart    = "start"
+	ActionComplete = "complete"
+	ActionCancel   = "cancel"
+	ActionNoShow   = "no-show"
+	ActionFinish   = "finish"
+	ActionExpire   = "expire"
+)
+
+// Transition is an action some parties can take to move an appointment from one of the From statuses to To
+type Transition struct {
+	Action string
+	From   []string
+	To     string
+	By     []string
+	// AfterStart is set when the action can't be taken before the appointment starts
+	AfterStart bool
+}
+
+// Transitions are every move an appointment can make; an action can lead to a different status depending
+// on who takes it, as canceling does
+var Transitions = []Transition{
+	{Action: ActionAccept, From: []string{StatusRequested}, To: StatusAccepted, By: []string{ByProvider, ByAdmin}},
+	{Action: ActionReject, From: []string{StatusRequested}, To: StatusRejected, By: []string{ByProvider, ByAdmin}},
+	{Action: ActionStart, From: []string{StatusAccepted, StatusScheduled}, To: StatusInProgress, By: []string{ByProvider}},
+	{Action: ActionComplete, From: []string{StatusInProgress}, To: StatusCompleted, By: []string{ByProvider, ByAdmin}},
+	{Action: ActionCancel, From: []string{StatusRequested, StatusAccepted, StatusScheduled}, To: StatusCanceledByClient, By: []string{ByClient}},
+	{Action: ActionCancel, From: []string{StatusRequested, StatusAccepted, StatusScheduled}, To: StatusCanceledByProvider, By: []string{ByProvider, ByAdmin}},
+	{Action: ActionNoShow, From: []string{StatusAccepted, StatusScheduled}, To: StatusNoShow, By: []string{ByProvider, ByAdmin}, AfterStart: true},
+	// Appointments that ended while in progress, or booked by older versions, are completed on their own
+	{Action: ActionFinish, From: []string{StatusInProgress, StatusScheduled}, To: StatusCompleted, By: []string{BySystem}},
+	// Requests the technician didn't answer before the appointment started are rejected on their own
+	{Action: ActionExpire, From: []string{StatusRequested}, To: StatusRejected, By: []string{BySystem}},
+}
+
+// StatusChange is one move of an appointment, kept in its history
+type StatusChange struct {
+	From   string    `json:"from,omitempty" bson:"from,omitempty"`
+	To     string    `json:"to" bson:"to"`
+	At     time.Time `json:"at" bson:"at"`
+	By     string    `json:"by" bson:"by"`
+	UserID string    `json:"user_id,omitempty" bson:"user_id,omitempty"`
+	Reason string    `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// FindTransition returns the transition a party takes with an action; ok is false when the party can't take it
+func FindTransition(action, party string) (Transition, bool) {
+	for _, transition := range Transitions {
+		if transition.Action == action && contains(transition.By, party) {
+			return transition, true
+		}
+	}
+	return Transition{}, false
+}
+
+// Leaves reports whether the transition can be taken from status
+func (t Transition) Leaves(status string) bool {
+	return contains(t.From, status)
+}
+
+// IsClosed reports whether the appointment can't move anymore, other than by the system
+func (a Appointment) IsClosed() bool {
+	for _, transition := range Transitions {
+		if transition.Leaves(a.Status) && !contains(transition.By, BySystem) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// Lock is held by the replica running a background job until ExpiresAt, unless it renews it
+type Lock struct {
+	Name      string    `bson:"_id"`
+	Owner     string    `bson:"owner"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
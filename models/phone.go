@@ -0,0 +1,49 @@
+package models
+
+import (
+	"PSbackend/validate"
+	"fmt"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Phone is a phone number in E.164, such as +351912345678
+type Phone string
+
+// UnmarshalBSONValue also reads the phones older versions stored as integers, which were Portuguese
+func (p *Phone) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+
+	var legacy int64
+	switch t {
+	case bsontype.String:
+		*p = Phone(raw.StringValue())
+		return nil
+	case bsontype.Null, bsontype.Undefined:
+		*p = ""
+		return nil
+	case bsontype.Int32:
+		legacy = int64(raw.Int32())
+	case bsontype.Int64:
+		legacy = raw.Int64()
+	case bsontype.Double:
+		legacy = int64(raw.Double())
+	default:
+		return fmt.Errorf("can't decode a BSON %s into a phone", t)
+	}
+
+	if legacy == 0 {
+		*p = ""
+		return nil
+	}
+	digits := strconv.FormatInt(legacy, 10)
+	normalized, err := validate.Phone(digits)
+	if err != nil {
+		*p = Phone(digits)
+		return nil
+	}
+	*p = Phone(normalized)
+	return nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPhoneReadsLegacyIntegers(t *testing.T) {
+	tests := []struct {
+		stored   interface{}
+		expected Phone
+	}{
+		{int32(912345678), "+351912345678"},
+		{int64(912345678), "+351912345678"},
+		{"+442079460958", "+442079460958"},
+		{int32(0), ""},
+		{int32(1234), "1234"},
+	}
+
+	for _, tt := range tests {
+		raw, err := bson.Marshal(bson.M{"phone": tt.stored})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var user User
+		if err := bson.Unmarshal(raw, &user); err != nil {
+			t.Fatalf("Decoding %v: %v", tt.stored, err)
+		}
+		if user.Phone != tt.expected {
+			t.Errorf("Expected %v to be read as %q, got %q", tt.stored, tt.expected, user.Phone)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sensitive lists the fields and values that must never appear in a response
+var sensitive = []string{`"password"`, `"recovery_code"`, `"verification_code"`, "plaintext-secret", "$2a$10$hash"}
+
+func assertNoCredentials(t *testing.T, name string, v interface{}) {
+	t.Helper()
+	body, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("%s: marshal returned error: %v", name, err)
+	}
+	for _, needle := range sensitive {
+		if strings.Contains(string(body), needle) {
+			t.Errorf("%s: response contains %s: %s", name, needle, body)
+		}
+	}
+}
+
+func TestPublicRepresentationsHideCredentials(t *testing.T) {
+	user := User{
+		ID:           primitive.NewObjectID(),
+		Name:         "John Doe",
+		Password:     "plaintext-secret",
+		NIF:          210422113,
+		Email:        "john@example.com",
+		Role:         []Role{{Name: RoleClient}},
+		Verification: &VerificationCode{Hash: "$2a$10$hash", ExpiresAt: time.Now()},
+	}
+	provider := user
+	provider.Password = "$2a$10$hash"
+	appointment := Appointment{ID: primitive.NewObjectID(), Provider: provider.Public(), Client: user.Public()}
+
+	assertNoCredentials(t, "user", user.Public())
+	assertNoCredentials(t, "users", PublicUsers([]User{user, provider}))
+	assertNoCredentials(t, "appointment", appointment.Public())
+	assertNoCredentials(t, "appointments", PublicAppointments([]Appointment{appointment}))
+
+	if got := user.Public(); got.Email != user.Email || got.NIF != user.NIF || len(got.Role) != 1 {
+		t.Errorf("Public user lost fields: %+v", got)
+	}
+	if PublicUsers(nil) != nil || PublicAppointments(nil) != nil {
+		t.Error("Expected nil lists to stay nil")
+	}
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"PSbackend/validate"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Schedule is when a technician works, with the times of day read in the IANA time zone Zone
+type Schedule struct {
+	Zone string `json:"zone" bson:"zone" validate:"required,timezone"`
+	// Week holds the working hours of each day of the week; a day left out is a day off
+	Week []WorkingDay `json:"week" bson:"week" validate:"max=7"`
+	// Exceptions replace the working hours of the week on some dates
+	Exceptions []ScheduleException `json:"exceptions" bson:"exceptions" validate:"max=366"`
+	// TimeOff are periods the technician doesn't work in, whatever the working hours say
+	TimeOff []TimeOff `json:"time_off" bson:"time_off" validate:"max=100"`
+}
+
+// Interval is a period of a day written as times of day such as 09:00 and 13:00, or 24:00 for the end of the day
+type Interval struct {
+	Start string `json:"start" bson:"start" validate:"required,clock"`
+	End   string `json:"end" bson:"end" validate:"required,clock,gtfield=start"`
+}
+
+// WorkingDay is when a technician works on a day of the week, such as monday
+type WorkingDay struct {
+	Day    string     `json:"day" bson:"day" validate:"required,oneof=monday tuesday wednesday thursday friday saturday sunday"`
+	Hours  []Interval `json:"hours" bson:"hours" validate:"max=8"`
+	Breaks []Interval `json:"breaks" bson:"breaks" validate:"max=8"`
+}
+
+// ScheduleException is when a technician works on a date such as 2024-12-24; without hours it's a day off
+type ScheduleException struct {
+	Date   string     `json:"date" bson:"date" validate:"required,date"`
+	Hours  []Interval `json:"hours" bson:"hours" validate:"max=8"`
+	Breaks []Interval `json:"breaks" bson:"breaks" validate:"max=8"`
+}
+
+// TimeOff is a period, such as a holiday, in which a technician can't be booked
+type TimeOff struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id"`
+	Start  time.Time          `json:"start" bson:"start"`
+	End    time.Time          `json:"end" bson:"end"`
+	Reason string             `json:"reason,omitempty" bson:"reason,omitempty"`
+}
+
+// Period is a stretch of time a technician works in
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// zones caches the time zones schedules are read in, by name
+var zones sync.Map
+
+// Location is the time zone of the schedule, or UTC when it can't be loaded
+func (s Schedule) Location() *time.Location {
+	if zone, ok := zones.Load(s.Zone); ok {
+		return zone.(*time.Location)
+	}
+	zone, err := validate.TimeZone(s.Zone)
+	if err != nil {
+		return time.UTC
+	}
+	zones.Store(s.Zone, zone)
+	return zone
+}
+
+// day returns the working hours and breaks of the date holding midnight
+func (s Schedule) day(midnight time.Time) ([]Interval, []Interval) {
+	date := midnight.Format(time.DateOnly)
+	for _, exception := range s.Exceptions {
+		if exception.Date == date {
+			return exception.Hours, exception.Breaks
+		}
+	}
+	weekday := strings.ToLower(midnight.Weekday().String())
+	for _, day := range s.Week {
+		if day.Day == weekday {
+			return day.Hours, day.Breaks
+		}
+	}
+	return nil, nil
+}
+
+// at is the time of day clock on the date holding midnight, built from the wall clock so it stays right on
+// the days daylight saving time starts or ends
+func at(midnight time.Time, clock string) time.Time {
+	since, _ := validate.Clock(clock)
+	year, month, day := midnight.Date()
+	return time.Date(year, month, day, int(since/time.Hour), int(since%time.Hour/time.Minute), 0, 0, midnight.Location())
+}
+
+// Periods returns the periods the technician works in that overlap from to to, without their breaks and
+// time off; periods that follow each other, such as across midnight, are joined
+func (s Schedule) Periods(from, to time.Time) []Period {
+	zone := s.Location()
+	var periods []Period
+
+	// Start the day before, whose hours may run until midnight and join the first ones
+	year, month, day := from.In(zone).Date()
+	for midnight := time.Date(year, month, day-1, 0, 0, 0, 0, zone); midnight.Before(to); {
+		hours, breaks := s.day(midnight)
+		for _, interval := range hours {
+			worked := []Period{{Start: at(midnight, interval.Start), End: at(midnight, interval.End)}}
+			for _, pause := range breaks {
+				worked = subtract(worked, Period{Start: at(midnight, pause.Start), End: at(midnight, pause.End)})
+			}
+			periods = append(periods, worked...)
+		}
+		year, month, day := midnight.Date()
+		midnight = time.Date(year, month, day+1, 0, 0, 0, 0, zone)
+	}
+
+	for _, off := range s.TimeOff {
+		periods = subtract(periods, Period{Start: off.Start, End: off.End})
+	}
+
+	sort.Slice(periods, func(i, j int) bool { return periods[i].Start.Before(periods[j].Start) })
+	joined := make([]Period, 0, len(periods))
+	for _, period := range periods {
+		if last := len(joined) - 1; last >= 0 && !period.Start.After(joined[last].End) {
+			if period.End.After(joined[last].End) {
+				joined[last].End = period.End
+			}
+			continue
+		}
+		joined = append(joined, period)
+	}
+
+	overlapping := make([]Period, 0, len(joined))
+	for _, period := range joined {
+		if period.End.After(from) && period.Start.Before(to) {
+			overlapping = append(overlapping, period)
+		}
+	}
+	return overlapping
+}
+
+// subtract removes cut from each of the periods
+func subtract(periods []Period, cut Period) []Period {
+	var left []Period
+	for _, period := range periods {
+		if !cut.Start.Before(period.End) || !cut.End.After(period.Start) {
+			left = append(left, period)
+			continue
+		}
+		if period.Start.Before(cut.Start) {
+			left = append(left, Period{Start: period.Start, End: cut.Start})
+		}
+		if cut.End.Before(period.End) {
+			left = append(left, Period{Start: cut.End, End: period.End})
+		}
+	}
+	return left
+}
+
+// Weekdays are the days a WorkingDay can name, starting on monday
+var Weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// AllDay is a schedule working every hour of every day in zone
+func AllDay(zone *time.Location) Schedule {
+	return Weekly(zone, Interval{Start: "00:00", End: "24:00"})
+}
+
+// Weekly is a schedule working the same hours every day of the week in zone
+func Weekly(zone *time.Location, hours ...Interval) Schedule {
+	schedule := Schedule{Zone: zone.String()}
+	for _, day := range Weekdays {
+		schedule.Week = append(schedule.Week, WorkingDay{Day: day, Hours: hours})
+	}
+	return schedule
+}
+
+// LegacySchedule converts the working hours older versions kept in WorkStart and WorkEnd into a schedule
+// of the same hours every day, reading their times of day in zone; ok is false when they aren't set
+func (u User) LegacySchedule(zone *time.Location) (Schedule, bool) {
+	if u.WorkStart.IsZero() || u.WorkEnd.IsZero() {
+		return Schedule{}, false
+	}
+	if zone == nil {
+		zone = time.UTC
+	}
+	start := u.WorkStart.In(zone).Format("15:04")
+	end := u.WorkEnd.In(zone).Format("15:04")
+	if end == "00:00" {
+		end = "24:00"
+	}
+	if end > start {
+		return Weekly(zone, Interval{Start: start, End: end}), true
+	}
+	// The hours run past midnight
+	return Weekly(zone, Interval{Start: "00:00", End: end}, Interval{Start: start, End: "24:00"}), true
+}
+
+// WorkingSchedule is the schedule of the user, else the one converted from WorkStart and WorkEnd, else a
+// schedule working all day; zone is the time zone of the last two
+func (u User) WorkingSchedule(zone *time.Location) Schedule {
+	if u.Schedule != nil {
+		return *u.Schedule
+	}
+	if schedule, ok := u.LegacySchedule(zone); ok {
+		return schedule
+	}
+	return AllDay(zone)
+}
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func lisbon(t *testing.T, value string) time.Time {
+	t.Helper()
+	zone, err := time.LoadLocation("Europe/Lisbon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := time.ParseInLocation("2006-01-02 15:04", value, zone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func assertPeriods(t *testing.T, name string, periods []Period, expected ...time.Time) {
+	t.Helper()
+	if len(periods)*2 != len(expected) {
+		t.Fatalf("%s: expected %d periods, got %v", name, len(expected)/2, periods)
+	}
+	for i, period := range periods {
+		if !period.Start.Equal(expected[2*i]) || !period.End.Equal(expected[2*i+1]) {
+			t.Errorf("%s: expected period %d from %v to %v, got %v", name, i, expected[2*i], expected[2*i+1], period)
+		}
+	}
+}
+
+func TestSchedulePeriods(t *testing.T) {
+	weekday := WorkingDay{Hours: []Interval{{"09:00", "18:00"}}, Breaks: []Interval{{"13:00", "14:00"}}}
+	schedule := Schedule{
+		Zone: "Europe/Lisbon",
+		Week: []WorkingDay{
+			{Day: "monday", Hours: weekday.Hours, Breaks: weekday.Breaks},
+			{Day: "tuesday", Hours: weekday.Hours, Breaks: weekday.Breaks},
+			{Day: "saturday", Hours: []Interval{{"09:00", "13:00"}}},
+			{Day: "sunday", Hours: []Interval{{"22:00", "24:00"}}},
+		},
+		Exceptions: []ScheduleException{{Date: "2024-12-24"}},
+		TimeOff:    []TimeOff{{ID: primitive.NewObjectID(), Start: lisbon(t, "2024-12-31 16:00"), End: lisbon(t, "2025-01-01 00:00")}},
+	}
+
+	// Monday 23 and Tuesday 24 December 2024, the latter a day off
+	periods := schedule.Periods(lisbon(t, "2024-12-23 00:00"), lisbon(t, "2024-12-25 00:00"))
+	assertPeriods(t, "break", periods,
+		lisbon(t, "2024-12-23 09:00"), lisbon(t, "2024-12-23 13:00"),
+		lisbon(t, "2024-12-23 14:00"), lisbon(t, "2024-12-23 18:00"))
+
+	// Tuesday 31 December 2024, with time off from 16:00
+	periods = schedule.Periods(lisbon(t, "2024-12-31 00:00"), lisbon(t, "2025-01-01 00:00"))
+	assertPeriods(t, "time off", periods,
+		lisbon(t, "2024-12-31 09:00"), lisbon(t, "2024-12-31 13:00"),
+		lisbon(t, "2024-12-31 14:00"), lisbon(t, "2024-12-31 16:00"))
+
+	// Sunday 30 March 2025, when clocks go forward at 01:00, and the saturday before
+	periods = schedule.Periods(lisbon(t, "2025-03-29 12:00"), lisbon(t, "2025-03-31 00:00"))
+	assertPeriods(t, "daylight saving time", periods,
+		lisbon(t, "2025-03-29 09:00"), lisbon(t, "2025-03-29 13:00"),
+		lisbon(t, "2025-03-30 22:00"), lisbon(t, "2025-03-31 00:00"))
+	if periods[1].Start.UTC().Hour() != 21 {
+		t.Errorf("Expected 22:00 in summer time, got %v", periods[1].Start.UTC())
+	}
+}
+
+func TestWorkingSchedule(t *testing.T) {
+	zone, _ := time.LoadLocation("Europe/Lisbon")
+	summer := lisbon(t, "2025-07-01 00:00")
+
+	user := User{WorkStart: time.Date(2024, time.May, 1, 8, 0, 0, 0, time.UTC), WorkEnd: time.Date(2024, time.May, 1, 17, 0, 0, 0, time.UTC)}
+	periods := user.WorkingSchedule(zone).Periods(summer, summer.AddDate(0, 0, 1))
+	assertPeriods(t, "legacy", periods, lisbon(t, "2025-07-01 09:00"), lisbon(t, "2025-07-01 18:00"))
+
+	periods = User{}.WorkingSchedule(zone).Periods(summer, summer.AddDate(0, 0, 2))
+	if len(periods) != 1 || periods[0].End.Sub(periods[0].Start) < 48*time.Hour {
+		t.Errorf("Expected a user without working hours to work all day, got %v", periods)
+	}
+
+	own := Weekly(time.UTC, Interval{"10:00", "11:00"})
+	user.Schedule = &own
+	periods = user.WorkingSchedule(zone).Periods(summer, summer.AddDate(0, 0, 1))
+	assertPeriods(t, "own", periods, time.Date(2025, time.July, 1, 10, 0, 0, 0, time.UTC), time.Date(2025, time.July, 1, 11, 0, 0, 0, time.UTC))
+}
@@ -10,22 +10,27 @@ type ServiceType struct {
 	ID    primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Name  string             `json:"name,omitempty" bson:"name,omitempty"`
 	Price float64            `json:"priceHour,omitempty" bson:"priceHour,omitempty"`
+	// EmployeeID is the user ID of the technician offering a service; service types have none
+	EmployeeID string `json:"employee_id,omitempty" bson:"employee_id,omitempty"`
 }
 
 type Appointment struct {
 	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	ServiceName string             `json:"service_name" bson:"service_name,omitempty"`
-	Provider    User               `json:"provider,omitempty" bson:"provider,omitempty"`
-	Client      User               `json:"client,omitempty" bson:"client,omitempty"`
+	Provider    PublicUser         `json:"provider,omitempty" bson:"provider,omitempty"`
+	Client      PublicUser         `json:"client,omitempty" bson:"client,omitempty"`
 	Status      string             `json:"status,omitempty" bson:"status,omitempty"`
 	Start       time.Time          `json:"start,omitempty" bson:"start,omitempty"`
 	End         time.Time          `json:"end,omitempty" bson:"end,omitempty"`
-	Phone       int                `json:"phone" bson:"phone"`
+	Phone       Phone              `json:"phone" bson:"phone"`
 	NIF         int                `json:"nif" bson:"nif"`
 	Locality    string             `json:"locality" bson:"locality"`
 	Notes       string             `json:"notes" bson:"notes"`
 	PriceHour   float64            `json:"priceHour,omitempty" bson:"priceHour,omitempty"`
 	TotalPrice  float64            `json:"totalPrice,omitempty" bson:"totalPrice,omitempty"`
+	History     []StatusChange     `json:"history" bson:"history,omitempty"`
+	// Uncounted marks a completed appointment not counted yet as a service done by its client and technician
+	Uncounted bool `json:"-" bson:"uncounted,omitempty"`
 }
 
 type Review struct {
@@ -35,3 +40,97 @@ type Review struct {
 	Date       time.Time          `json:"date,omitempty" bson:"date,omitempty"`
 	Comment    string             `json:"comment,omitempty" bson:"comment,omitempty"`
 }
+
+// PublicAppointment is the representation of an appointment sent in API responses, without the credentials of its users
+type PublicAppointment struct {
+	ID          primitive.ObjectID `json:"id,omitempty"`
+	ServiceName string             `json:"service_name"`
+	Provider    PublicUser         `json:"provider,omitempty"`
+	Client      PublicUser         `json:"client,omitempty"`
+	Status      string             `json:"status,omitempty"`
+	Start       time.Time          `json:"start,omitempty"`
+	End         time.Time          `json:"end,omitempty"`
+	Phone       Phone              `json:"phone"`
+	NIF         int                `json:"nif"`
+	Locality    string             `json:"locality"`
+	Notes       string             `json:"notes"`
+	PriceHour   float64            `json:"priceHour,omitempty"`
+	TotalPrice  float64            `json:"totalPrice,omitempty"`
+	History     []StatusChange     `json:"history"`
+}
+
+// Public returns the appointment as sent in API responses
+func (a Appointment) Public() PublicAppointment {
+	return PublicAppointment{
+		ID:          a.ID,
+		ServiceName: a.ServiceName,
+		Provider:    a.Provider,
+		Client:      a.Client,
+		Status:      a.Status,
+		Start:       a.Start,
+		End:         a.End,
+		Phone:       a.Phone,
+		NIF:         a.NIF,
+		Locality:    a.Locality,
+		Notes:       a.Notes,
+		PriceHour:   a.PriceHour,
+		TotalPrice:  a.TotalPrice,
+		History:     a.History,
+	}
+}
+
+// PublicAppointments converts a list of appointments for an API response
+func PublicAppointments(appointments []Appointment) []PublicAppointment {
+	if appointments == nil {
+		return nil
+	}
+	public := make([]PublicAppointment, 0, len(appointments))
+	for _, appointment := range appointments {
+		public = append(public, appointment.Public())
+	}
+	return public
+}
+
+// SlotLength is the unit in which appointments reserve the time of a technician
+const SlotLength = 5 * time.Minute
+
+// Slots are the starts of the slots an appointment reserves, from the slot holding Start to the one holding
+// the instant before End plus buffer, the time the technician needs before taking another appointment
+func (a Appointment) Slots(buffer time.Duration) []time.Time {
+	var slots []time.Time
+	end := a.End.Add(buffer)
+	for slot := a.Start.UTC().Truncate(SlotLength); slot.Before(end); slot = slot.Add(SlotLength) {
+		slots = append(slots, slot)
+	}
+	return slots
+}
+
+// HoldsSlots reports whether the appointment still keeps the technician busy during its slots
+func (a Appointment) HoldsSlots() bool {
+	for _, status := range HoldingStatuses {
+		if a.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Overlaps reports whether two appointments, each followed by buffer, reserve a slot in common
+func (a Appointment) Overlaps(other Appointment, buffer time.Duration) bool {
+	slots := a.Slots(buffer)
+	theirs := other.Slots(buffer)
+	if len(slots) == 0 || len(theirs) == 0 {
+		return false
+	}
+	return slots[0].Before(theirs[len(theirs)-1].Add(SlotLength)) && theirs[0].Before(slots[len(slots)-1].Add(SlotLength))
+}
+
+// Reservation holds one slot of a technician for an appointment; a unique index on the provider and the
+// slot keeps two appointments from holding the same one, even when they're booked at the same time
+type Reservation struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty"`
+	ProviderID    primitive.ObjectID `bson:"provider_id"`
+	Slot          time.Time          `bson:"slot"`
+	AppointmentID primitive.ObjectID `bson:"appointment_id"`
+	ReservedAt    time.Time          `bson:"reserved_at"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a sign-in of a user on one device, renewed with a rotating refresh token
+type Session struct {
+	ID                primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID            primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Device            string             `json:"device" bson:"device"`
+	TokenHash         string             `json:"-" bson:"token_hash"`
+	PreviousTokenHash string             `json:"-" bson:"previous_token_hash,omitempty"`
+	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
+	LastUsedAt        time.Time          `json:"last_used_at" bson:"last_used_at"`
+	ExpiresAt         time.Time          `json:"expires_at" bson:"expires_at"`
+	Revoked           bool               `json:"revoked" bson:"revoked"`
+}
@@ -11,7 +11,7 @@ type User struct {
 	Name          string             `json:"name" bson:"name"`
 	Password      string             `json:"password" bson:"password"`
 	NIF           int                `json:"nif" bson:"nif"`
-	Phone         int                `json:"phone" bson:"phone"`
+	Phone         Phone              `json:"phone" bson:"phone"`
 	Email         string             `json:"email" bson:"email"`
 	Role          []Role             `json:"role" bson:"role"`
 	ServiceTypes  []ServiceType      `json:"service_types" bson:"service_types"`
@@ -20,11 +20,51 @@ type User struct {
 	BlockServices bool               `json:"block_services" bson:"block_services"`
 	IsActive      bool               `json:"is_active" bson:"is_active"`
 	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
-	RecoveryCode  int                `json:"recovery_code" bson:"recovery_code"`
+	Verification  *VerificationCode  `json:"-" bson:"verification_code,omitempty"`
 	WorkStart     time.Time          `json:"workStart" bson:"workStart"`
 	WorkEnd       time.Time          `json:"workEnd" bson:"workEnd"`
+	Schedule      *Schedule          `json:"-" bson:"schedule,omitempty"`
+	FailedLogins  int                `json:"-" bson:"failed_logins"`
+	LockedUntil   time.Time          `json:"-" bson:"locked_until"`
+	TwoFactor     *TwoFactor         `json:"-" bson:"two_factor,omitempty"`
+	// Counted holds the appointments already counted in the services done of the user's roles
+	Counted []primitive.ObjectID `json:"-" bson:"counted,omitempty"`
 }
 
+// Registered reports whether the user completed their registration, which gives them a NIF
+func (u User) Registered() bool {
+	return u.NIF != 0
+}
+
+// CanSignIn reports whether the user may log in or renew a session: they mustn't be deactivated; users who
+// haven't completed their registration aren't active yet, and sign in to complete it. Blocked users sign in too,
+// only the services are closed to them
+func (u User) CanSignIn() bool {
+	return u.IsActive || !u.Registered()
+}
+
+// VerificationCode is the hashed one-time code emailed to confirm an email address or recover a password
+type VerificationCode struct {
+	Hash      string    `bson:"hash"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	Attempts  int       `bson:"attempts"`
+}
+
+// TwoFactor is the TOTP enrollment of a user, enabled once they confirm a first code
+type TwoFactor struct {
+	Secret        string   `bson:"secret"`
+	Enabled       bool     `bson:"enabled"`
+	LastStep      int64    `bson:"last_step"`
+	RecoveryCodes []string `bson:"recovery_codes"`
+}
+
+// Names of the roles a user can hold
+const (
+	RoleAdmin  = "ADMIN"
+	RoleTech   = "TECH"
+	RoleClient = "CLIENT"
+)
+
 type Role struct {
 	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
 	Name         string             `json:"name,omitempty" bson:"name,omitempty"`
@@ -41,3 +81,54 @@ type Fee struct {
 	Month    string             `json:"month" bson:"month,omitempty"`
 	Year     string             `json:"year" bson:"year,omitempty"`
 }
+
+// PublicUser is the representation of a user sent in API responses, without credentials; appointments store
+// their users this way too, under the same names as the users collection
+type PublicUser struct {
+	ID            primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Name          string             `json:"name" bson:"name"`
+	NIF           int                `json:"nif" bson:"nif"`
+	Phone         Phone              `json:"phone" bson:"phone"`
+	Email         string             `json:"email" bson:"email"`
+	Role          []Role             `json:"role" bson:"role"`
+	ServiceTypes  []ServiceType      `json:"service_types" bson:"service_types"`
+	Locality      string             `json:"locality" bson:"locality"`
+	Rating        float64            `json:"rating" bson:"rating"`
+	BlockServices bool               `json:"block_services" bson:"block_services"`
+	IsActive      bool               `json:"is_active" bson:"is_active"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	WorkStart     time.Time          `json:"workStart" bson:"workStart"`
+	WorkEnd       time.Time          `json:"workEnd" bson:"workEnd"`
+}
+
+// Public returns the user without its password and verification code
+func (u User) Public() PublicUser {
+	return PublicUser{
+		ID:            u.ID,
+		Name:          u.Name,
+		NIF:           u.NIF,
+		Phone:         u.Phone,
+		Email:         u.Email,
+		Role:          u.Role,
+		ServiceTypes:  u.ServiceTypes,
+		Locality:      u.Locality,
+		Rating:        u.Rating,
+		BlockServices: u.BlockServices,
+		IsActive:      u.IsActive,
+		CreatedAt:     u.CreatedAt,
+		WorkStart:     u.WorkStart,
+		WorkEnd:       u.WorkEnd,
+	}
+}
+
+// PublicUsers converts a list of users for an API response
+func PublicUsers(users []User) []PublicUser {
+	if users == nil {
+		return nil
+	}
+	public := make([]PublicUser, 0, len(users))
+	for _, user := range users {
+		public = append(public, user.Public())
+	}
+	return public
+}
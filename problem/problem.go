@@ -0,0 +1,106 @@
+// Package problem writes error responses as RFC 7807 problem details with a stable code clients can branch on.
+package problem
+
+import (
+	"PSbackend/logging"
+	"encoding/json"
+	"net/http"
+)
+
+// ContentType is the media type of every error response
+const ContentType = "application/problem+json"
+
+// typePrefix turns a code into the URI identifying the problem type
+const typePrefix = "urn:fixfinder:problem:"
+
+// Code identifies the kind of error; codes never change once published
+type Code string
+
+const (
+	InvalidPayload      Code = "invalid_payload"
+	InvalidField        Code = "invalid_field"
+	NothingToUpdate     Code = "nothing_to_update"
+	UserNotFound        Code = "user_not_found"
+	ServiceNotFound     Code = "service_not_found"
+	AppointmentNotFound Code = "appointment_not_found"
+	FeeNotFound         Code = "fee_not_found"
+	FeePaid             Code = "fee_already_paid"
+	TimeOffNotFound     Code = "time_off_not_found"
+	SessionNotFound     Code = "session_not_found"
+	EmailRegistered     Code = "email_already_registered"
+	EmailNotRegistered  Code = "email_not_registered"
+	NIFRegistered       Code = "nif_already_registered"
+	AlreadyRegistered   Code = "already_registered"
+	NotAdmin            Code = "not_admin"
+	IncorrectPassword   Code = "incorrect_password"
+	NoCode              Code = "no_verification_code"
+	CodeExpired         Code = "verification_code_expired"
+	IncorrectCode       Code = "incorrect_verification_code"
+	TooManyAttempts     Code = "too_many_attempts"
+	AccountLocked       Code = "account_locked"
+	AccountDisabled     Code = "account_disabled"
+	TwoFactorRequired   Code = "two_factor_required"
+	IncorrectTwoFactor  Code = "incorrect_two_factor_code"
+	TwoFactorEnabled    Code = "two_factor_already_enabled"
+	TwoFactorNotStarted Code = "two_factor_not_started"
+	TwoFactorChanged    Code = "two_factor_changed"
+	InvalidRefreshToken Code = "invalid_refresh_token"
+	SessionExpired      Code = "session_expired"
+	MissingToken        Code = "missing_token"
+	InvalidToken        Code = "invalid_token"
+	Forbidden           Code = "forbidden"
+	RateLimited         Code = "rate_limited"
+	Internal            Code = "internal_error"
+	Timeout             Code = "request_timeout"
+	SlotTaken           Code = "slot_taken"
+	OutsideWorkingHours Code = "outside_working_hours"
+	TechUnavailable     Code = "technician_unavailable"
+	InvalidTransition   Code = "invalid_transition"
+)
+
+// FieldError tells which field of a request is wrong and why
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Problem is the body of an error response
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      Code         `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []FieldError `json:"fields,omitempty"`
+	// Conflict is what the request clashed with, for 409 responses
+	Conflict interface{} `json:"conflict,omitempty"`
+}
+
+// New describes an error of r with the given status, code and human readable detail
+func New(r *http.Request, status int, code Code, detail string, fields ...FieldError) Problem {
+	return Problem{
+		Type:      typePrefix + string(code),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      code,
+		RequestID: logging.RequestID(r.Context()),
+		Fields:    fields,
+	}
+}
+
+// Write sends the problem as the response
+func (p Problem) Write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// Write replies to r with a problem of the given status, code and detail
+func Write(w http.ResponseWriter, r *http.Request, status int, code Code, detail string, fields ...FieldError) {
+	New(r, status, code, detail, fields...).Write(w)
+}
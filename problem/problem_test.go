@@ -0,0 +1,43 @@
+package problem
+
+import (
+	"PSbackend/logging"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/mb/users/abc", nil)
+	req = req.WithContext(logging.WithRequestID(req.Context(), "abc-123"))
+	w := httptest.NewRecorder()
+
+	Write(w, req, http.StatusBadRequest, InvalidField, "Invalid NIF format", FieldError{Field: "nif", Message: "Invalid NIF format"})
+
+	if w.Code != http.StatusBadRequest || w.Header().Get("Content-Type") != ContentType {
+		t.Fatalf("Expected a 400 problem+json response, got %v %q", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var body Problem
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	expected := Problem{
+		Type:      "urn:fixfinder:problem:invalid_field",
+		Title:     "Bad Request",
+		Status:    http.StatusBadRequest,
+		Detail:    "Invalid NIF format",
+		Instance:  "/api/v1/mb/users/abc",
+		Code:      InvalidField,
+		RequestID: "abc-123",
+	}
+	if len(body.Fields) != 1 || body.Fields[0].Field != "nif" {
+		t.Errorf("Expected the nif field error, got %v", body.Fields)
+	}
+	body.Fields = nil
+	if !reflect.DeepEqual(body, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, body)
+	}
+}
@@ -0,0 +1,240 @@
+// Package ratelimit limits how often clients can call the login, registration and recovery routes.
+//
+// Limits are counted in the memory of each server, so every instance behind a load balancer allows the full
+// limit on its own, and restarting an instance resets its counts.
+package ratelimit
+
+import (
+	"PSbackend/problem"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxBodySize caps how much of the body is read to find the email of a request
+const maxBodySize = 1 << 20
+
+type window struct {
+	start time.Time
+	count int
+}
+
+// Limiter allows up to Limit calls per key in every fixed window of length Window
+type Limiter struct {
+	Limit  int
+	Window time.Duration
+
+	mu      sync.Mutex
+	windows map[string]*window
+	swept   time.Time
+}
+
+// New returns a limiter allowing limit calls per key in every window
+func New(limit int, per time.Duration) *Limiter {
+	return &Limiter{Limit: limit, Window: per, windows: make(map[string]*window)}
+}
+
+// Parse reads a limit written as "<calls>/<duration>", such as "20/1m"
+func Parse(value string) (*Limiter, error) {
+	calls, per, found := strings.Cut(value, "/")
+	if !found {
+		return nil, fmt.Errorf("rate limit %q must look like 20/1m", value)
+	}
+	limit, err := strconv.Atoi(calls)
+	if err != nil || limit <= 0 {
+		return nil, fmt.Errorf("rate limit %q has an invalid number of calls", value)
+	}
+	window, err := time.ParseDuration(per)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("rate limit %q has an invalid duration", value)
+	}
+	return New(limit, window), nil
+}
+
+// MustParse is like Parse but panics when the limit is invalid, for limits already validated by the configuration
+func MustParse(value string) *Limiter {
+	limiter, err := Parse(value)
+	if err != nil {
+		panic(err)
+	}
+	return limiter
+}
+
+// Allow records a call for key and reports whether it's within the limit, and if not, when to retry
+func (l *Limiter) Allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop expired windows now and then so the map doesn't grow forever
+	if now.Sub(l.swept) > l.Window {
+		for k, w := range l.windows {
+			if now.Sub(w.start) >= l.Window {
+				delete(l.windows, k)
+			}
+		}
+		l.swept = now
+	}
+
+	w, ok := l.windows[key]
+	if !ok || now.Sub(w.start) >= l.Window {
+		w = &window{start: now}
+		l.windows[key] = w
+	}
+
+	if w.count >= l.Limit {
+		return false, w.start.Add(l.Window).Sub(now)
+	}
+	w.count++
+	return true, 0
+}
+
+// Proxies are the reverse proxies trusted to name the client of a request in Header, such as X-Forwarded-For
+// or X-Real-IP; the header is ignored when empty or when the request doesn't come from one of Networks
+type Proxies struct {
+	Header   string
+	Networks []*net.IPNet
+}
+
+// ParseNetworks reads a comma-separated list of addresses and CIDR ranges, such as "10.0.0.0/8,127.0.0.1"
+func ParseNetworks(value string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("proxy %q must be an IP address or a CIDR range", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("proxy %q must be an IP address or a CIDR range", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func (p Proxies) trusts(ip net.IP) bool {
+	for _, network := range p.Networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// client returns the address the trusted proxies give for the client of r, or "" when they give none. Proxies
+// append to the header, so it's read from the right, skipping the addresses of trusted proxies.
+func (p Proxies) client(r *http.Request) string {
+	if p.Header == "" {
+		return ""
+	}
+	peer := net.ParseIP(clientIP(r))
+	if peer == nil || !p.trusts(peer) {
+		return ""
+	}
+
+	values := r.Header.Values(p.Header)
+	var addresses []string
+	for _, value := range values {
+		addresses = append(addresses, strings.Split(value, ",")...)
+	}
+	for i := len(addresses) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(addresses[i]))
+		if ip == nil {
+			return ""
+		}
+		if !p.trusts(ip) {
+			return ip.String()
+		}
+	}
+	return ""
+}
+
+// TrustProxies returns a middleware that replaces the remote address of requests coming through the trusted
+// proxies with the client address they give, so the rate limits and the audit log see the real client
+func TrustProxies(proxies Proxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if ip := proxies.client(r); ip != "" {
+				r.RemoteAddr = net.JoinHostPort(ip, "0")
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP returns the address of the client connected to the server, or the one given by a trusted proxy
+// once TrustProxies has run
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestEmail reads the email field of a JSON body and puts the body back for the handler
+func requestEmail(r *http.Request) string {
+	if r.Body == nil {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return ""
+	}
+
+	var requestBody struct {
+		Email string `json:"email"`
+	}
+	json.Unmarshal(body, &requestBody)
+	return strings.ToLower(strings.TrimSpace(requestBody.Email))
+}
+
+// Middleware returns a wrapper limiting calls per client IP and per email in the request body; perEmail is nil
+// for routes whose body has no email
+func Middleware(perIP, perEmail *Limiter) func(http.HandlerFunc) http.HandlerFunc {
+	return func(handler http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+
+			allowed, retryAfter := perIP.Allow(clientIP(r), now)
+			if allowed && perEmail != nil {
+				if email := requestEmail(r); email != "" {
+					allowed, retryAfter = perEmail.Allow(email, now)
+				}
+			}
+
+			if !allowed {
+				seconds := int(retryAfter.Round(time.Second) / time.Second)
+				if seconds < 1 {
+					seconds = 1
+				}
+				w.Header().Set("Retry-After", strconv.Itoa(seconds))
+				problem.Write(w, r, http.StatusTooManyRequests, problem.RateLimited, "Too many requests, try again later")
+				return
+			}
+
+			handler(w, r)
+		}
+	}
+}
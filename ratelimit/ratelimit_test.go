@@ -0,0 +1,129 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAllow(t *testing.T) {
+	limiter := New(2, time.Minute)
+	now := time.Date(2024, time.December, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("10.0.0.1", now); !allowed {
+			t.Fatalf("Call %d should be allowed", i+1)
+		}
+	}
+
+	allowed, retryAfter := limiter.Allow("10.0.0.1", now.Add(10*time.Second))
+	if allowed || retryAfter != 50*time.Second {
+		t.Fatalf("Expected third call to be refused for 50s, got %v and %v", allowed, retryAfter)
+	}
+
+	if allowed, _ := limiter.Allow("10.0.0.2", now); !allowed {
+		t.Fatal("Other keys shouldn't share the limit")
+	}
+
+	if allowed, _ := limiter.Allow("10.0.0.1", now.Add(time.Minute)); !allowed {
+		t.Fatal("Limit should reset in the next window")
+	}
+}
+
+func TestParse(t *testing.T) {
+	limiter, err := Parse("20/1m")
+	if err != nil || limiter.Limit != 20 || limiter.Window != time.Minute {
+		t.Fatalf("Unexpected limiter %+v, %v", limiter, err)
+	}
+
+	for _, value := range []string{"20", "0/1m", "x/1m", "20/x"} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	limit := Middleware(New(10, time.Minute), New(1, time.Minute))
+	handler := limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func(email string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/mb/users/login", strings.NewReader(`{"email": "`+email+`"}`))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	if w := call("nuno@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v", w.Code)
+	}
+	w := call("NUNO@example.com")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected status code 429 with Retry-After, got %v", w.Code)
+	}
+	if w := call("other@example.com"); w.Code != http.StatusOK {
+		t.Fatalf("Expected status code 200 for another email, got %v", w.Code)
+	}
+}
+
+func TestMiddlewarePerIPOnly(t *testing.T) {
+	handler := Middleware(New(1, time.Minute), nil)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/mb/users/token/refresh", strings.NewReader(`{"refresh_token": "token"}`))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	if code := call(); code != http.StatusOK {
+		t.Fatalf("Expected status code 200, got %v", code)
+	}
+	if code := call(); code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status code 429 once the IP used its budget, got %v", code)
+	}
+}
+
+func TestTrustProxies(t *testing.T) {
+	networks, err := ParseNetworks("10.0.0.0/8, 127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	handler := TrustProxies(Proxies{Header: "X-Forwarded-For", Networks: networks})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = clientIP(r)
+	}))
+
+	tests := map[string]struct {
+		remote, forwarded, client string
+	}{
+		"through a proxy":     {"10.0.0.5:4000", "203.0.113.7", "203.0.113.7"},
+		"through two proxies": {"10.0.0.5:4000", "198.51.100.1, 203.0.113.7, 10.0.0.9", "203.0.113.7"},
+		"untrusted peer":      {"192.0.2.1:4000", "203.0.113.7", "192.0.2.1"},
+		"no header":           {"127.0.0.1:4000", "", "127.0.0.1"},
+		"invalid header":      {"10.0.0.5:4000", "not-an-ip", "10.0.0.5"},
+	}
+	for name, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/mb/users/login", nil)
+		req.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		if seen != test.client {
+			t.Errorf("%s: expected client %q, got %q", name, test.client, seen)
+		}
+	}
+
+	for _, value := range []string{"10.0.0.0/33", "proxy"} {
+		if _, err := ParseNetworks(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
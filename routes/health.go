@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"PSbackend/api"
+	"PSbackend/config"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// MetricsRoutes registers the metrics routes, served on the internal listener only
+func MetricsRoutes(router *mux.Router) {
+	// Define route to scrape the Prometheus metrics
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+}
+
+func HealthRoutes(client *mongo.Client, cfg config.Config, router *mux.Router) {
+	// Define route to tell that the process is alive
+	router.HandleFunc("/healthz", api.Healthz).Methods("GET")
+
+	// Define route to tell whether the dependencies are available
+	router.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		api.Readyz(client, cfg, w, r)
+	}).Methods("GET")
+}
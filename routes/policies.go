@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"PSbackend/auth"
+	"PSbackend/models"
+)
+
+// Role policies shared by the route groups; routes under /api/v1/bo are for admins only
+var (
+	adminOnly    = auth.Roles(models.RoleAdmin)
+	techOnly     = auth.Roles(models.RoleTech)
+	clientOnly   = auth.Roles(models.RoleClient)
+	adminOrTech  = auth.Roles(models.RoleAdmin, models.RoleTech)
+	clientOrTech = auth.Roles(models.RoleClient, models.RoleTech)
+)
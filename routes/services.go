@@ -2,151 +2,208 @@ package routes
 
 import (
 	"PSbackend/api"
+	"PSbackend/auth"
+	"PSbackend/config"
+	"PSbackend/models"
+	"PSbackend/store"
 	"net/http"
-	"os"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func ServiceRoutes(client *mongo.Client, dbName, serviceCollection, userCollection string, router *mux.Router) {
+func ServiceRoutes(cfg config.Config, stores store.Stores, router *mux.Router) {
 	// Define route for getting all services for Back Office
-	router.HandleFunc("/api/v1/bo/services", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServices(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServices(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route for getting all services for Mobile App
-	router.HandleFunc("/api/v1/mb/services", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServices(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServices(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get a service by id for Back Office
-	router.HandleFunc("/api/v1/bo/services/id", func(w http.ResponseWriter, r *http.Request) {
-		api.GetService(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/id", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetService(stores.Services, w, r)
+	})).Methods("GET")
 
 	// Define route to get a service by id for Mobile App
-	router.HandleFunc("/api/v1/mb/services/id", func(w http.ResponseWriter, r *http.Request) {
-		api.GetService(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/id", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetService(stores.Services, w, r)
+	})).Methods("GET")
 
 	// Define route for getting all filtered services by type for Back Office
-	router.HandleFunc("/api/v1/bo/services/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.GetFilteredServiceType(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/service-type", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetFilteredServiceType(stores.Services, w, r)
+	})).Methods("GET")
 
 	// Define route for getting all filtered services by type for Mobile App
-	router.HandleFunc("/api/v1/mb/services/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.GetFilteredServiceType(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/service-type", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetFilteredServiceType(stores.Services, w, r)
+	})).Methods("GET")
 
 	// Define route to update a service for Back Office
-	router.HandleFunc("/api/v1/bo/services", func(w http.ResponseWriter, r *http.Request) {
-		api.UpdateService(client, dbName, serviceCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/bo/services", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateService(stores.Services, w, r)
+	})).Methods("PUT")
 
 	// Define route to update a service for Mobile App
-	router.HandleFunc("/api/v1/mb/services", func(w http.ResponseWriter, r *http.Request) {
-		api.UpdateService(client, dbName, serviceCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/mb/services", auth.Require(adminOrTech, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateService(stores.Services, w, r)
+	})).Methods("PUT")
 
 	// Define route for creating a new specific service type for Back Office
-	router.HandleFunc("/api/v1/bo/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.CreateServiceType(client, dbName, os.Getenv("SERVICE_TYPE_COLLECTION"), w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/service-type", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.CreateServiceType(stores.ServiceTypes, w, r)
+	})).Methods("POST")
 
 	// Define route for getting all services types for Back Office
-	router.HandleFunc("/api/v1/bo/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServiceType(client, dbName, os.Getenv("SERVICE_TYPE_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/service-type", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServiceType(stores.ServiceTypes, w, r)
+	})).Methods("GET")
 
 	// Define route for getting all services types for Mobile App
-	router.HandleFunc("/api/v1/mb/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServiceType(client, dbName, os.Getenv("SERVICE_TYPE_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/service-type", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServiceType(stores.ServiceTypes, w, r)
+	})).Methods("GET")
 
 	// Define route to update a service type for Back Office
-	router.HandleFunc("/api/v1/bo/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.UpdateServiceType(client, dbName, os.Getenv("SERVICE_TYPE_COLLECTION"), w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/bo/service-type", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateServiceType(stores.ServiceTypes, w, r)
+	})).Methods("PUT")
 
 	// Define route to delete a service type by id for Back Office
-	router.HandleFunc("/api/v1/bo/service-type", func(w http.ResponseWriter, r *http.Request) {
-		api.DeleteServiceType(client, dbName, os.Getenv("SERVICE_TYPE_COLLECTION"), w, r)
-	}).Methods("DELETE")
+	router.HandleFunc("/api/v1/bo/service-type", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteServiceType(stores.ServiceTypes, stores.Audit, w, r)
+	})).Methods("DELETE")
 
 	// Define route to get services by technician for mobile
-	router.HandleFunc("/api/v1/mb/services/technicians", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServiceByTechnician(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/technicians", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServiceByTechnician(stores.Services, w, r)
+	})).Methods("GET")
 
 	// Define route to get services by technician for Back Office
-	router.HandleFunc("/api/v1/bo/services/technicians", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServiceByTechnician(client, dbName, serviceCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/technicians", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServiceByTechnician(stores.Services, w, r)
+	})).Methods("GET")
 
 	// Define route to update service with a new appointment for Mobile
-	router.HandleFunc("/api/v1/mb/services/appointment", func(w http.ResponseWriter, r *http.Request) {
-		api.InsertAppointment(client, dbName, serviceCollection, userCollection, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/mb/services/appointment", auth.Require(clientOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.InsertAppointment(stores.Users, stores.Appointments, cfg.Booking, w, r)
+	})).Methods("POST")
 
 	// Define route to get appointments for Back Office
-	router.HandleFunc("/api/v1/bo/services/appointments", func(w http.ResponseWriter, r *http.Request) {
-		api.GetAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/appointments", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get all the upcomming appointments of a Technician
-	router.HandleFunc("/api/v1/bo/services/appointments/upcoming", func(w http.ResponseWriter, r *http.Request) {
-		api.GetUpcommingAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/appointments/upcoming", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetUpcommingAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get all the upcomming appointments of a Client
-	router.HandleFunc("/api/v1/mb/services/appointments/upcoming/client/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.GetClientUpcommingAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/appointments/upcoming/client/{nif}", auth.Require(auth.SelfOr("nif", models.RoleTech), func(w http.ResponseWriter, r *http.Request) {
+		api.GetClientUpcommingAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get all the upcomming appointments of a Technician
-	router.HandleFunc("/api/v1/mb/services/appointments/upcoming/technician/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.GetTechUpcommingAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/appointments/upcoming/technician/{nif}", auth.Require(auth.Self("nif"), func(w http.ResponseWriter, r *http.Request) {
+		api.GetTechUpcommingAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get history of appointments
-	router.HandleFunc("/api/v1/bo/services/appointments/history", func(w http.ResponseWriter, r *http.Request) {
-		api.GetHistoryAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/appointments/history", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetHistoryAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get history of appointments of a Client
-	router.HandleFunc("/api/v1/mb/services/appointments/history/client/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.GetClientHistoryAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/appointments/history/client/{nif}", auth.Require(auth.Self("nif"), func(w http.ResponseWriter, r *http.Request) {
+		api.GetClientHistoryAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get history of appointments of a Tech
-	router.HandleFunc("/api/v1/mb/services/appointments/history/technician/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.GetTechHistoryAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/services/appointments/history/technician/{nif}", auth.Require(auth.Self("nif"), func(w http.ResponseWriter, r *http.Request) {
+		api.GetTechHistoryAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get appointments in a price range
-	router.HandleFunc("/api/v1/bo/services/appointments/price", func(w http.ResponseWriter, r *http.Request) {
-		api.GetAppointmentsByPrice(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/appointments/price", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetAppointmentsByPrice(stores.Appointments, w, r)
+	})).Methods("GET")
 
 	// Define route to get appointments in a price range
-	router.HandleFunc("/api/v1/bo/services/price", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServicesByPrice(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/services/price", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServicesByPrice(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get appointments in a price range
-	router.HandleFunc("/api/v1/bo/services1/price", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServicesByPriceQuery(client, dbName, userCollection, w, r)
-	}).Methods("GET")
-
-	// Define route to get appointments in a price range
-	router.HandleFunc("/api/v1/mb/services/appointments/{id}", func(w http.ResponseWriter, r *http.Request) {
-		api.DeleteAppointment(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("DELETE")
+	router.HandleFunc("/api/v1/bo/services1/price", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServicesByPriceQuery(stores.Users, w, r)
+	})).Methods("GET")
+
+	// Define route to cancel an appointment for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}", auth.Require(clientOrTech, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("DELETE")
+
+	// Define route to accept a requested appointment for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}/accept", auth.Require(techOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.AcceptAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to accept a requested appointment for Back Office
+	router.HandleFunc("/api/v1/bo/services/appointments/{id}/accept", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.AcceptAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to reject a requested appointment for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}/reject", auth.Require(techOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.RejectAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to reject a requested appointment for Back Office
+	router.HandleFunc("/api/v1/bo/services/appointments/{id}/reject", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.RejectAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to start an accepted appointment for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}/start", auth.Require(techOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.StartAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to complete an appointment in progress for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}/complete", auth.Require(techOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.CompleteAppointment(stores.Appointments, stores.Users, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to complete an appointment in progress for Back Office
+	router.HandleFunc("/api/v1/bo/services/appointments/{id}/complete", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.CompleteAppointment(stores.Appointments, stores.Users, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to cancel an appointment for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}/cancel", auth.Require(clientOrTech, func(w http.ResponseWriter, r *http.Request) {
+		api.CancelAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to cancel an appointment for Back Office
+	router.HandleFunc("/api/v1/bo/services/appointments/{id}/cancel", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.CancelAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to report a client who didn't show up to an appointment for Mobile
+	router.HandleFunc("/api/v1/mb/services/appointments/{id}/no-show", auth.Require(techOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.NoShowAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
+
+	// Define route to report a client who didn't show up to an appointment for Back Office
+	router.HandleFunc("/api/v1/bo/services/appointments/{id}/no-show", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.NoShowAppointment(stores.Appointments, stores.Audit, w, r)
+	})).Methods("POST")
 
 	// Define route to get fees of a technician
-	router.HandleFunc("/api/v1/bo/count-appointments", func(w http.ResponseWriter, r *http.Request) {
-		api.GetCountAppointments(client, dbName, os.Getenv("APPOINTMENT_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/count-appointments", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetCountAppointments(stores.Appointments, w, r)
+	})).Methods("GET")
 }
@@ -2,171 +2,289 @@ package routes
 
 import (
 	"PSbackend/api"
+	"PSbackend/auth"
+	"PSbackend/background"
+	"PSbackend/config"
+	"PSbackend/mailer"
+	"PSbackend/models"
+	"PSbackend/ratelimit"
+	"PSbackend/store"
 	"net/http"
-	"os"
 
 	"github.com/gorilla/mux"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-func UserRoutes(client *mongo.Client, dbName, userCollection string, router *mux.Router) {
+func UserRoutes(cfg config.Config, stores store.Stores, mail mailer.Mailer, jobs *background.Group, router *mux.Router) {
+	// Limit the public login, email and code confirmation routes per client IP and per email, and token refreshes
+	// per client IP, each with its own budget
+	limits := cfg.RateLimits
+	loginLimit := ratelimit.Middleware(ratelimit.MustParse(limits.LoginIP), ratelimit.MustParse(limits.LoginEmail))
+	emailLimit := ratelimit.Middleware(ratelimit.MustParse(limits.EmailIP), ratelimit.MustParse(limits.EmailEmail))
+	codeLimit := ratelimit.Middleware(ratelimit.MustParse(limits.CodeIP), ratelimit.MustParse(limits.CodeEmail))
+	refreshLimit := ratelimit.Middleware(ratelimit.MustParse(limits.RefreshIP), nil)
+
 	// Define route to finish the registration for mobile
-	router.HandleFunc("/api/v1/mb/users/register-completion", func(w http.ResponseWriter, r *http.Request) {
-		api.RegisterCompletion(client, dbName, userCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/mb/users/register-completion", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.RegisterCompletion(stores.Users, w, r)
+	})).Methods("PUT")
 
 	// Define route to get users for mobile
-	router.HandleFunc("/api/v1/mb/users", func(w http.ResponseWriter, r *http.Request) {
-		api.GetUsers(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/users", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetUsers(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get users for backoffice
-	router.HandleFunc("/api/v1/bo/users", func(w http.ResponseWriter, r *http.Request) {
-		api.GetUsers(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/users", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetUsers(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get technicians for mobile
-	router.HandleFunc("/api/v1/mb/users/technicians", func(w http.ResponseWriter, r *http.Request) {
-		api.GetTechnicians(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/users/technicians", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetTechnicians(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get technicians for backoffice
-	router.HandleFunc("/api/v1/bo/users/technicians", func(w http.ResponseWriter, r *http.Request) {
-		api.GetTechnicians(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/users/technicians", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetTechnicians(stores.Users, w, r)
+	})).Methods("GET")
+
+	// Define route to get the technicians of a service type and locality free for a period for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/available", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetAvailableTechnicians(stores.Users, stores.Appointments, cfg.Booking, w, r)
+	})).Methods("GET")
+
+	// Define route to get the free slots of a technician for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/{id}/availability", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetAvailability(stores.Users, stores.Appointments, cfg.Booking, w, r)
+	})).Methods("GET")
+
+	// Define route to get the free slots of a technician for backoffice
+	router.HandleFunc("/api/v1/bo/users/technicians/{id}/availability", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetAvailability(stores.Users, stores.Appointments, cfg.Booking, w, r)
+	})).Methods("GET")
+
+	// Define route to get the working schedule of a technician for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/{id}/schedule", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetSchedule(stores.Users, cfg.Booking, w, r)
+	})).Methods("GET")
+
+	// Define route to replace the working schedule of a technician for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/{id}/schedule", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateSchedule(stores.Users, cfg.Booking, w, r)
+	})).Methods("PUT")
+
+	// Define route to delete the working schedule of a technician for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/{id}/schedule", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteSchedule(stores.Users, w, r)
+	})).Methods("DELETE")
+
+	// Define route to add time off to the schedule of a technician for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/{id}/schedule/time-off", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.AddTimeOff(stores.Users, cfg.Booking, w, r)
+	})).Methods("POST")
+
+	// Define route to delete time off from the schedule of a technician for mobile
+	router.HandleFunc("/api/v1/mb/users/technicians/{id}/schedule/time-off/{timeOffId}", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteTimeOff(stores.Users, w, r)
+	})).Methods("DELETE")
+
+	// Define route to get the working schedule of a technician for backoffice
+	router.HandleFunc("/api/v1/bo/users/technicians/{id}/schedule", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetSchedule(stores.Users, cfg.Booking, w, r)
+	})).Methods("GET")
+
+	// Define route to replace the working schedule of a technician for backoffice
+	router.HandleFunc("/api/v1/bo/users/technicians/{id}/schedule", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateSchedule(stores.Users, cfg.Booking, w, r)
+	})).Methods("PUT")
+
+	// Define route to delete the working schedule of a technician for backoffice
+	router.HandleFunc("/api/v1/bo/users/technicians/{id}/schedule", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteSchedule(stores.Users, w, r)
+	})).Methods("DELETE")
+
+	// Define route to add time off to the schedule of a technician for backoffice
+	router.HandleFunc("/api/v1/bo/users/technicians/{id}/schedule/time-off", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.AddTimeOff(stores.Users, cfg.Booking, w, r)
+	})).Methods("POST")
+
+	// Define route to delete time off from the schedule of a technician for backoffice
+	router.HandleFunc("/api/v1/bo/users/technicians/{id}/schedule/time-off/{timeOffId}", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteTimeOff(stores.Users, w, r)
+	})).Methods("DELETE")
 
 	// Define route to get a user by nif for backoffice
-	router.HandleFunc("/api/v1/bo/users/nif", func(w http.ResponseWriter, r *http.Request) {
-		api.GetUser(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/users/nif", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetUser(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to update a user for mobile
-	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.UpdateUser(client, dbName, userCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/mb/users/{nif}", auth.Require(auth.SelfOr("nif", models.RoleAdmin), func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateUser(stores.Users, stores.Audit, w, r)
+	})).Methods("PUT")
 
 	// Define route to change the isActive of a user
-	router.HandleFunc("/api/v1/bo/users/active", func(w http.ResponseWriter, r *http.Request) {
-		api.UpdateActive(client, dbName, userCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/bo/users/active", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateActive(stores.Users, stores.Sessions, stores.Audit, w, r)
+	})).Methods("PUT")
 
 	// Define route to change the BlockServices of a user
-	router.HandleFunc("/api/v1/bo/users/block", func(w http.ResponseWriter, r *http.Request) {
-		api.UpdateBlock(client, dbName, userCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/bo/users/block", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.UpdateBlock(stores.Users, stores.Sessions, stores.Audit, w, r)
+	})).Methods("PUT")
 
 	// Define route to delete a user by nif for mobile
-	router.HandleFunc("/api/v1/mb/users", func(w http.ResponseWriter, r *http.Request) {
-		api.DeleteUser(client, dbName, userCollection, w, r)
-	}).Methods("DELETE")
+	router.HandleFunc("/api/v1/mb/users", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteUser(stores.Users, stores.Sessions, stores.Audit, w, r)
+	})).Methods("DELETE")
 
 	// Define route to delete a user by nif for backoffice
-	router.HandleFunc("/api/v1/bo/users", func(w http.ResponseWriter, r *http.Request) {
-		api.DeleteUser(client, dbName, userCollection, w, r)
-	}).Methods("DELETE")
+	router.HandleFunc("/api/v1/bo/users", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.DeleteUser(stores.Users, stores.Sessions, stores.Audit, w, r)
+	})).Methods("DELETE")
 
 	// Define route for user login of mobile
-	router.HandleFunc("/api/v1/mb/users/login", func(w http.ResponseWriter, r *http.Request) {
-		api.Login(client, dbName, userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/mb/users/login", loginLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.Login(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
 
 	// Define route for admin login of backoffice
-	router.HandleFunc("/api/v1/bo/users/login", func(w http.ResponseWriter, r *http.Request) {
-		api.LoginAdmin(client, dbName, userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/users/login", loginLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.LoginAdmin(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
 
 	// Define route for creating a new role for backoffice
-	router.HandleFunc("/api/v1/bo/users/role", func(w http.ResponseWriter, r *http.Request) {
-		api.CreateRole(client, dbName, os.Getenv("ROLES_COLLECTION"), w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/users/role", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.CreateRole(stores.Roles, w, r)
+	})).Methods("POST")
+
+	// Define route to exchange a refresh token for new tokens for mobile
+	router.HandleFunc("/api/v1/mb/users/token/refresh", refreshLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.RefreshToken(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
+
+	// Define route to exchange a refresh token for new tokens for backoffice
+	router.HandleFunc("/api/v1/bo/users/token/refresh", refreshLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.RefreshToken(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
+
+	// Define route to log out of the current session for mobile
+	router.HandleFunc("/api/v1/mb/users/logout", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.Logout(stores.Sessions, w, r)
+	})).Methods("POST")
+
+	// Define route to log out of the current session for backoffice
+	router.HandleFunc("/api/v1/bo/users/logout", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.Logout(stores.Sessions, w, r)
+	})).Methods("POST")
+
+	// Define route to start the two-factor enrollment of an admin
+	router.HandleFunc("/api/v1/bo/users/2fa/enroll", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.EnrollTwoFactor(stores.Users, w, r)
+	})).Methods("POST")
+
+	// Define route to confirm the two-factor enrollment of an admin
+	router.HandleFunc("/api/v1/bo/users/2fa/confirm", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.ConfirmTwoFactor(stores.Users, w, r)
+	})).Methods("POST")
+
+	// Define route to revoke every session of a user
+	router.HandleFunc("/api/v1/bo/users/sessions", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.RevokeUserSessions(stores.Users, stores.Sessions, w, r)
+	})).Methods("DELETE")
 
 	// Define route to get clients for mobile
-	router.HandleFunc("/api/v1/mb/users/clients", func(w http.ResponseWriter, r *http.Request) {
-		api.GetClients(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/users/clients", auth.Require(auth.Authenticated, func(w http.ResponseWriter, r *http.Request) {
+		api.GetClients(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get clients for backoffice
-	router.HandleFunc("/api/v1/bo/users/clients", func(w http.ResponseWriter, r *http.Request) {
-		api.GetClients(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/users/clients", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetClients(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to send email with a code to verify for mobile
-	router.HandleFunc("/api/v1/mb/users/register", func(w http.ResponseWriter, r *http.Request) {
-		api.VerificateEmail(w, r, client, dbName, userCollection)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/mb/users/register", emailLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.VerificateEmail(w, r, stores.Users, mail)
+	})).Methods("POST")
 
 	// Define route to send email with a code to verify for backoffice
-	router.HandleFunc("/api/v1/bo/users/register", func(w http.ResponseWriter, r *http.Request) {
-		api.VerificateEmail(w, r, client, dbName, userCollection)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/users/register", emailLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.VerificateEmail(w, r, stores.Users, mail)
+	})).Methods("POST")
 
 	// Define route to confirm the code set by the user and define the new password for mobile
-	router.HandleFunc("/api/v1/mb/users/register-confirmation", func(w http.ResponseWriter, r *http.Request) {
-		api.ConfirmAuthCode(client, dbName, userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/mb/users/register-confirmation", codeLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.ConfirmAuthCode(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
 
 	// Define route to confirm the code set by the user and define the new password for backoffice
-	router.HandleFunc("/api/v1/bo/users/register-confirmation", func(w http.ResponseWriter, r *http.Request) {
-		api.ConfirmAuthCode(client, dbName, userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/users/register-confirmation", codeLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.ConfirmAuthCode(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
 
 	// Define route to send recovery email with a code to verify for mobile
-	router.HandleFunc("/api/v1/mb/users/recovery", func(w http.ResponseWriter, r *http.Request) {
-		api.RecoveryEmail(w, r, client, dbName, userCollection)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/mb/users/recovery", emailLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.RecoveryEmail(w, r, stores.Users, mail)
+	})).Methods("POST")
 
 	// Define route to send recovery email with a code to verify for backoffice
-	router.HandleFunc("/api/v1/bo/users/recovery", func(w http.ResponseWriter, r *http.Request) {
-		api.RecoveryEmail(w, r, client, dbName, userCollection)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/users/recovery", emailLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.RecoveryEmail(w, r, stores.Users, mail)
+	})).Methods("POST")
 
 	// Define route to confirm the code set by the user and define the new password for mobile
-	router.HandleFunc("/api/v1/mb/users/recovery-confirmation", func(w http.ResponseWriter, r *http.Request) {
-		api.ConfirmAuthCode(client, dbName, userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/mb/users/recovery-confirmation", codeLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.ConfirmAuthCode(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
 
 	// Define route to confirm the code set by the user and define the new password for backoffice
-	router.HandleFunc("/api/v1/bo/users/recovery-confirmation", func(w http.ResponseWriter, r *http.Request) {
-		api.ConfirmAuthCode(client, dbName, userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/users/recovery-confirmation", codeLimit(func(w http.ResponseWriter, r *http.Request) {
+		api.ConfirmAuthCode(stores.Users, stores.Sessions, w, r)
+	})).Methods("POST")
 
 	// Define route to get a user by nif  for mobile
-	router.HandleFunc("/api/v1/mb/users/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.GetUser(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/users/{nif}", auth.Require(auth.Self("nif"), func(w http.ResponseWriter, r *http.Request) {
+		api.GetUser(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get clients ordened by a filter
-	router.HandleFunc("/api/v1/bo/users/clients/order", func(w http.ResponseWriter, r *http.Request) {
-		api.OrderClients(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/users/clients/order", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.OrderClients(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get technicians ordened by a filter
-	router.HandleFunc("/api/v1/bo/users/technicians/order", func(w http.ResponseWriter, r *http.Request) {
-		api.OrderTechnicians(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/users/technicians/order", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.OrderTechnicians(stores.Users, w, r)
+	})).Methods("GET")
 
 	// Define route to get fees
-	router.HandleFunc("/api/v1/bo/fees", func(w http.ResponseWriter, r *http.Request) {
-		api.GetFees(client, dbName, os.Getenv("FEES_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/fees", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetFees(stores.Fees, w, r)
+	})).Methods("GET")
 
 	// Define route to get fees
-	router.HandleFunc("/api/v1/bo/fees", func(w http.ResponseWriter, r *http.Request) {
-		api.CreateFee(client, dbName, os.Getenv("FEES_COLLECTION"), userCollection, w, r)
-	}).Methods("POST")
+	router.HandleFunc("/api/v1/bo/fees", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.CreateFee(stores.Fees, stores.Users, stores.Audit, w, r)
+	})).Methods("POST")
 
 	// Define route to update the status of a fee to PAID
-	router.HandleFunc("/api/v1/mb/fees/{id}", func(w http.ResponseWriter, r *http.Request) {
-		api.PayFee(client, dbName, os.Getenv("FEES_COLLECTION"), userCollection, w, r)
-	}).Methods("PUT")
+	router.HandleFunc("/api/v1/mb/fees/{id}", auth.Require(techOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.PayFee(stores.Fees, stores.Users, stores.Audit, mail, jobs, w, r)
+	})).Methods("PUT")
 
 	// Define route to get fees of a technician
-	router.HandleFunc("/api/v1/mb/fees/{nif}", func(w http.ResponseWriter, r *http.Request) {
-		api.GetFeesByNif(client, dbName, os.Getenv("FEES_COLLECTION"), w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/mb/fees/{nif}", auth.Require(auth.Self("nif"), func(w http.ResponseWriter, r *http.Request) {
+		api.GetFeesByNif(stores.Fees, w, r)
+	})).Methods("GET")
+
+	// Define route to query the audit log
+	router.HandleFunc("/api/v1/bo/audit", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetAuditLog(stores.Audit, w, r)
+	})).Methods("GET")
 
 	// Define route to get fees of a technician
-	router.HandleFunc("/api/v1/bo/count-services-performed", func(w http.ResponseWriter, r *http.Request) {
-		api.GetServicesPerformed(client, dbName, userCollection, w, r)
-	}).Methods("GET")
+	router.HandleFunc("/api/v1/bo/count-services-performed", auth.Require(adminOnly, func(w http.ResponseWriter, r *http.Request) {
+		api.GetServicesPerformed(stores.Users, w, r)
+	})).Methods("GET")
 }
@@ -0,0 +1,670 @@
+package store
+
+import (
+	"PSbackend/models"
+	"bytes"
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// NewMemoryStores returns empty stores that keep every document in memory, for tests and local development
+func NewMemoryStores() Stores {
+	return Stores{
+		Users:        &memoryUsers{},
+		Appointments: &memoryAppointments{},
+		Fees:         &memoryFees{},
+		Services:     &memoryServiceTypes{},
+		ServiceTypes: &memoryServiceTypes{},
+		Reviews:      &memoryReviews{},
+		Roles:        &memoryRoles{},
+		Sessions:     &memorySessions{},
+		Audit:        &memoryAudit{},
+		Locks:        &memoryLocks{},
+	}
+}
+
+// table holds documents the way MongoDB would, copying them through bson on the way in and out
+type table[T any] struct {
+	mu   sync.Mutex
+	docs []T
+}
+
+// clone copies a document through bson, so callers never share memory with the table
+func clone[T any](doc T) (T, error) {
+	var copied T
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		return copied, err
+	}
+	err = bson.Unmarshal(raw, &copied)
+	return copied, err
+}
+
+func (t *table[T]) insert(doc T) error {
+	copied, err := clone(doc)
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.docs = append(t.docs, copied)
+	return nil
+}
+
+func (t *table[T]) find(match func(T) bool) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, doc := range t.docs {
+		if match(doc) {
+			return clone(doc)
+		}
+	}
+	var missing T
+	return missing, ErrNotFound
+}
+
+func (t *table[T]) list(match func(T) bool) ([]T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	docs := make([]T, 0)
+	for _, doc := range t.docs {
+		if match == nil || match(doc) {
+			copied, err := clone(doc)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, copied)
+		}
+	}
+	return docs, nil
+}
+
+// update changes the first matching document in place and returns it; change reports whether it modified the document
+func (t *table[T]) update(match func(T) bool, change func(*T) (bool, error)) (T, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var missing T
+	for i := range t.docs {
+		if !match(t.docs[i]) {
+			continue
+		}
+		modified, err := change(&t.docs[i])
+		if err != nil {
+			return missing, false, err
+		}
+		doc, err := clone(t.docs[i])
+		return doc, modified, err
+	}
+	return missing, false, ErrNotFound
+}
+
+func (t *table[T]) remove(match func(T) bool) (T, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i, doc := range t.docs {
+		if match(doc) {
+			t.docs = append(t.docs[:i], t.docs[i+1:]...)
+			return doc, nil
+		}
+	}
+	var missing T
+	return missing, ErrNotFound
+}
+
+// setFields applies a $set of bson fields to a document and reports whether it changed
+func setFields[T any](doc *T, fields Fields) (bool, error) {
+	before, err := bson.Marshal(doc)
+	if err != nil {
+		return false, err
+	}
+	var state bson.M
+	if err := bson.Unmarshal(before, &state); err != nil {
+		return false, err
+	}
+	for name, value := range fields {
+		state[name] = value
+	}
+	raw, err := bson.Marshal(state)
+	if err != nil {
+		return false, err
+	}
+	var changed T
+	if err := bson.Unmarshal(raw, &changed); err != nil {
+		return false, err
+	}
+	after, err := bson.Marshal(changed)
+	if err != nil {
+		return false, err
+	}
+	*doc = changed
+	return !bytes.Equal(before, after), nil
+}
+
+type memoryUsers struct {
+	table[models.User]
+}
+
+func userWithID(id primitive.ObjectID) func(models.User) bool {
+	return func(user models.User) bool { return user.ID == id }
+}
+
+func userWithEmail(email string) func(models.User) bool {
+	return func(user models.User) bool { return user.Email == email }
+}
+
+func userWithCode(email, codeHash string) func(models.User) bool {
+	return func(user models.User) bool {
+		return user.Email == email && user.Verification != nil && user.Verification.Hash == codeHash
+	}
+}
+
+func (s *memoryUsers) List(ctx context.Context) ([]models.User, error) {
+	return s.list(nil)
+}
+
+func (s *memoryUsers) FindByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	return s.find(userWithID(id))
+}
+
+func (s *memoryUsers) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	return s.find(userWithEmail(email))
+}
+
+func (s *memoryUsers) FindByNIF(ctx context.Context, nif int64) (models.User, error) {
+	return s.find(func(user models.User) bool { return int64(user.NIF) == nif })
+}
+
+func (s *memoryUsers) UpsertByEmail(ctx context.Context, user models.User) error {
+	raw, err := bson.Marshal(user)
+	if err != nil {
+		return err
+	}
+	var fields Fields
+	if err := bson.Unmarshal(raw, &fields); err != nil {
+		return err
+	}
+	delete(fields, "_id")
+
+	_, _, err = s.update(userWithEmail(user.Email), func(existing *models.User) (bool, error) {
+		return setFields(existing, fields)
+	})
+	if err != ErrNotFound {
+		return err
+	}
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	return s.insert(user)
+}
+
+func (s *memoryUsers) Update(ctx context.Context, id primitive.ObjectID, fields Fields) (bool, error) {
+	_, modified, err := s.update(userWithID(id), func(user *models.User) (bool, error) {
+		return setFields(user, fields)
+	})
+	return modified, err
+}
+
+func (s *memoryUsers) CompleteRegistration(ctx context.Context, id primitive.ObjectID, nif int, fields Fields) (models.User, error) {
+	user, _, err := s.update(userWithID(id), func(user *models.User) (bool, error) {
+		if user.NIF != 0 {
+			return false, ErrRegistered
+		}
+		// The table is locked while changing, so no other user can take the NIF meanwhile
+		for _, other := range s.docs {
+			if other.NIF == nif {
+				return false, ErrNIFTaken
+			}
+		}
+		user.NIF = nif
+		return setFields(user, fields)
+	})
+	return user, err
+}
+
+func (s *memoryUsers) DeleteByNIF(ctx context.Context, nif int64) (models.User, error) {
+	return s.remove(func(user models.User) bool { return int64(user.NIF) == nif })
+}
+
+func (s *memoryUsers) ReplacePassword(ctx context.Context, id primitive.ObjectID, current, replacement string) error {
+	match := func(user models.User) bool { return user.ID == id && user.Password == current }
+	_, _, err := s.update(match, func(user *models.User) (bool, error) {
+		user.Password = replacement
+		return true, nil
+	})
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+func (s *memoryUsers) IncrementFailedLogins(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	user, _, err := s.update(userWithID(id), func(user *models.User) (bool, error) {
+		user.FailedLogins++
+		return true, nil
+	})
+	return user, err
+}
+
+func (s *memoryUsers) CountServiceDone(ctx context.Context, id primitive.ObjectID, role string, appointmentID primitive.ObjectID) error {
+	_, _, err := s.update(userWithID(id), func(user *models.User) (bool, error) {
+		for i := range user.Role {
+			if user.Role[i].Name != role {
+				continue
+			}
+			if slices.Contains(user.Counted, appointmentID) {
+				return false, nil
+			}
+			user.Role[i].ServicesDone++
+			user.Counted = append(user.Counted, appointmentID)
+			return true, nil
+		}
+		return false, ErrNotFound
+	})
+	return err
+}
+
+func (s *memoryUsers) SetVerification(ctx context.Context, email string, code models.VerificationCode) error {
+	_, _, err := s.update(userWithEmail(email), func(user *models.User) (bool, error) {
+		user.Verification = &code
+		return true, nil
+	})
+	return err
+}
+
+func (s *memoryUsers) CountCodeAttempt(ctx context.Context, email, codeHash string) (models.User, error) {
+	user, _, err := s.update(userWithCode(email, codeHash), func(user *models.User) (bool, error) {
+		user.Verification.Attempts++
+		return true, nil
+	})
+	return user, err
+}
+
+func (s *memoryUsers) ConsumeVerification(ctx context.Context, email, codeHash, passwordHash string) error {
+	_, _, err := s.update(userWithCode(email, codeHash), func(user *models.User) (bool, error) {
+		user.Password = passwordHash
+		user.FailedLogins = 0
+		user.Verification = nil
+		return true, nil
+	})
+	return err
+}
+
+func (s *memoryUsers) AdvanceTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	match := func(user models.User) bool {
+		return user.ID == id && user.TwoFactor != nil && user.TwoFactor.LastStep < step
+	}
+	_, _, err := s.update(match, func(user *models.User) (bool, error) {
+		user.TwoFactor.LastStep = step
+		return true, nil
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *memoryUsers) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error) {
+	match := func(user models.User) bool {
+		if user.ID != id || user.TwoFactor == nil {
+			return false
+		}
+		for _, hash := range user.TwoFactor.RecoveryCodes {
+			if hash == codeHash {
+				return true
+			}
+		}
+		return false
+	}
+	_, _, err := s.update(match, func(user *models.User) (bool, error) {
+		remaining := make([]string, 0, len(user.TwoFactor.RecoveryCodes))
+		for _, hash := range user.TwoFactor.RecoveryCodes {
+			if hash != codeHash {
+				remaining = append(remaining, hash)
+			}
+		}
+		user.TwoFactor.RecoveryCodes = remaining
+		return true, nil
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *memoryUsers) EnableTwoFactor(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodes []string) (bool, error) {
+	match := func(user models.User) bool {
+		return user.ID == id && user.TwoFactor != nil && user.TwoFactor.Secret == secret && !user.TwoFactor.Enabled
+	}
+	_, _, err := s.update(match, func(user *models.User) (bool, error) {
+		user.TwoFactor.Enabled = true
+		user.TwoFactor.LastStep = step
+		user.TwoFactor.RecoveryCodes = recoveryCodes
+		return true, nil
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+type memoryAppointments struct {
+	table[models.Appointment]
+}
+
+func (s *memoryAppointments) List(ctx context.Context) ([]models.Appointment, error) {
+	return s.list(nil)
+}
+
+func (s *memoryAppointments) FindByID(ctx context.Context, id primitive.ObjectID) (models.Appointment, error) {
+	return s.find(func(appointment models.Appointment) bool { return appointment.ID == id })
+}
+
+func (s *memoryAppointments) Insert(ctx context.Context, appointment models.Appointment) error {
+	if appointment.ID.IsZero() {
+		appointment.ID = primitive.NewObjectID()
+	}
+	return s.insert(appointment)
+}
+
+func (s *memoryAppointments) Transition(ctx context.Context, id primitive.ObjectID, change models.StatusChange) (models.Appointment, error) {
+	match := func(appointment models.Appointment) bool { return appointment.ID == id }
+	appointment, _, err := s.update(match, func(appointment *models.Appointment) (bool, error) {
+		if appointment.Status != change.From {
+			return false, ErrStatusChanged
+		}
+		appointment.Status = change.To
+		appointment.History = append(appointment.History, change)
+		if change.To == models.StatusCompleted {
+			appointment.Uncounted = true
+		}
+		return true, nil
+	})
+	return appointment, err
+}
+
+func (s *memoryAppointments) MarkCounted(ctx context.Context, id primitive.ObjectID) error {
+	match := func(appointment models.Appointment) bool { return appointment.ID == id }
+	_, _, err := s.update(match, func(appointment *models.Appointment) (bool, error) {
+		appointment.Uncounted = false
+		return true, nil
+	})
+	return err
+}
+
+func (s *memoryAppointments) Find(ctx context.Context, query AppointmentQuery) ([]models.Appointment, error) {
+	appointments, err := s.list(func(appointment models.Appointment) bool {
+		return (query.ProviderID.IsZero() || appointment.Provider.ID == query.ProviderID) &&
+			(query.ProviderNIF == 0 || appointment.Provider.NIF == query.ProviderNIF) &&
+			(query.ClientNIF == 0 || appointment.Client.NIF == query.ClientNIF) &&
+			(len(query.Statuses) == 0 || slices.Contains(query.Statuses, appointment.Status) ||
+				(!query.Past.IsZero() && !appointment.End.After(query.Past))) &&
+			(!query.Uncounted || appointment.Uncounted) &&
+			(query.From.IsZero() || appointment.End.After(query.From)) &&
+			(query.To.IsZero() || appointment.Start.Before(query.To)) &&
+			(query.EndedBy.IsZero() || !appointment.End.After(query.EndedBy))
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(appointments, func(i, j int) bool { return appointments[i].Start.Before(appointments[j].Start) })
+	return appointments, nil
+}
+
+func (s *memoryAppointments) Book(ctx context.Context, appointment models.Appointment, buffer time.Duration) (models.Appointment, error) {
+	if appointment.ID.IsZero() {
+		appointment.ID = primitive.NewObjectID()
+	}
+	copied, err := clone(appointment)
+	if err != nil {
+		return models.Appointment{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, booked := range s.docs {
+		if booked.Provider.ID == appointment.Provider.ID && booked.HoldsSlots() && booked.Overlaps(appointment, buffer) {
+			holder, err := clone(booked)
+			if err != nil {
+				return models.Appointment{}, err
+			}
+			return holder, ErrSlotTaken
+		}
+	}
+	s.docs = append(s.docs, copied)
+	return appointment, nil
+}
+
+// Release has nothing to do in memory, where a booking looks at the status of the other appointments
+func (s *memoryAppointments) Release(ctx context.Context, id primitive.ObjectID) error {
+	return nil
+}
+
+type memoryFees struct {
+	table[models.Fee]
+}
+
+func (s *memoryFees) List(ctx context.Context) ([]models.Fee, error) {
+	return s.list(nil)
+}
+
+func (s *memoryFees) ListByNIF(ctx context.Context, nif int64) ([]models.Fee, error) {
+	return s.list(func(fee models.Fee) bool { return fee.NIF == nif })
+}
+
+func (s *memoryFees) FindByID(ctx context.Context, id primitive.ObjectID) (models.Fee, error) {
+	return s.find(func(fee models.Fee) bool { return fee.ID == id })
+}
+
+func (s *memoryFees) Insert(ctx context.Context, fee models.Fee) error {
+	if fee.ID.IsZero() {
+		fee.ID = primitive.NewObjectID()
+	}
+	return s.insert(fee)
+}
+
+func (s *memoryFees) MarkPaid(ctx context.Context, id primitive.ObjectID) (models.Fee, error) {
+	fee, _, err := s.update(func(fee models.Fee) bool { return fee.ID == id }, func(fee *models.Fee) (bool, error) {
+		if fee.Paid {
+			return false, ErrPaid
+		}
+		fee.Paid = true
+		return true, nil
+	})
+	return fee, err
+}
+
+type memoryServiceTypes struct {
+	table[models.ServiceType]
+}
+
+func serviceTypeWithID(id primitive.ObjectID) func(models.ServiceType) bool {
+	return func(serviceType models.ServiceType) bool { return serviceType.ID == id }
+}
+
+func (s *memoryServiceTypes) List(ctx context.Context) ([]models.ServiceType, error) {
+	return s.list(nil)
+}
+
+func (s *memoryServiceTypes) ListByName(ctx context.Context, name string) ([]models.ServiceType, error) {
+	return s.list(func(serviceType models.ServiceType) bool { return serviceType.Name == name })
+}
+
+func (s *memoryServiceTypes) ListByEmployee(ctx context.Context, employeeID string) ([]models.ServiceType, error) {
+	return s.list(func(serviceType models.ServiceType) bool { return serviceType.EmployeeID == employeeID })
+}
+
+func (s *memoryServiceTypes) FindByID(ctx context.Context, id primitive.ObjectID) (models.ServiceType, error) {
+	return s.find(serviceTypeWithID(id))
+}
+
+func (s *memoryServiceTypes) Insert(ctx context.Context, serviceType models.ServiceType) error {
+	if serviceType.ID.IsZero() {
+		serviceType.ID = primitive.NewObjectID()
+	}
+	return s.insert(serviceType)
+}
+
+func (s *memoryServiceTypes) Update(ctx context.Context, id primitive.ObjectID, fields Fields) (bool, error) {
+	_, modified, err := s.update(serviceTypeWithID(id), func(serviceType *models.ServiceType) (bool, error) {
+		return setFields(serviceType, fields)
+	})
+	return modified, err
+}
+
+func (s *memoryServiceTypes) Delete(ctx context.Context, id primitive.ObjectID) (models.ServiceType, error) {
+	return s.remove(serviceTypeWithID(id))
+}
+
+type memoryReviews struct {
+	table[models.Review]
+}
+
+func (s *memoryReviews) ListByEmployee(ctx context.Context, employeeID string) ([]models.Review, error) {
+	return s.list(func(review models.Review) bool { return review.EmployeeID == employeeID })
+}
+
+func (s *memoryReviews) Insert(ctx context.Context, review models.Review) error {
+	if review.ID.IsZero() {
+		review.ID = primitive.NewObjectID()
+	}
+	return s.insert(review)
+}
+
+type memoryRoles struct {
+	table[models.Role]
+}
+
+func (s *memoryRoles) Insert(ctx context.Context, role models.Role) error {
+	if role.ID.IsZero() {
+		role.ID = primitive.NewObjectID()
+	}
+	return s.insert(role)
+}
+
+type memorySessions struct {
+	table[models.Session]
+}
+
+func (s *memorySessions) Insert(ctx context.Context, session models.Session) error {
+	if session.ID.IsZero() {
+		session.ID = primitive.NewObjectID()
+	}
+	return s.insert(session)
+}
+
+func (s *memorySessions) FindByID(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	return s.find(func(session models.Session) bool { return session.ID == id })
+}
+
+func (s *memorySessions) FindByTokenHash(ctx context.Context, tokenHash string) (models.Session, error) {
+	return s.find(func(session models.Session) bool { return session.TokenHash == tokenHash })
+}
+
+func (s *memorySessions) FindByPreviousTokenHash(ctx context.Context, tokenHash string) (models.Session, error) {
+	return s.find(func(session models.Session) bool {
+		return session.PreviousTokenHash != "" && session.PreviousTokenHash == tokenHash
+	})
+}
+
+func (s *memorySessions) Rotate(ctx context.Context, id primitive.ObjectID, currentHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	match := func(session models.Session) bool {
+		return session.ID == id && session.TokenHash == currentHash && !session.Revoked
+	}
+	_, _, err := s.update(match, func(session *models.Session) (bool, error) {
+		session.TokenHash = newHash
+		session.PreviousTokenHash = currentHash
+		session.LastUsedAt = usedAt
+		session.ExpiresAt = expiresAt
+		return true, nil
+	})
+	if err == ErrNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *memorySessions) Revoke(ctx context.Context, id, userID primitive.ObjectID) error {
+	match := func(session models.Session) bool { return session.ID == id && session.UserID == userID }
+	_, _, err := s.update(match, func(session *models.Session) (bool, error) {
+		session.Revoked = true
+		return true, nil
+	})
+	return err
+}
+
+func (s *memorySessions) RevokeAll(ctx context.Context, userID primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.docs {
+		if s.docs[i].UserID == userID {
+			s.docs[i].Revoked = true
+		}
+	}
+	return nil
+}
+
+type memoryAudit struct {
+	table[models.AuditEntry]
+}
+
+func (s *memoryAudit) Insert(ctx context.Context, entry models.AuditEntry) error {
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	return s.insert(entry)
+}
+
+func (s *memoryAudit) Find(ctx context.Context, query AuditQuery) ([]models.AuditEntry, error) {
+	entries, err := s.list(func(entry models.AuditEntry) bool {
+		return (query.ActorID == "" || entry.ActorID == query.ActorID) &&
+			(query.TargetID == "" || entry.TargetID == query.TargetID) &&
+			(query.TargetType == "" || entry.TargetType == query.TargetType) &&
+			(query.Action == "" || entry.Action == query.Action) &&
+			(query.From.IsZero() || !entry.At.Before(query.From)) &&
+			(query.To.IsZero() || entry.At.Before(query.To))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].At.After(entries[j].At) })
+	if query.Limit > 0 && len(entries) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+	return entries, nil
+}
+
+type memoryLocks struct {
+	table[models.Lock]
+}
+
+func (s *memoryLocks) Acquire(ctx context.Context, name, owner string, now, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, lock := range s.docs {
+		if lock.Name != name {
+			continue
+		}
+		if lock.Owner != owner && lock.ExpiresAt.After(now) {
+			return false, nil
+		}
+		s.docs[i] = models.Lock{Name: name, Owner: owner, ExpiresAt: expiresAt}
+		return true, nil
+	}
+	s.docs = append(s.docs, models.Lock{Name: name, Owner: owner, ExpiresAt: expiresAt})
+	return true, nil
+}
+
+func (s *memoryLocks) Release(ctx context.Context, name, owner string) error {
+	_, err := s.remove(func(lock models.Lock) bool { return lock.Name == name && lock.Owner == owner })
+	if err == ErrNotFound {
+		return nil
+	}
+	return err
+}
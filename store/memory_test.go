@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"PSbackend/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMemoryUserUpdate(t *testing.T) {
+	ctx := context.Background()
+	users := NewMemoryStores().Users
+	user := models.User{ID: primitive.NewObjectID(), Email: "john@example.com", Name: "John"}
+	if err := users.UpsertByEmail(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	modified, err := users.Update(ctx, user.ID, Fields{"name": "John Doe", "is_active": true})
+	if err != nil || !modified {
+		t.Fatalf("Expected the user to be modified, got %v and %v", modified, err)
+	}
+
+	modified, err = users.Update(ctx, user.ID, Fields{"name": "John Doe"})
+	if err != nil || modified {
+		t.Fatalf("Expected no modification when nothing changes, got %v and %v", modified, err)
+	}
+
+	if _, err := users.Update(ctx, primitive.NewObjectID(), Fields{"name": "Jane"}); err != ErrNotFound {
+		t.Fatalf("Expected ErrNotFound for a missing user, got %v", err)
+	}
+
+	stored, err := users.FindByEmail(ctx, "john@example.com")
+	if err != nil || stored.Name != "John Doe" || !stored.IsActive {
+		t.Fatalf("Update wasn't stored: %+v, %v", stored, err)
+	}
+
+	// Changing a returned user mustn't change the stored one
+	stored.Name = "Changed"
+	if again, _ := users.FindByID(ctx, user.ID); again.Name != "John Doe" {
+		t.Error("Stored user shares memory with the returned one")
+	}
+}
+
+func TestMemorySessionRotate(t *testing.T) {
+	ctx := context.Background()
+	sessions := NewMemoryStores().Sessions
+	session := models.Session{ID: primitive.NewObjectID(), UserID: primitive.NewObjectID(), TokenHash: "first"}
+	if err := sessions.Insert(ctx, session); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if rotated, err := sessions.Rotate(ctx, session.ID, "first", "second", now, now.Add(time.Hour)); err != nil || !rotated {
+		t.Fatalf("Expected the session to rotate, got %v and %v", rotated, err)
+	}
+	if rotated, _ := sessions.Rotate(ctx, session.ID, "first", "third", now, now.Add(time.Hour)); rotated {
+		t.Fatal("A rotated token shouldn't rotate again")
+	}
+
+	if _, err := sessions.FindByPreviousTokenHash(ctx, "first"); err != nil {
+		t.Errorf("Expected the previous token to be kept, got %v", err)
+	}
+
+	if err := sessions.RevokeAll(ctx, session.UserID); err != nil {
+		t.Fatal(err)
+	}
+	if rotated, _ := sessions.Rotate(ctx, session.ID, "second", "third", now, now.Add(time.Hour)); rotated {
+		t.Error("A revoked session shouldn't rotate")
+	}
+}
@@ -0,0 +1,714 @@
+package store
+
+import (
+	"PSbackend/models"
+	"context"
+	"log/slog"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collections names the MongoDB collection of each store
+type Collections struct {
+	Users        string
+	Appointments string
+	Fees         string
+	Services     string
+	ServiceTypes string
+	Reviews      string
+	Roles        string
+	Sessions     string
+	Audit        string
+	Reservations string
+	Locks        string
+}
+
+// NewMongoStores returns stores backed by the collections of a MongoDB database
+func NewMongoStores(db *mongo.Database, names Collections) Stores {
+	return Stores{
+		Users:        mongoUsers{db.Collection(names.Users)},
+		Appointments: mongoAppointments{db.Collection(names.Appointments), db.Collection(names.Reservations)},
+		Fees:         mongoFees{db.Collection(names.Fees)},
+		Services:     mongoServiceTypes{db.Collection(names.Services)},
+		ServiceTypes: mongoServiceTypes{db.Collection(names.ServiceTypes)},
+		Reviews:      mongoReviews{db.Collection(names.Reviews)},
+		Roles:        mongoRoles{db.Collection(names.Roles)},
+		Sessions:     mongoSessions{db.Collection(names.Sessions)},
+		Audit:        mongoAudit{db.Collection(names.Audit)},
+		Locks:        mongoLocks{db.Collection(names.Locks)},
+	}
+}
+
+// EnsureIndexes creates the indexes the stores rely on, such as the one that keeps two appointments from
+// reserving the same slot of a technician
+func EnsureIndexes(ctx context.Context, db *mongo.Database, names Collections) error {
+	_, err := db.Collection(names.Reservations).Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "provider_id", Value: 1}, {Key: "slot", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "appointment_id", Value: 1}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Collection(names.Appointments).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "provider._id", Value: 1}, {Key: "start", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+
+	// A NIF belongs to one user; users who haven't completed their registration have none yet
+	_, err = db.Collection(names.Users).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "nif", Value: 1}},
+		Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"nif": bson.M{"$gt": 0}}),
+	})
+	return err
+}
+
+// findOne decodes the document matching filter, translating a missing document into ErrNotFound
+func findOne(ctx context.Context, collection *mongo.Collection, filter interface{}, v interface{}) error {
+	err := collection.FindOne(ctx, filter).Decode(v)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// findAll decodes every document matching filter into the slice pointed to by v
+func findAll(ctx context.Context, collection *mongo.Collection, filter interface{}, v interface{}, opts ...*options.FindOptions) error {
+	cursor, err := collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return err
+	}
+	return cursor.All(ctx, v)
+}
+
+// findOneAndUpdate applies update to the document matching filter and decodes the updated document
+func findOneAndUpdate(ctx context.Context, collection *mongo.Collection, filter, update interface{}, v interface{}) error {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(v)
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	return err
+}
+
+// updateFields sets fields of the document with the given ID and reports whether anything changed
+func updateFields(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, fields Fields) (bool, error) {
+	result, err := collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M(fields)})
+	if err != nil {
+		return false, err
+	}
+	if result.MatchedCount == 0 {
+		return false, ErrNotFound
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// updated runs a conditional update and reports whether it changed a document
+func updated(ctx context.Context, collection *mongo.Collection, filter, update interface{}) (bool, error) {
+	result, err := collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+type mongoUsers struct {
+	collection *mongo.Collection
+}
+
+func (s mongoUsers) List(ctx context.Context) ([]models.User, error) {
+	var users []models.User
+	err := findAll(ctx, s.collection, bson.M{}, &users)
+	return users, err
+}
+
+func (s mongoUsers) FindByID(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := findOne(ctx, s.collection, bson.M{"_id": id}, &user)
+	return user, err
+}
+
+func (s mongoUsers) FindByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := findOne(ctx, s.collection, bson.M{"email": email}, &user)
+	return user, err
+}
+
+func (s mongoUsers) FindByNIF(ctx context.Context, nif int64) (models.User, error) {
+	var user models.User
+	err := findOne(ctx, s.collection, bson.M{"nif": nif}, &user)
+	return user, err
+}
+
+func (s mongoUsers) UpsertByEmail(ctx context.Context, user models.User) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"email": user.Email}, bson.M{"$set": user}, options.Update().SetUpsert(true))
+	return err
+}
+
+func (s mongoUsers) Update(ctx context.Context, id primitive.ObjectID, fields Fields) (bool, error) {
+	return updateFields(ctx, s.collection, id, fields)
+}
+
+func (s mongoUsers) CompleteRegistration(ctx context.Context, id primitive.ObjectID, nif int, fields Fields) (models.User, error) {
+	set := bson.M(fields)
+	set["nif"] = nif
+	// Users who haven't completed their registration have no NIF, stored as 0 or left out
+	filter := bson.M{"_id": id, "nif": bson.M{"$in": bson.A{0, nil}}}
+	var user models.User
+	err := findOneAndUpdate(ctx, s.collection, filter, bson.M{"$set": set}, &user)
+	if mongo.IsDuplicateKeyError(err) {
+		return user, ErrNIFTaken
+	}
+	if err == ErrNotFound {
+		if _, err := s.FindByID(ctx, id); err != nil {
+			return user, err
+		}
+		return user, ErrRegistered
+	}
+	return user, err
+}
+
+func (s mongoUsers) DeleteByNIF(ctx context.Context, nif int64) (models.User, error) {
+	var user models.User
+	err := s.collection.FindOneAndDelete(ctx, bson.M{"nif": nif}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrNotFound
+	}
+	return user, err
+}
+
+func (s mongoUsers) ReplacePassword(ctx context.Context, id primitive.ObjectID, current, replacement string) error {
+	_, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "password": current}, bson.M{"$set": bson.M{"password": replacement}})
+	return err
+}
+
+func (s mongoUsers) IncrementFailedLogins(ctx context.Context, id primitive.ObjectID) (models.User, error) {
+	var user models.User
+	err := findOneAndUpdate(ctx, s.collection, bson.M{"_id": id}, bson.M{"$inc": bson.M{"failed_logins": 1}}, &user)
+	return user, err
+}
+
+func (s mongoUsers) CountServiceDone(ctx context.Context, id primitive.ObjectID, role string, appointmentID primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "role.name": role, "counted": bson.M{"$ne": appointmentID}}
+	update := bson.M{"$inc": bson.M{"role.$[role].services_done": 1}, "$push": bson.M{"counted": appointmentID}}
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"role.name": role}}})
+	result, err := s.collection.UpdateOne(ctx, filter, update, opts)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	// Tell an appointment counted already from a missing user or role
+	count, err := s.collection.CountDocuments(ctx, bson.M{"_id": id, "role.name": role})
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s mongoUsers) SetVerification(ctx context.Context, email string, code models.VerificationCode) error {
+	update := bson.M{"$set": bson.M{"verification_code": code}, "$unset": bson.M{"recovery_code": ""}}
+	result, err := s.collection.UpdateOne(ctx, bson.M{"email": email}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s mongoUsers) CountCodeAttempt(ctx context.Context, email, codeHash string) (models.User, error) {
+	var user models.User
+	filter := bson.M{"email": email, "verification_code.hash": codeHash}
+	err := findOneAndUpdate(ctx, s.collection, filter, bson.M{"$inc": bson.M{"verification_code.attempts": 1}}, &user)
+	return user, err
+}
+
+func (s mongoUsers) ConsumeVerification(ctx context.Context, email, codeHash, passwordHash string) error {
+	filter := bson.M{"email": email, "verification_code.hash": codeHash}
+	update := bson.M{"$set": bson.M{"password": passwordHash, "failed_logins": 0}, "$unset": bson.M{"verification_code": ""}}
+	ok, err := updated(ctx, s.collection, filter, update)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s mongoUsers) AdvanceTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error) {
+	filter := bson.M{"_id": id, "two_factor.last_step": bson.M{"$lt": step}}
+	return updated(ctx, s.collection, filter, bson.M{"$set": bson.M{"two_factor.last_step": step}})
+}
+
+func (s mongoUsers) UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error) {
+	filter := bson.M{"_id": id, "two_factor.recovery_codes": codeHash}
+	return updated(ctx, s.collection, filter, bson.M{"$pull": bson.M{"two_factor.recovery_codes": codeHash}})
+}
+
+func (s mongoUsers) EnableTwoFactor(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodes []string) (bool, error) {
+	filter := bson.M{"_id": id, "two_factor.secret": secret, "two_factor.enabled": false}
+	update := bson.M{"$set": bson.M{
+		"two_factor.enabled":        true,
+		"two_factor.last_step":      step,
+		"two_factor.recovery_codes": recoveryCodes,
+	}}
+	return updated(ctx, s.collection, filter, update)
+}
+
+type mongoAppointments struct {
+	collection   *mongo.Collection
+	reservations *mongo.Collection
+}
+
+const (
+	// staleReservation is how long a reservation waits for its appointment to be inserted; a reservation
+	// older than that without an appointment was left by a booking that failed halfway
+	staleReservation = 5 * time.Minute
+	// bookingAttempts bounds how many times a booking clears stale reservations and tries again
+	bookingAttempts = 3
+)
+
+func (s mongoAppointments) List(ctx context.Context) ([]models.Appointment, error) {
+	var appointments []models.Appointment
+	err := findAll(ctx, s.collection, bson.M{}, &appointments)
+	return appointments, err
+}
+
+func (s mongoAppointments) FindByID(ctx context.Context, id primitive.ObjectID) (models.Appointment, error) {
+	var appointment models.Appointment
+	err := findOne(ctx, s.collection, bson.M{"_id": id}, &appointment)
+	return appointment, err
+}
+
+func (s mongoAppointments) Insert(ctx context.Context, appointment models.Appointment) error {
+	_, err := s.collection.InsertOne(ctx, appointment)
+	return err
+}
+
+func (s mongoAppointments) Transition(ctx context.Context, id primitive.ObjectID, change models.StatusChange) (models.Appointment, error) {
+	var appointment models.Appointment
+	set := bson.M{"status": change.To}
+	if change.To == models.StatusCompleted {
+		set["uncounted"] = true
+	}
+	update := bson.M{"$set": set, "$push": bson.M{"history": change}}
+	err := findOneAndUpdate(ctx, s.collection, bson.M{"_id": id, "status": change.From}, update, &appointment)
+	if err == ErrNotFound {
+		// Tell a missing appointment from one moved meanwhile
+		if _, err := s.FindByID(ctx, id); err != nil {
+			return models.Appointment{}, err
+		}
+		return models.Appointment{}, ErrStatusChanged
+	}
+	if err != nil {
+		return models.Appointment{}, err
+	}
+
+	// A reservation left behind is cleared as stale by the next booking of the slot, so failing here isn't an error
+	if !appointment.HoldsSlots() {
+		if err := s.Release(ctx, id); err != nil {
+			slog.ErrorContext(ctx, "Failed to release the slots of an appointment", "appointment_id", id.Hex(), "status", appointment.Status, "error", err)
+		}
+	}
+	return appointment, nil
+}
+
+func (s mongoAppointments) MarkCounted(ctx context.Context, id primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$unset": bson.M{"uncounted": ""}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s mongoAppointments) Find(ctx context.Context, query AppointmentQuery) ([]models.Appointment, error) {
+	filter := bson.M{}
+	if !query.ProviderID.IsZero() {
+		filter["provider._id"] = query.ProviderID
+	}
+	if query.ProviderNIF != 0 {
+		filter["provider.nif"] = query.ProviderNIF
+	}
+	if query.ClientNIF != 0 {
+		filter["client.nif"] = query.ClientNIF
+	}
+	if len(query.Statuses) > 0 && !query.Past.IsZero() {
+		filter["$or"] = bson.A{bson.M{"status": bson.M{"$in": query.Statuses}}, bson.M{"end": bson.M{"$lte": query.Past}}}
+	} else if len(query.Statuses) > 0 {
+		filter["status"] = bson.M{"$in": query.Statuses}
+	}
+	if query.Uncounted {
+		filter["uncounted"] = true
+	}
+	end := bson.M{}
+	if !query.From.IsZero() {
+		end["$gt"] = query.From
+	}
+	if !query.EndedBy.IsZero() {
+		end["$lte"] = query.EndedBy
+	}
+	if len(end) > 0 {
+		filter["end"] = end
+	}
+	if !query.To.IsZero() {
+		filter["start"] = bson.M{"$lt": query.To}
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "start", Value: 1}})
+	appointments := make([]models.Appointment, 0)
+	err := findAll(ctx, s.collection, filter, &appointments, opts)
+	return appointments, err
+}
+
+func (s mongoAppointments) Book(ctx context.Context, appointment models.Appointment, buffer time.Duration) (models.Appointment, error) {
+	slots := appointment.Slots(buffer)
+	reservations := make([]interface{}, len(slots))
+	now := time.Now()
+	for i, slot := range slots {
+		reservations[i] = models.Reservation{
+			ProviderID:    appointment.Provider.ID,
+			Slot:          slot,
+			AppointmentID: appointment.ID,
+			ReservedAt:    now,
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		_, err := s.reservations.InsertMany(ctx, reservations)
+		if err == nil {
+			break
+		}
+		// Give back the slots reserved before the one that was taken
+		s.releaseDetached(ctx, appointment.ID)
+		if !mongo.IsDuplicateKeyError(err) {
+			return models.Appointment{}, err
+		}
+
+		holder, stale, err := s.holder(ctx, appointment, slots)
+		if err != nil {
+			return models.Appointment{}, err
+		}
+		if !stale || attempt == bookingAttempts {
+			return holder, ErrSlotTaken
+		}
+		_, err = s.reservations.DeleteMany(ctx, bson.M{"appointment_id": holder.ID})
+		if err != nil {
+			return models.Appointment{}, err
+		}
+	}
+
+	// Appointments booked before reservations existed hold no slots, so they're looked up directly
+	var booked models.Appointment
+	err := findOne(ctx, s.collection, bson.M{
+		"_id":          bson.M{"$ne": appointment.ID},
+		"provider._id": appointment.Provider.ID,
+		"status":       bson.M{"$in": models.HoldingStatuses},
+		"start":        bson.M{"$lt": slots[len(slots)-1].Add(models.SlotLength)},
+		"end":          bson.M{"$gt": slots[0].Add(-buffer)},
+	}, &booked)
+	if err == nil {
+		s.releaseDetached(ctx, appointment.ID)
+		return booked, ErrSlotTaken
+	}
+	if err != ErrNotFound {
+		s.releaseDetached(ctx, appointment.ID)
+		return models.Appointment{}, err
+	}
+
+	_, err = s.collection.InsertOne(ctx, appointment)
+	if err != nil {
+		s.releaseDetached(ctx, appointment.ID)
+		return models.Appointment{}, err
+	}
+	return appointment, nil
+}
+
+// holder finds the appointment holding one of the slots, and whether its reservation is stale: left by a
+// booking that failed halfway or by an appointment that doesn't hold its slots anymore
+func (s mongoAppointments) holder(ctx context.Context, appointment models.Appointment, slots []time.Time) (models.Appointment, bool, error) {
+	var reservation models.Reservation
+	err := findOne(ctx, s.reservations, bson.M{
+		"provider_id":    appointment.Provider.ID,
+		"slot":           bson.M{"$in": slots},
+		"appointment_id": bson.M{"$ne": appointment.ID},
+	}, &reservation)
+	if err == ErrNotFound {
+		// The slot was released in the meantime
+		return models.Appointment{}, true, nil
+	}
+	if err != nil {
+		return models.Appointment{}, false, err
+	}
+
+	holder, err := s.FindByID(ctx, reservation.AppointmentID)
+	if err == ErrNotFound {
+		// The booking holding the slot may still be inserting its appointment
+		pending := models.Appointment{ID: reservation.AppointmentID, Status: models.StatusRequested, Start: reservation.Slot, End: reservation.Slot.Add(models.SlotLength)}
+		return pending, time.Since(reservation.ReservedAt) > staleReservation, nil
+	}
+	if err != nil {
+		return models.Appointment{}, false, err
+	}
+	return holder, !holder.HoldsSlots(), nil
+}
+
+func (s mongoAppointments) Release(ctx context.Context, id primitive.ObjectID) error {
+	_, err := s.reservations.DeleteMany(ctx, bson.M{"appointment_id": id})
+	return err
+}
+
+// releaseDetached undoes the reservations of a failed booking even when its request was canceled, so they
+// don't wait until they're stale
+func (s mongoAppointments) releaseDetached(ctx context.Context, id primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+	defer cancel()
+	err := s.Release(ctx, id)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to release the reservations of a failed booking", "appointment_id", id.Hex(), "error", err)
+	}
+}
+
+type mongoFees struct {
+	collection *mongo.Collection
+}
+
+func (s mongoFees) List(ctx context.Context) ([]models.Fee, error) {
+	fees := make([]models.Fee, 0)
+	err := findAll(ctx, s.collection, bson.M{}, &fees)
+	return fees, err
+}
+
+func (s mongoFees) ListByNIF(ctx context.Context, nif int64) ([]models.Fee, error) {
+	fees := make([]models.Fee, 0)
+	err := findAll(ctx, s.collection, bson.M{"nif": nif}, &fees)
+	return fees, err
+}
+
+func (s mongoFees) FindByID(ctx context.Context, id primitive.ObjectID) (models.Fee, error) {
+	var fee models.Fee
+	err := findOne(ctx, s.collection, bson.M{"_id": id}, &fee)
+	return fee, err
+}
+
+func (s mongoFees) Insert(ctx context.Context, fee models.Fee) error {
+	_, err := s.collection.InsertOne(ctx, fee)
+	return err
+}
+
+func (s mongoFees) MarkPaid(ctx context.Context, id primitive.ObjectID) (models.Fee, error) {
+	var fee models.Fee
+	err := findOneAndUpdate(ctx, s.collection, bson.M{"_id": id, "paid": bson.M{"$ne": true}}, bson.M{"$set": bson.M{"paid": true}}, &fee)
+	if err == ErrNotFound {
+		// Tell a missing fee from one paid meanwhile
+		if _, err := s.FindByID(ctx, id); err != nil {
+			return fee, err
+		}
+		return fee, ErrPaid
+	}
+	return fee, err
+}
+
+type mongoServiceTypes struct {
+	collection *mongo.Collection
+}
+
+func (s mongoServiceTypes) List(ctx context.Context) ([]models.ServiceType, error) {
+	var serviceTypes []models.ServiceType
+	err := findAll(ctx, s.collection, bson.M{}, &serviceTypes)
+	return serviceTypes, err
+}
+
+func (s mongoServiceTypes) ListByName(ctx context.Context, name string) ([]models.ServiceType, error) {
+	var serviceTypes []models.ServiceType
+	err := findAll(ctx, s.collection, bson.M{"name": name}, &serviceTypes)
+	return serviceTypes, err
+}
+
+func (s mongoServiceTypes) ListByEmployee(ctx context.Context, employeeID string) ([]models.ServiceType, error) {
+	var serviceTypes []models.ServiceType
+	err := findAll(ctx, s.collection, bson.M{"employee_id": employeeID}, &serviceTypes)
+	return serviceTypes, err
+}
+
+func (s mongoServiceTypes) FindByID(ctx context.Context, id primitive.ObjectID) (models.ServiceType, error) {
+	var serviceType models.ServiceType
+	err := findOne(ctx, s.collection, bson.M{"_id": id}, &serviceType)
+	return serviceType, err
+}
+
+func (s mongoServiceTypes) Insert(ctx context.Context, serviceType models.ServiceType) error {
+	_, err := s.collection.InsertOne(ctx, serviceType)
+	return err
+}
+
+func (s mongoServiceTypes) Update(ctx context.Context, id primitive.ObjectID, fields Fields) (bool, error) {
+	return updateFields(ctx, s.collection, id, fields)
+}
+
+func (s mongoServiceTypes) Delete(ctx context.Context, id primitive.ObjectID) (models.ServiceType, error) {
+	var serviceType models.ServiceType
+	err := s.collection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&serviceType)
+	if err == mongo.ErrNoDocuments {
+		return serviceType, ErrNotFound
+	}
+	return serviceType, err
+}
+
+type mongoReviews struct {
+	collection *mongo.Collection
+}
+
+func (s mongoReviews) ListByEmployee(ctx context.Context, employeeID string) ([]models.Review, error) {
+	reviews := make([]models.Review, 0)
+	err := findAll(ctx, s.collection, bson.M{"employee_id": employeeID}, &reviews)
+	return reviews, err
+}
+
+func (s mongoReviews) Insert(ctx context.Context, review models.Review) error {
+	_, err := s.collection.InsertOne(ctx, review)
+	return err
+}
+
+type mongoRoles struct {
+	collection *mongo.Collection
+}
+
+func (s mongoRoles) Insert(ctx context.Context, role models.Role) error {
+	_, err := s.collection.InsertOne(ctx, role)
+	return err
+}
+
+type mongoSessions struct {
+	collection *mongo.Collection
+}
+
+func (s mongoSessions) Insert(ctx context.Context, session models.Session) error {
+	_, err := s.collection.InsertOne(ctx, session)
+	return err
+}
+
+func (s mongoSessions) FindByID(ctx context.Context, id primitive.ObjectID) (models.Session, error) {
+	var session models.Session
+	err := findOne(ctx, s.collection, bson.M{"_id": id}, &session)
+	return session, err
+}
+
+func (s mongoSessions) FindByTokenHash(ctx context.Context, tokenHash string) (models.Session, error) {
+	var session models.Session
+	err := findOne(ctx, s.collection, bson.M{"token_hash": tokenHash}, &session)
+	return session, err
+}
+
+func (s mongoSessions) FindByPreviousTokenHash(ctx context.Context, tokenHash string) (models.Session, error) {
+	var session models.Session
+	err := findOne(ctx, s.collection, bson.M{"previous_token_hash": tokenHash}, &session)
+	return session, err
+}
+
+func (s mongoSessions) Rotate(ctx context.Context, id primitive.ObjectID, currentHash, newHash string, usedAt, expiresAt time.Time) (bool, error) {
+	filter := bson.M{"_id": id, "token_hash": currentHash, "revoked": false}
+	update := bson.M{"$set": bson.M{
+		"token_hash":          newHash,
+		"previous_token_hash": currentHash,
+		"last_used_at":        usedAt,
+		"expires_at":          expiresAt,
+	}}
+	return updated(ctx, s.collection, filter, update)
+}
+
+func (s mongoSessions) Revoke(ctx context.Context, id, userID primitive.ObjectID) error {
+	result, err := s.collection.UpdateOne(ctx, bson.M{"_id": id, "user_id": userID}, bson.M{"$set": bson.M{"revoked": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s mongoSessions) RevokeAll(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.collection.UpdateMany(ctx, bson.M{"user_id": userID, "revoked": false}, bson.M{"$set": bson.M{"revoked": true}})
+	return err
+}
+
+type mongoAudit struct {
+	collection *mongo.Collection
+}
+
+func (s mongoAudit) Insert(ctx context.Context, entry models.AuditEntry) error {
+	_, err := s.collection.InsertOne(ctx, entry)
+	return err
+}
+
+func (s mongoAudit) Find(ctx context.Context, query AuditQuery) ([]models.AuditEntry, error) {
+	filter := bson.M{}
+	if query.ActorID != "" {
+		filter["actor_id"] = query.ActorID
+	}
+	if query.TargetID != "" {
+		filter["target_id"] = query.TargetID
+	}
+	if query.TargetType != "" {
+		filter["target_type"] = query.TargetType
+	}
+	if query.Action != "" {
+		filter["action"] = query.Action
+	}
+
+	period := bson.M{}
+	if !query.From.IsZero() {
+		period["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		period["$lt"] = query.To
+	}
+	if len(period) > 0 {
+		filter["at"] = period
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit))
+	}
+	entries := make([]models.AuditEntry, 0)
+	err := findAll(ctx, s.collection, filter, &entries, opts)
+	return entries, err
+}
+
+type mongoLocks struct {
+	collection *mongo.Collection
+}
+
+func (s mongoLocks) Acquire(ctx context.Context, name, owner string, now, expiresAt time.Time) (bool, error) {
+	// Upserting a lock held by another owner collides with its _id
+	filter := bson.M{"_id": name, "$or": bson.A{bson.M{"owner": owner}, bson.M{"expires_at": bson.M{"$lte": now}}}}
+	update := bson.M{"$set": bson.M{"owner": owner, "expires_at": expiresAt}}
+	_, err := s.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s mongoLocks) Release(ctx context.Context, name, owner string) error {
+	_, err := s.collection.DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	return err
+}
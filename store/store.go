@@ -0,0 +1,186 @@
+package store
+
+import (
+	"PSbackend/models"
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFound is returned when no document matches a lookup or an update
+	ErrNotFound = errors.New("not found")
+	// ErrSlotTaken is returned when booking an appointment at a time the technician is already booked
+	ErrSlotTaken = errors.New("slot already taken")
+	// ErrStatusChanged is returned when moving an appointment that isn't in the expected status anymore
+	ErrStatusChanged = errors.New("status changed")
+	// ErrNIFTaken is returned when giving a user the NIF of another user
+	ErrNIFTaken = errors.New("nif already taken")
+	// ErrRegistered is returned when completing the registration of a user who already completed it
+	ErrRegistered = errors.New("already registered")
+	// ErrPaid is returned when paying a fee that was already paid
+	ErrPaid = errors.New("already paid")
+)
+
+// Fields are the bson field names and values set by an update
+type Fields map[string]interface{}
+
+// UserStore keeps the users, their credentials and their login state
+type UserStore interface {
+	List(ctx context.Context) ([]models.User, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	FindByEmail(ctx context.Context, email string) (models.User, error)
+	FindByNIF(ctx context.Context, nif int64) (models.User, error)
+	// UpsertByEmail creates the user, or overwrites the non-empty fields of the user with the same email
+	UpsertByEmail(ctx context.Context, user models.User) error
+	// Update sets fields of a user and reports whether anything changed; ErrNotFound means there's no such user
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) (bool, error)
+	DeleteByNIF(ctx context.Context, nif int64) (models.User, error)
+	// CompleteRegistration gives a user without a NIF yet their NIF and the other fields, and returns the updated
+	// user; it fails with ErrRegistered once they have one and with ErrNIFTaken when another user holds it
+	CompleteRegistration(ctx context.Context, id primitive.ObjectID, nif int, fields Fields) (models.User, error)
+	// ReplacePassword changes the password only if it's still the current one
+	ReplacePassword(ctx context.Context, id primitive.ObjectID, current, replacement string) error
+	// IncrementFailedLogins counts a failed login and returns the updated user
+	IncrementFailedLogins(ctx context.Context, id primitive.ObjectID) (models.User, error)
+	// CountServiceDone counts an appointment as a service done by the user in the role with the given name,
+	// once: counting it again changes nothing; ErrNotFound means there's no such user or they don't have the role
+	CountServiceDone(ctx context.Context, id primitive.ObjectID, role string, appointmentID primitive.ObjectID) error
+	// SetVerification stores a new verification code, replacing the previous one
+	SetVerification(ctx context.Context, email string, code models.VerificationCode) error
+	// CountCodeAttempt counts an attempt at the verification code with the given hash and returns the updated user
+	CountCodeAttempt(ctx context.Context, email, codeHash string) (models.User, error)
+	// ConsumeVerification sets the password and removes the verification code, so it can only be used once
+	ConsumeVerification(ctx context.Context, email, codeHash, passwordHash string) error
+	// AdvanceTOTPStep records the time step of a TOTP code, failing if that step or a later one was already used
+	AdvanceTOTPStep(ctx context.Context, id primitive.ObjectID, step int64) (bool, error)
+	// UseRecoveryCode removes a two-factor recovery code, failing if it was already used
+	UseRecoveryCode(ctx context.Context, id primitive.ObjectID, codeHash string) (bool, error)
+	// EnableTwoFactor enables the enrollment with the given secret, failing if it changed or was already enabled
+	EnableTwoFactor(ctx context.Context, id primitive.ObjectID, secret string, step int64, recoveryCodes []string) (bool, error)
+}
+
+// AppointmentQuery filters appointments; empty fields match every appointment
+type AppointmentQuery struct {
+	ProviderID  primitive.ObjectID
+	ProviderNIF int
+	ClientNIF   int
+	Statuses    []string
+	// Past keeps, along with the appointments in Statuses, the ones that ended by Past whatever their status
+	Past time.Time
+	// From and To keep the appointments that end after From and start before To
+	From time.Time
+	To   time.Time
+	// Uncounted keeps the completed appointments not counted yet as services done
+	Uncounted bool
+	// EndedBy keeps the appointments that end by EndedBy
+	EndedBy time.Time
+}
+
+// AppointmentStore keeps the appointments between clients and technicians
+type AppointmentStore interface {
+	List(ctx context.Context) ([]models.Appointment, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.Appointment, error)
+	Insert(ctx context.Context, appointment models.Appointment) error
+	// Transition moves an appointment still in change.From to change.To, appends change to its history,
+	// marks it uncounted when it completes, releases its slots once it doesn't hold them and returns the
+	// updated appointment; ErrStatusChanged means it was moved meanwhile
+	Transition(ctx context.Context, id primitive.ObjectID, change models.StatusChange) (models.Appointment, error)
+	// MarkCounted records that a completed appointment was counted as a service done by its client and technician
+	MarkCounted(ctx context.Context, id primitive.ObjectID) error
+	// Find returns the matching appointments, earliest first
+	Find(ctx context.Context, query AppointmentQuery) ([]models.Appointment, error)
+	// Book reserves the slots of a scheduled appointment followed by buffer and inserts it; when a scheduled
+	// appointment of the same technician already holds one of them it returns that appointment and ErrSlotTaken
+	Book(ctx context.Context, appointment models.Appointment, buffer time.Duration) (models.Appointment, error)
+	// Release frees the slots of an appointment that won't take place anymore
+	Release(ctx context.Context, id primitive.ObjectID) error
+}
+
+// FeeStore keeps the fees charged to technicians
+type FeeStore interface {
+	List(ctx context.Context) ([]models.Fee, error)
+	ListByNIF(ctx context.Context, nif int64) ([]models.Fee, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.Fee, error)
+	Insert(ctx context.Context, fee models.Fee) error
+	// MarkPaid marks a fee as paid and returns the updated fee; it fails with ErrPaid when it already was
+	MarkPaid(ctx context.Context, id primitive.ObjectID) (models.Fee, error)
+}
+
+// ServiceTypeStore keeps services or service types
+type ServiceTypeStore interface {
+	List(ctx context.Context) ([]models.ServiceType, error)
+	ListByName(ctx context.Context, name string) ([]models.ServiceType, error)
+	ListByEmployee(ctx context.Context, employeeID string) ([]models.ServiceType, error)
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.ServiceType, error)
+	Insert(ctx context.Context, serviceType models.ServiceType) error
+	// Update sets fields of a service type and reports whether anything changed; ErrNotFound means there's no such service type
+	Update(ctx context.Context, id primitive.ObjectID, fields Fields) (bool, error)
+	Delete(ctx context.Context, id primitive.ObjectID) (models.ServiceType, error)
+}
+
+// ReviewStore keeps the reviews of technicians
+type ReviewStore interface {
+	ListByEmployee(ctx context.Context, employeeID string) ([]models.Review, error)
+	Insert(ctx context.Context, review models.Review) error
+}
+
+// RoleStore keeps the roles created in the back office
+type RoleStore interface {
+	Insert(ctx context.Context, role models.Role) error
+}
+
+// SessionStore keeps the sessions of signed in users
+type SessionStore interface {
+	Insert(ctx context.Context, session models.Session) error
+	FindByID(ctx context.Context, id primitive.ObjectID) (models.Session, error)
+	FindByTokenHash(ctx context.Context, tokenHash string) (models.Session, error)
+	FindByPreviousTokenHash(ctx context.Context, tokenHash string) (models.Session, error)
+	// Rotate replaces the refresh token of a session, failing if it isn't the current one anymore
+	Rotate(ctx context.Context, id primitive.ObjectID, currentHash, newHash string, usedAt, expiresAt time.Time) (bool, error)
+	Revoke(ctx context.Context, id, userID primitive.ObjectID) error
+	RevokeAll(ctx context.Context, userID primitive.ObjectID) error
+}
+
+// AuditQuery filters the audit log; empty fields match every entry
+type AuditQuery struct {
+	ActorID    string
+	TargetID   string
+	TargetType string
+	Action     string
+	From       time.Time
+	To         time.Time
+	Limit      int
+}
+
+// AuditStore keeps the append-only audit log
+type AuditStore interface {
+	Insert(ctx context.Context, entry models.AuditEntry) error
+	// Find returns the matching entries, newest first
+	Find(ctx context.Context, query AuditQuery) ([]models.AuditEntry, error)
+}
+
+// LockStore keeps the locks that elect the replica running the background jobs
+type LockStore interface {
+	// Acquire takes the lock for owner until expiresAt, or extends it when owner already holds it; it
+	// reports false when another owner holds it past now
+	Acquire(ctx context.Context, name, owner string, now, expiresAt time.Time) (bool, error)
+	// Release gives up the lock if owner holds it
+	Release(ctx context.Context, name, owner string) error
+}
+
+// Stores groups every store the API depends on
+type Stores struct {
+	Users        UserStore
+	Appointments AppointmentStore
+	Fees         FeeStore
+	Services     ServiceTypeStore
+	ServiceTypes ServiceTypeStore
+	Reviews      ReviewStore
+	Roles        RoleStore
+	Sessions     SessionStore
+	Audit        AuditStore
+	Locks        LockStore
+}
@@ -0,0 +1,65 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"time"
+
+	// Embed the time zone database so zones load on hosts without one
+	_ "time/tzdata"
+)
+
+var (
+	ErrClock    = errors.New("must be a time of day such as 09:30, or 24:00 for the end of the day")
+	ErrDate     = errors.New("must be a date such as 2024-12-24")
+	ErrTimeZone = errors.New("must be an IANA time zone such as Europe/Lisbon")
+)
+
+// endOfDay is the only time of day written with hour 24
+const endOfDay = "24:00"
+
+// Clock reads a time of day written as 15:04, or 24:00 for the end of the day, as the time since midnight
+func Clock(value string) (time.Duration, error) {
+	if value == endOfDay {
+		return 24 * time.Hour, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil || len(value) != len("15:04") {
+		return 0, ErrClock
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// TimeZone loads an IANA time zone, refusing the empty name and Local, which depend on the server
+func TimeZone(name string) (*time.Location, error) {
+	if name == "" || strings.EqualFold(name, "Local") {
+		return nil, ErrTimeZone
+	}
+	zone, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, ErrTimeZone
+	}
+	return zone, nil
+}
+
+func checkClock(field reflect.Value, _ string, _ reflect.Value) string {
+	if _, err := Clock(field.String()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+func checkDate(field reflect.Value, _ string, _ reflect.Value) string {
+	if _, err := time.Parse(time.DateOnly, field.String()); err != nil {
+		return ErrDate.Error()
+	}
+	return ""
+}
+
+func checkTimeZone(field reflect.Value, _ string, _ reflect.Value) string {
+	if _, err := TimeZone(field.String()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
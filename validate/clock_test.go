@@ -0,0 +1,57 @@
+package validate
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	tests := []struct {
+		value string
+		since time.Duration
+		err   error
+	}{
+		{"00:00", 0, nil},
+		{"09:30", 9*time.Hour + 30*time.Minute, nil},
+		{"24:00", 24 * time.Hour, nil},
+		{"24:30", 0, ErrClock},
+		{"9:30", 0, ErrClock},
+		{"09:30:00", 0, ErrClock},
+	}
+
+	for _, tt := range tests {
+		since, err := Clock(tt.value)
+		if since != tt.since || err != tt.err {
+			t.Errorf("Clock(%q) = %v, %v; expected %v, %v", tt.value, since, err, tt.since, tt.err)
+		}
+	}
+}
+
+func TestScheduleRules(t *testing.T) {
+	type interval struct {
+		Start string `json:"start" validate:"required,clock"`
+		End   string `json:"end" validate:"required,clock,gtfield=start"`
+	}
+	type schedule struct {
+		Zone  string     `json:"zone" validate:"required,timezone"`
+		Date  string     `json:"date" validate:"date"`
+		Hours []interval `json:"hours"`
+	}
+
+	valid := schedule{Zone: "Europe/Lisbon", Date: "2024-12-24", Hours: []interval{{"09:00", "13:00"}, {"14:00", "24:00"}}}
+	if err := Struct(&valid); err != nil {
+		t.Errorf("Expected %+v to be valid, got %v", valid, err)
+	}
+
+	invalid := schedule{Zone: "Local", Date: "24/12/2024", Hours: []interval{{"14:00", "09:00"}, {"9h", "10:00"}}}
+	expected := []string{"zone", "date", "hours[0].end", "hours[1].start"}
+	errs, _ := Struct(&invalid).(Errors)
+	if len(errs) != len(expected) {
+		t.Fatalf("Expected violations of %v, got %v", expected, errs)
+	}
+	for i, field := range expected {
+		if errs[i].Field != field {
+			t.Errorf("Expected a violation of %s, got %v", field, errs[i])
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+)
+
+// NIFKind tells whether a NIF belongs to a person or to a company or other collective entity
+type NIFKind int
+
+const (
+	Personal NIFKind = iota + 1
+	Company
+)
+
+var (
+	ErrNIFLength   = errors.New("must have 9 digits")
+	ErrNIFPrefix   = errors.New("must start with a valid NIF prefix")
+	ErrNIFChecksum = errors.New("has an invalid check digit")
+)
+
+// nifPrefixes maps the first digits of a NIF to the kind of taxpayer they are given to
+var nifPrefixes = map[string]NIFKind{
+	"1": Personal, "2": Personal, "3": Personal,
+	"45": Personal,
+	"5":  Company, "6": Company,
+	"70": Company, "71": Company, "72": Company, "74": Company, "75": Company, "77": Company, "78": Company, "79": Company,
+	"8":  Personal,
+	"90": Company, "91": Company, "98": Company, "99": Company,
+}
+
+// NIF checks the prefix and the mod-11 check digit of a Portuguese tax number and returns whose it is
+func NIF(nif int64) (NIFKind, error) {
+	digits := strconv.FormatInt(nif, 10)
+	if len(digits) != 9 {
+		return 0, ErrNIFLength
+	}
+
+	kind, ok := nifPrefixes[digits[:1]]
+	if !ok {
+		kind, ok = nifPrefixes[digits[:2]]
+	}
+	if !ok {
+		return 0, ErrNIFPrefix
+	}
+
+	sum := 0
+	for i := 0; i < 8; i++ {
+		sum += int(digits[i]-'0') * (9 - i)
+	}
+	check := 11 - sum%11
+	if check >= 10 {
+		check = 0
+	}
+	if int(digits[8]-'0') != check {
+		return 0, ErrNIFChecksum
+	}
+
+	return kind, nil
+}
+
+// checkNIF accepts a NIF held by an integer field or by a string of digits
+func checkNIF(field reflect.Value, _ string, _ reflect.Value) string {
+	var nif int64
+	switch field.Kind() {
+	case reflect.String:
+		parsed, err := strconv.ParseInt(field.String(), 10, 64)
+		if err != nil {
+			return ErrNIFLength.Error()
+		}
+		nif = parsed
+	default:
+		n, ok := number(field)
+		if !ok {
+			return "must be a NIF"
+		}
+		nif = int64(n)
+	}
+
+	if _, err := NIF(nif); err != nil {
+		return err.Error()
+	}
+	return ""
+}
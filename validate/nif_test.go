@@ -0,0 +1,27 @@
+package validate
+
+import "testing"
+
+func TestNIF(t *testing.T) {
+	tests := []struct {
+		nif  int64
+		kind NIFKind
+		err  error
+	}{
+		{123456789, Personal, nil},
+		{210422114, Personal, nil},
+		{501442600, Company, nil},
+		{980000009, Company, nil},
+		{210422113, 0, ErrNIFChecksum},
+		{12345678, 0, ErrNIFLength},
+		{1234567890, 0, ErrNIFLength},
+		{400000000, 0, ErrNIFPrefix},
+	}
+
+	for _, tt := range tests {
+		kind, err := NIF(tt.nif)
+		if kind != tt.kind || err != tt.err {
+			t.Errorf("NIF(%d) = %v, %v; expected %v, %v", tt.nif, kind, err, tt.kind, tt.err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// portugal is the calling code assumed for numbers written without one
+const portugal = "351"
+
+var (
+	ErrPhoneFormat   = errors.New("must be a phone number such as 912345678 or +351912345678")
+	ErrPhoneNational = errors.New("must be a Portuguese number with 9 digits starting with 2, 3, 6, 7, 8 or 9")
+)
+
+// Phone normalizes a phone number to E.164, such as +351912345678. Spaces, dashes, dots and
+// parentheses are ignored, 00 may stand for +, and numbers without a calling code are Portuguese.
+func Phone(phone string) (string, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+
+	international := false
+	if rest, ok := strings.CutPrefix(digits, "+"); ok {
+		digits, international = rest, true
+	} else if rest, ok := strings.CutPrefix(digits, "00"); ok {
+		digits, international = rest, true
+	}
+
+	if digits == "" || strings.Trim(digits, "0123456789") != "" {
+		return "", ErrPhoneFormat
+	}
+
+	if !international {
+		digits = portugal + digits
+	}
+
+	if national, ok := strings.CutPrefix(digits, portugal); ok {
+		if len(national) != 9 || !strings.ContainsAny(national[:1], "236789") {
+			return "", ErrPhoneNational
+		}
+	}
+
+	// E.164 numbers have at most 15 digits, and no calling code plus subscriber number is shorter than 8
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return "", ErrPhoneFormat
+	}
+
+	return "+" + digits, nil
+}
+
+func checkPhone(field reflect.Value, _ string, _ reflect.Value) string {
+	if _, err := Phone(field.String()); err != nil {
+		return err.Error()
+	}
+	return ""
+}
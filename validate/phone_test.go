@@ -0,0 +1,29 @@
+package validate
+
+import "testing"
+
+func TestPhone(t *testing.T) {
+	tests := []struct {
+		phone    string
+		expected string
+		err      error
+	}{
+		{"912345678", "+351912345678", nil},
+		{"912 345 678", "+351912345678", nil},
+		{"+351 912-345-678", "+351912345678", nil},
+		{"00351912345678", "+351912345678", nil},
+		{"(+44) 20 7946 0958", "+442079460958", nil},
+		{"12345678", "", ErrPhoneNational},
+		{"+351 12345678", "", ErrPhoneNational},
+		{"91234567a", "", ErrPhoneFormat},
+		{"+1234567", "", ErrPhoneFormat},
+		{"+1234567890123456", "", ErrPhoneFormat},
+	}
+
+	for _, tt := range tests {
+		phone, err := Phone(tt.phone)
+		if phone != tt.expected || err != tt.err {
+			t.Errorf("Phone(%q) = %q, %v; expected %q, %v", tt.phone, phone, err, tt.expected, tt.err)
+		}
+	}
+}
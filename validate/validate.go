@@ -0,0 +1,336 @@
+// Package validate checks request structs against the rules declared in their validate tags.
+//
+// Rules are separated by commas, as in `validate:"required,max=100"`. Apart from required, a rule is
+// skipped when the field is empty. Struct fields and slices of structs are checked field by field.
+package validate
+
+import (
+	"fmt"
+	"math"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Violation is a field that breaks one of its rules
+type Violation struct {
+	Field   string
+	Message string
+}
+
+// Errors lists every violation found in a struct
+type Errors []Violation
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, violation := range e {
+		messages[i] = violation.Field + " " + violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// rule checks one field against the parameter of its tag, given the struct holding it, and
+// returns what is wrong with it or "" when it passes
+type rule func(field reflect.Value, param string, parent reflect.Value) string
+
+// rules are the rules a tag can name besides required
+var rules = map[string]rule{
+	"min":      checkMin,
+	"max":      checkMax,
+	"gt":       checkGreater,
+	"email":    checkEmail,
+	"oneof":    checkOneOf,
+	"numeric":  checkNumeric,
+	"number":   checkNumber,
+	"datetime": checkDatetime,
+	"gtfield":  checkAfterField,
+	"gtefield": checkNotBeforeField,
+	"nif":      checkNIF,
+	"phone":    checkPhone,
+	"clock":    checkClock,
+	"date":     checkDate,
+	"timezone": checkTimeZone,
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Struct checks every field of the struct v points to and returns Errors with all the violations, or nil
+func Struct(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	if value.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: %T isn't a struct", v))
+	}
+
+	violations := check(value, "")
+	if len(violations) > 0 {
+		return violations
+	}
+	return nil
+}
+
+func check(value reflect.Value, prefix string) Errors {
+	var violations Errors
+	for i := 0; i < value.NumField(); i++ {
+		structField := value.Type().Field(i)
+		if !structField.IsExported() {
+			continue
+		}
+		field := value.Field(i)
+		name := prefix + fieldName(structField)
+
+		if message := checkField(field, structField.Tag.Get("validate"), value); message != "" {
+			violations = append(violations, Violation{Field: name, Message: message})
+			continue
+		}
+
+		switch {
+		case field.Kind() == reflect.Struct && field.Type() != timeType:
+			violations = append(violations, check(field, name+".")...)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Struct && field.Type().Elem() != timeType:
+			for j := 0; j < field.Len(); j++ {
+				violations = append(violations, check(field.Index(j), fmt.Sprintf("%s[%d].", name, j))...)
+			}
+		}
+	}
+	return violations
+}
+
+// checkField returns what is wrong with field according to the first rule of tag it breaks
+func checkField(field reflect.Value, tag string, parent reflect.Value) string {
+	if tag == "" {
+		return ""
+	}
+
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(part, "=")
+		if name == "required" {
+			if isEmpty(field) {
+				return "is required"
+			}
+			continue
+		}
+		if isEmpty(field) {
+			return ""
+		}
+
+		checkRule, ok := rules[name]
+		if !ok {
+			panic("validate: unknown rule " + name)
+		}
+		if message := checkRule(field, param, parent); message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+// fieldName is the name of a field in the JSON payload
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func isEmpty(field reflect.Value) bool {
+	switch field.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(field.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return field.Len() == 0
+	}
+	return field.IsZero()
+}
+
+// number reads a numeric field as a float64
+func number(field reflect.Value) (float64, bool) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(field.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(field.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return field.Float(), true
+	}
+	return 0, false
+}
+
+// bound parses the numeric parameter of a rule
+func bound(rule, param string) float64 {
+	limit, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: %s=%q isn't a number", rule, param))
+	}
+	return limit
+}
+
+func checkMin(field reflect.Value, param string, _ reflect.Value) string {
+	limit := bound("min", param)
+	switch field.Kind() {
+	case reflect.String:
+		if float64(len([]rune(field.String()))) < limit {
+			return fmt.Sprintf("must be at least %s characters", param)
+		}
+	case reflect.Slice, reflect.Map:
+		if float64(field.Len()) < limit {
+			return fmt.Sprintf("must have at least %s items", param)
+		}
+	default:
+		if n, ok := number(field); ok && n < limit {
+			return fmt.Sprintf("must be at least %s", param)
+		}
+	}
+	return ""
+}
+
+func checkMax(field reflect.Value, param string, _ reflect.Value) string {
+	limit := bound("max", param)
+	switch field.Kind() {
+	case reflect.String:
+		if float64(len([]rune(field.String()))) > limit {
+			return fmt.Sprintf("must be at most %s characters", param)
+		}
+	case reflect.Slice, reflect.Map:
+		if float64(field.Len()) > limit {
+			return fmt.Sprintf("must have at most %s items", param)
+		}
+	default:
+		if n, ok := number(field); ok && n > limit {
+			return fmt.Sprintf("must be at most %s", param)
+		}
+	}
+	return ""
+}
+
+func checkGreater(field reflect.Value, param string, _ reflect.Value) string {
+	if n, ok := number(field); ok && n <= bound("gt", param) {
+		return "must be greater than " + param
+	}
+	return ""
+}
+
+func checkEmail(field reflect.Value, _ string, _ reflect.Value) string {
+	address, err := mail.ParseAddress(field.String())
+	if err != nil || address.Address != field.String() {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func checkOneOf(field reflect.Value, param string, _ reflect.Value) string {
+	options := strings.Fields(param)
+	for _, option := range options {
+		if fmt.Sprint(field.Interface()) == option {
+			return ""
+		}
+	}
+	return "must be one of " + strings.Join(options, ", ")
+}
+
+func checkNumeric(field reflect.Value, _ string, _ reflect.Value) string {
+	for _, c := range field.String() {
+		if c < '0' || c > '9' {
+			return "must contain only digits"
+		}
+	}
+	return ""
+}
+
+func checkNumber(field reflect.Value, _ string, _ reflect.Value) string {
+	n, err := strconv.ParseFloat(field.String(), 64)
+	if err != nil || math.IsInf(n, 0) || math.IsNaN(n) {
+		return "must be a number"
+	}
+	return ""
+}
+
+func checkDatetime(field reflect.Value, _ string, _ reflect.Value) string {
+	if _, err := time.Parse(time.RFC3339, field.String()); err != nil {
+		return "must be an RFC 3339 date and time, such as 2024-05-01T09:00:00+01:00"
+	}
+	return ""
+}
+
+// sibling finds the field of parent named name in the JSON payload
+func sibling(parent reflect.Value, name string) reflect.Value {
+	for i := 0; i < parent.NumField(); i++ {
+		if fieldName(parent.Type().Field(i)) == name {
+			return parent.Field(i)
+		}
+	}
+	panic("validate: no field named " + name)
+}
+
+// compare orders a field against another one holding numbers, times, RFC 3339 strings or times of day; ok is false
+// when either one is empty or unreadable, which is left to their own rules
+func compare(field, other reflect.Value) (order int, isTime bool, ok bool) {
+	if isEmpty(field) || isEmpty(other) {
+		return 0, false, false
+	}
+
+	if a, ok := number(field); ok {
+		b, ok := number(other)
+		if !ok {
+			return 0, false, false
+		}
+		switch {
+		case a < b:
+			return -1, false, true
+		case a > b:
+			return 1, false, true
+		}
+		return 0, false, true
+	}
+
+	if field.Kind() == reflect.String && other.Kind() == reflect.String {
+		a, errA := Clock(field.String())
+		b, errB := Clock(other.String())
+		if errA == nil && errB == nil {
+			return int(a - b), true, true
+		}
+	}
+
+	a, okA := instant(field)
+	b, okB := instant(other)
+	if !okA || !okB {
+		return 0, true, false
+	}
+	return a.Compare(b), true, true
+}
+
+// instant reads a time.Time field or an RFC 3339 string
+func instant(field reflect.Value) (time.Time, bool) {
+	if field.Type() == timeType {
+		return field.Interface().(time.Time), true
+	}
+	if field.Kind() == reflect.String {
+		t, err := time.Parse(time.RFC3339, field.String())
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+func checkAfterField(field reflect.Value, param string, parent reflect.Value) string {
+	order, isTime, ok := compare(field, sibling(parent, param))
+	if !ok || order > 0 {
+		return ""
+	}
+	if isTime {
+		return "must be after " + param
+	}
+	return "must be greater than " + param
+}
+
+func checkNotBeforeField(field reflect.Value, param string, parent reflect.Value) string {
+	order, isTime, ok := compare(field, sibling(parent, param))
+	if !ok || order >= 0 {
+		return ""
+	}
+	if isTime {
+		return "must not be before " + param
+	}
+	return "must be at least " + param
+}
@@ -0,0 +1,96 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type appointment struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Name     string   `json:"name" validate:"required,max=5"`
+	NIF      string   `json:"nif" validate:"numeric"`
+	Price    string   `json:"price" validate:"number"`
+	Status   string   `json:"status" validate:"oneof=SCHEDULED CANCELED"`
+	Hours    float64  `json:"hours" validate:"gt=0"`
+	Start    string   `json:"start" validate:"required,datetime"`
+	End      string   `json:"end" validate:"required,datetime,gtfield=start"`
+	Min      float64  `json:"min"`
+	Max      float64  `json:"max" validate:"gtefield=min"`
+	Services []review `json:"services"`
+}
+
+type review struct {
+	Comment string `json:"comment" validate:"required"`
+}
+
+func TestStruct(t *testing.T) {
+	valid := appointment{
+		Email:    "john@example.com",
+		Name:     "John",
+		NIF:      "210422114",
+		Price:    "12.50",
+		Status:   "SCHEDULED",
+		Hours:    2,
+		Start:    "2024-05-01T09:00:00.000+01:00",
+		End:      "2024-05-01T11:00:00Z",
+		Min:      5,
+		Max:      5,
+		Services: []review{{Comment: "Great"}},
+	}
+	if err := Struct(&valid); err != nil {
+		t.Fatalf("Expected a valid struct, got %v", err)
+	}
+
+	invalid := appointment{
+		Email:    "john",
+		Name:     "Johnny",
+		NIF:      "21042211A",
+		Price:    "cheap",
+		Status:   "DONE",
+		Hours:    -1,
+		Start:    "2024-05-01T09:00:00+01:00",
+		End:      "2024-05-01T08:00:00Z",
+		Min:      5,
+		Max:      4,
+		Services: []review{{}},
+	}
+	err := Struct(&invalid)
+
+	var violations Errors
+	if !errors.As(err, &violations) {
+		t.Fatalf("Expected Errors, got %v", err)
+	}
+	expected := Errors{
+		{Field: "email", Message: "must be a valid email address"},
+		{Field: "name", Message: "must be at most 5 characters"},
+		{Field: "nif", Message: "must contain only digits"},
+		{Field: "price", Message: "must be a number"},
+		{Field: "status", Message: "must be one of SCHEDULED, CANCELED"},
+		{Field: "hours", Message: "must be greater than 0"},
+		{Field: "end", Message: "must be after start"},
+		{Field: "max", Message: "must be at least min"},
+		{Field: "services[0].comment", Message: "is required"},
+	}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("Expected %v, got %v", expected, violations)
+	}
+}
+
+func TestStructSkipsEmptyOptionalFields(t *testing.T) {
+	err := Struct(&appointment{})
+
+	var violations Errors
+	if !errors.As(err, &violations) {
+		t.Fatalf("Expected Errors, got %v", err)
+	}
+	expected := Errors{
+		{Field: "email", Message: "is required"},
+		{Field: "name", Message: "is required"},
+		{Field: "start", Message: "is required"},
+		{Field: "end", Message: "is required"},
+	}
+	if !reflect.DeepEqual(violations, expected) {
+		t.Errorf("Expected %v, got %v", expected, violations)
+	}
+}